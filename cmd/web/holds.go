@@ -0,0 +1,32 @@
+package main
+
+import (
+	"time"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/handlers"
+)
+
+const holdSweepInterval = time.Minute
+
+//sweepHolds releases expired booking holds and cancels reservations whose deposit was not paid in time in the background
+func sweepHolds() {
+	go func() {
+		ticker := time.NewTicker(holdSweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			released, err := handlers.Repo.DB.DeleteExpiredHolds()
+			if err != nil {
+				errorLog.Println(err)
+			} else if released > 0 {
+				infoLog.Println("Released expired holds:", released)
+			}
+
+			expired, err := handlers.Repo.ExpireUnpaidReservations()
+			if err != nil {
+				errorLog.Println(err)
+			} else if expired > 0 {
+				infoLog.Println("Cancelled reservations with unpaid deposit:", expired)
+			}
+		}
+	}()
+}
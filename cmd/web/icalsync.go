@@ -0,0 +1,21 @@
+package main
+
+import (
+	"time"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/handlers"
+)
+
+const icalSyncInterval = 30 * time.Minute
+
+//syncICalImports mirrors external calendars as owner blocks in the background
+func syncICalImports() {
+	go func() {
+		client := handlers.NewICalClient()
+		ticker := time.NewTicker(icalSyncInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			handlers.Repo.SyncICalImports(client)
+		}
+	}()
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"crypto/rand"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -14,6 +16,7 @@ import (
 	"github.com/t-Ikonen/bbbookingsystem/internal/handlers"
 	"github.com/t-Ikonen/bbbookingsystem/internal/helpers"
 	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/payments"
 	"github.com/t-Ikonen/bbbookingsystem/internal/render"
 )
 
@@ -40,6 +43,10 @@ func main() {
 	defer close(appCnf.MailChan)
 	fmt.Printf("Starting mail listener\n")
 	listenForMail()
+	fmt.Printf("Starting hold sweeper\n")
+	sweepHolds()
+	fmt.Printf("Starting calendar imports\n")
+	syncICalImports()
 
 	fmt.Printf("Starting app on port %s for your pleasure \n", portNum)
 
@@ -58,12 +65,34 @@ func run() (*driver.DB, error) {
 	gob.Register(models.User{})
 	gob.Register(models.Restriction{})
 	gob.Register(models.Room{})
+	gob.Register(models.WaitlistEntry{})
+	gob.Register([]models.AlternativeStay{})
 	gob.Register(map[string]int{})
 
 	mailChan := make(chan models.MailData)
 	appCnf.MailChan = mailChan
+	//how long a chosen room is held for the guest during checkout
+	appCnf.HoldDuration = 15 * time.Minute
 	//change to true when in production
 	appCnf.InProduction = false
+	//address of the site used in links sent by email
+	appCnf.BaseURL = "http://localhost" + portNum
+	//key for signing guest links, links stop working when the key changes
+	appCnf.SigningKey = []byte(os.Getenv("BB_SIGNING_KEY"))
+	//secret the payment provider signs its webhook calls with
+	webhookSecret := []byte(os.Getenv("BB_PAYMENT_WEBHOOK_SECRET"))
+	//share of the total price paid when booking, zero skips the deposit step
+	appCnf.DepositPercent = 30
+	//how long a guest has to pay the deposit before the reservation is cancelled
+	appCnf.DepositTimeout = 30 * time.Minute
+	//business details printed on invoices
+	appCnf.Seller = models.Seller{
+		Name:       "Blacklodge B&B",
+		BusinessID: "1234567-8",
+		Address:    "Blacklodge Road 1, 99999 Twin Peaks",
+		Email:      "ed.glen@blacklodge.xyz",
+		IBAN:       "FI21 1234 5600 0007 85",
+	}
 
 	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	appCnf.InfoLog = infoLog
@@ -71,6 +100,29 @@ func run() (*driver.DB, error) {
 	errorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 	appCnf.ErrorLog = errorLog
 
+	if len(appCnf.SigningKey) == 0 {
+		appCnf.SigningKey = make([]byte, 32)
+		_, err := rand.Read(appCnf.SigningKey)
+		if err != nil {
+			return nil, err
+		}
+		errorLog.Println("BB_SIGNING_KEY is not set, guest links stop working when the app restarts")
+	}
+
+	if len(webhookSecret) == 0 {
+		webhookSecret = make([]byte, 32)
+		_, err := rand.Read(webhookSecret)
+		if err != nil {
+			return nil, err
+		}
+		errorLog.Println("BB_PAYMENT_WEBHOOK_SECRET is not set, payment webhook calls are refused")
+	}
+	//payment provider taking deposits, the fake provider moves no money and is for development only
+	appCnf.Payments = payments.NewFake(webhookSecret)
+	if appCnf.InProduction && !appCnf.Payments.Live() {
+		return nil, errors.New("payment provider " + appCnf.Payments.Name() + " moves no money and cannot be used in production")
+	}
+
 	//set up session
 	session = scs.New()
 	session.Lifetime = 24 * time.Hour
@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	"github.com/justinas/nosurf"
+	"github.com/t-Ikonen/bbbookingsystem/internal/apitoken"
+	"github.com/t-Ikonen/bbbookingsystem/internal/handlers"
 	"github.com/t-Ikonen/bbbookingsystem/internal/helpers"
 )
 
@@ -18,6 +20,10 @@ import (
 //NoSurf adds CSRT to all POST requests
 func NoSurf(next http.Handler) http.Handler {
 	csrtHandler := nosurf.New(next)
+	// API clients authenticate with tokens, not cookies
+	csrtHandler.ExemptGlob("/api/v1/*")
+	// payment provider signs its webhook calls instead
+	csrtHandler.ExemptPath("/payments/webhook")
 
 	csrtHandler.SetBaseCookie(http.Cookie{
 		HttpOnly: true,
@@ -43,3 +49,26 @@ func Auth(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+//APIAuth lets through API requests with a valid bearer token
+func APIAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := apitoken.FromRequest(r)
+		if token == "" {
+			apiUnauthorized(w)
+			return
+		}
+		_, err := handlers.Repo.DB.GetUserIDByAPIToken(apitoken.Hash(token))
+		if err != nil {
+			apiUnauthorized(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func apiUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write([]byte(`{"ok": false, "message": "invalid or missing API token"}`))
+}
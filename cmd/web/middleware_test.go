@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -31,3 +32,16 @@ func TestSessionLoad(t *testing.T) {
 		t.Error(fmt.Sprintf("Type is not HTTP handler in NoSurf(), %T", v))
 	}
 }
+
+func TestAPIAuth(t *testing.T) {
+	var myH myHandler
+	h := APIAuth(&myH)
+
+	req, _ := http.NewRequest("GET", "/api/v1/rooms", nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("APIAuth without token returned %d, wanted %d", rr.Code, http.StatusUnauthorized)
+	}
+}
@@ -25,6 +25,9 @@ func Routes(app *config.AppConfig) http.Handler {
 	mux.Get("/booking", handlers.Repo.Booking)
 	mux.Post("/booking", handlers.Repo.PostBooking)
 	mux.Post("/bookingjson", handlers.Repo.BookingJSON)
+	mux.Post("/waitlist", handlers.Repo.PostWaitlist)
+	mux.Get("/api/availability", handlers.Repo.AvailabilityJSON)
+	mux.Get("/ical/{token}.ics", handlers.Repo.RoomICal)
 
 	mux.Get("/chooseroom/{id}", handlers.Repo.ChooseRoom)
 
@@ -35,25 +38,98 @@ func Routes(app *config.AppConfig) http.Handler {
 
 	mux.Get("/reservation", handlers.Repo.Reservation)
 	mux.Post("/reservation", handlers.Repo.PostReservation)
+	mux.Get("/deposit", handlers.Repo.Deposit)
+	mux.Post("/deposit", handlers.Repo.PostDeposit)
+	mux.Post("/payments/webhook", handlers.Repo.PaymentWebhook)
 	mux.Get("/reservationsummary", handlers.Repo.Reservationsummary)
 
+	mux.Get("/vouchers", handlers.Repo.Vouchers)
+	mux.Post("/vouchers", handlers.Repo.PostVoucher)
+	mux.Get("/voucher/{token}", handlers.Repo.ShowVoucher)
+
+	mux.Get("/my-booking/{token}", handlers.Repo.GuestBooking)
+	mux.Post("/my-booking/{token}", handlers.Repo.PostGuestBooking)
+	mux.Post("/my-booking/{token}/cancel", handlers.Repo.PostGuestCancel)
+
 	mux.Get("/user/login", handlers.Repo.ShowLogin)
 	mux.Post("/user/login", handlers.Repo.PostShowLogin)
 	mux.Get("/user/logout", handlers.Repo.ShowLogout)
 
+	mux.Route("/api/v1", func(mux chi.Router) {
+		mux.Use(APIAuth)
+		mux.Get("/rooms", handlers.Repo.APIRooms)
+		mux.Get("/availability", handlers.Repo.APIAvailability)
+		mux.Post("/reservations", handlers.Repo.APICreateReservation)
+		mux.Get("/reservations/{id}", handlers.Repo.APIGetReservation)
+		mux.Put("/reservations/{id}", handlers.Repo.APIUpdateReservation)
+		mux.Delete("/reservations/{id}", handlers.Repo.APICancelReservation)
+	})
+
 	mux.Route("/admin", func(mux chi.Router) {
-		//mux.Use(Auth)
+		mux.Use(Auth)
 		mux.Get("/dashboard", handlers.Repo.AdminDashboard)
+		mux.Get("/housekeeping", handlers.Repo.AdminHousekeeping)
+		mux.Post("/housekeeping/status", handlers.Repo.AdminPostRoomStatus)
+		mux.Post("/housekeeping/assign", handlers.Repo.AdminPostHousekeepingAssign)
+		mux.Post("/check-in/{id}", handlers.Repo.AdminCheckIn)
+		mux.Post("/check-out/{id}", handlers.Repo.AdminCheckOut)
 		mux.Get("/statistics", handlers.Repo.AdminStatistics)
 
 		mux.Get("/reservations-new", handlers.Repo.AdminNewReservations)
 		mux.Get("/reservations-all", handlers.Repo.AdminAllReservations)
 		mux.Get("/reservation-calendar", handlers.Repo.AdminCalendar)
-		mux.Get("/prosess-reservation/{src}/{id}", handlers.Repo.AdminProcessReservation)
+		mux.Post("/reservation-calendar", handlers.Repo.AdminPostCalendar)
+		mux.Post("/reservation-status/{src}/{id}/{status}", handlers.Repo.AdminReservationStatus)
 		mux.Get("/delete-reservation/{src}/{id}", handlers.Repo.AdminDelteReservation)
+		mux.Post("/cancel-reservation/{src}/{id}", handlers.Repo.AdminCancelReservation)
+		mux.Post("/create-invoice/{src}/{id}", handlers.Repo.AdminCreateInvoice)
+		mux.Post("/email-invoice/{src}/{id}", handlers.Repo.AdminEmailInvoice)
+		mux.Get("/invoices/{id}", handlers.Repo.AdminShowInvoice)
+		mux.Get("/invoices/{id}/pdf", handlers.Repo.AdminInvoicePDF)
 
 		mux.Get("/reservations/{src}/{id}", handlers.Repo.AdminShowReservation)
 		mux.Post("/reservations/{src}/{id}", handlers.Repo.AdminPostReservation)
+
+		mux.Get("/rooms", handlers.Repo.AdminRooms)
+		mux.Get("/rooms/{id}", handlers.Repo.AdminShowRoom)
+		mux.Post("/rooms/{id}", handlers.Repo.AdminPostRoom)
+		mux.Post("/deactivate-room/{id}", handlers.Repo.AdminDeactivateRoom)
+		mux.Post("/activate-room/{id}", handlers.Repo.AdminActivateRoom)
+		mux.Post("/delete-room/{id}", handlers.Repo.AdminDeleteRoom)
+		mux.Post("/new-ical-token/{id}", handlers.Repo.AdminNewICalToken)
+
+		mux.Get("/cancellation-policies", handlers.Repo.AdminCancellationPolicies)
+		mux.Post("/cancellation-policies", handlers.Repo.AdminPostCancellationPolicy)
+		mux.Post("/cancellation-policies/rate-plans", handlers.Repo.AdminPostRatePlanPolicy)
+		mux.Post("/delete-cancellation-policy/{id}", handlers.Repo.AdminDeleteCancellationPolicy)
+		mux.Get("/promo-codes", handlers.Repo.AdminPromoCodes)
+		mux.Post("/promo-codes", handlers.Repo.AdminPostPromoCode)
+		mux.Post("/delete-promo-code/{id}", handlers.Repo.AdminDeletePromoCode)
+		mux.Get("/extras", handlers.Repo.AdminExtras)
+		mux.Post("/extras", handlers.Repo.AdminPostExtra)
+		mux.Get("/extras/{id}", handlers.Repo.AdminShowExtra)
+		mux.Post("/extras/{id}", handlers.Repo.AdminPostExtra)
+		mux.Post("/delete-extra/{id}", handlers.Repo.AdminDeleteExtra)
+		mux.Get("/vouchers", handlers.Repo.AdminVouchers)
+		mux.Post("/vouchers", handlers.Repo.AdminPostVoucher)
+		mux.Get("/vouchers/{id}", handlers.Repo.AdminShowVoucher)
+		mux.Get("/vouchers/{id}/print", handlers.Repo.AdminPrintVoucher)
+		mux.Post("/email-voucher/{id}", handlers.Repo.AdminEmailVoucher)
+
+		mux.Get("/ical-imports", handlers.Repo.AdminICalImports)
+		mux.Post("/ical-imports", handlers.Repo.AdminPostICalImport)
+		mux.Post("/sync-ical-imports", handlers.Repo.AdminSyncICalImports)
+		mux.Post("/delete-ical-import/{id}", handlers.Repo.AdminDeleteICalImport)
+
+		mux.Get("/room-rules", handlers.Repo.AdminRoomRules)
+		mux.Post("/room-rules", handlers.Repo.AdminPostRoomRule)
+		mux.Post("/delete-room-rule/{id}", handlers.Repo.AdminDeleteRoomRule)
+
+		mux.Get("/audit", handlers.Repo.AdminAudit)
+
+		mux.Get("/api-tokens", handlers.Repo.AdminAPITokens)
+		mux.Post("/api-tokens", handlers.Repo.AdminPostAPIToken)
+		mux.Post("/delete-api-token/{id}", handlers.Repo.AdminDeleteAPIToken)
 	})
 
 	fileServer := http.FileServer(http.Dir("./static/"))
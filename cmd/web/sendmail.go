@@ -46,6 +46,9 @@ func SendMsg(m models.MailData) {
 		msgToSend := strings.Replace(mailTemplate, "[%body]", m.Message, 1)
 		email.SetBody(mail.TextHTML, msgToSend)
 	}
+	for _, a := range m.Attachments {
+		email.Attach(&mail.File{Name: a.Name, MimeType: a.MimeType, Data: a.Data})
+	}
 
 	err = email.Send(client)
 	if err != nil {
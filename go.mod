@@ -9,6 +9,7 @@ require (
 	github.com/go-chi/chi/v5 v5.0.4
 	github.com/jackc/pgconn v1.10.0
 	github.com/jackc/pgx/v4 v4.13.0
+	github.com/jung-kurt/gofpdf v1.16.2
 	github.com/justinas/nosurf v1.1.1
 	github.com/xhit/go-simple-mail/v2 v2.10.0
 	golang.org/x/crypto v0.0.0-20210711020723-a769d52b0f97
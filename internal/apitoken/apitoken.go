@@ -0,0 +1,39 @@
+package apitoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+//tokenBytes is the length of the random part of a token
+const tokenBytes = 32
+
+//New returns a new random API token and its hash, only the hash is stored
+func New() (string, string, error) {
+	b := make([]byte, tokenBytes)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", "", err
+	}
+	plain := base64.RawURLEncoding.EncodeToString(b)
+	return plain, Hash(plain), nil
+}
+
+//Hash returns the hex encoded SHA-256 hash of a token
+func Hash(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+//FromRequest returns the bearer token of the Authorization header, empty if there is none
+func FromRequest(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+}
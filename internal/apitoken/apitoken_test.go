@@ -0,0 +1,46 @@
+package apitoken
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	plain, hash, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain == "" || hash == "" {
+		t.Error("expected token and hash")
+	}
+	if hash != Hash(plain) {
+		t.Error("hash does not match token")
+	}
+
+	other, _, _ := New()
+	if other == plain {
+		t.Error("expected different tokens")
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	var tokenTests = []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{"bearer", "Bearer abc", "abc"},
+		{"missing", "", ""},
+		{"basic", "Basic abc", ""},
+	}
+
+	for _, e := range tokenTests {
+		r, _ := http.NewRequest("GET", "/api/v1/rooms", nil)
+		if e.header != "" {
+			r.Header.Set("Authorization", e.header)
+		}
+		if got := FromRequest(r); got != e.expected {
+			t.Errorf("for %s expected %q but got %q", e.name, e.expected, got)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+//Package cancellation calculates refunds of cancelled reservations from cancellation policies
+package cancellation
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+)
+
+//DaysBefore returns the number of whole days from the day of now to the arrival day
+func DaysBefore(start, now time.Time) int {
+	arrival := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return int(arrival.Sub(today).Hours() / 24)
+}
+
+//RefundPercent returns the refunded percentage when cancelling daysBefore days before arrival.
+//The tier with the most days not over daysBefore applies, without a matching tier nothing is refunded.
+//A policy without tiers, like no policy at all, refunds everything
+func RefundPercent(p models.CancellationPolicy, daysBefore int) int {
+	if len(p.Tiers) == 0 {
+		return 100
+	}
+
+	tiers := make([]models.CancellationTier, len(p.Tiers))
+	copy(tiers, p.Tiers)
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].DaysBefore > tiers[j].DaysBefore })
+
+	for _, t := range tiers {
+		if daysBefore >= t.DaysBefore {
+			return t.RefundPercent
+		}
+	}
+	return 0
+}
+
+//Refund returns the refundable amount of total when cancelling at now a stay starting at start
+func Refund(p models.CancellationPolicy, total float32, start, now time.Time) float32 {
+	percent := RefundPercent(p, DaysBefore(start, now))
+	return float32(math.Round(float64(total)*float64(percent)) / 100)
+}
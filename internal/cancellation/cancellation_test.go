@@ -0,0 +1,59 @@
+package cancellation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+)
+
+var policy = models.CancellationPolicy{
+	Name: "Moderate",
+	Tiers: []models.CancellationTier{
+		{DaysBefore: 7, RefundPercent: 50},
+		{DaysBefore: 14, RefundPercent: 100},
+	},
+}
+
+var arrival = time.Date(2050, 6, 20, 0, 0, 0, 0, time.UTC)
+
+var refundTests = []struct {
+	name     string
+	policy   models.CancellationPolicy
+	now      time.Time
+	expected float32
+}{
+	{"free well before", policy, time.Date(2050, 5, 1, 10, 0, 0, 0, time.UTC), 300},
+	{"free on last day", policy, time.Date(2050, 6, 6, 23, 0, 0, 0, time.UTC), 300},
+	{"half", policy, time.Date(2050, 6, 7, 8, 0, 0, 0, time.UTC), 150},
+	{"half on last day", policy, time.Date(2050, 6, 13, 8, 0, 0, 0, time.UTC), 150},
+	{"none", policy, time.Date(2050, 6, 14, 8, 0, 0, 0, time.UTC), 0},
+	{"none after arrival", policy, time.Date(2050, 6, 21, 8, 0, 0, 0, time.UTC), 0},
+	{"no policy", models.CancellationPolicy{}, time.Date(2050, 6, 19, 8, 0, 0, 0, time.UTC), 300},
+}
+
+func TestRefund(t *testing.T) {
+	for _, e := range refundTests {
+		got := Refund(e.policy, 300, arrival, e.now)
+		if got != e.expected {
+			t.Errorf("for %s expected %.2f but got %.2f", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestRefundRounding(t *testing.T) {
+	p := models.CancellationPolicy{Tiers: []models.CancellationTier{{DaysBefore: 0, RefundPercent: 33}}}
+	got := Refund(p, 99.99, arrival, arrival)
+	if got != 33 {
+		t.Errorf("expected 33.00 but got %.2f", got)
+	}
+}
+
+func TestDaysBefore(t *testing.T) {
+	if d := DaysBefore(arrival, time.Date(2050, 6, 19, 23, 59, 0, 0, time.UTC)); d != 1 {
+		t.Errorf("expected 1 day but got %d", d)
+	}
+	if d := DaysBefore(arrival, time.Date(2050, 6, 22, 0, 0, 0, 0, time.UTC)); d != -2 {
+		t.Errorf("expected -2 days but got %d", d)
+	}
+}
@@ -3,18 +3,27 @@ package config
 import (
 	"html/template"
 	"log"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/payments"
 )
 
 //Appcongi is configuration stuct for the app
 type AppConfig struct {
-	UseCache      bool
-	TemplateCache map[string]*template.Template
-	InfoLog       *log.Logger
-	ErrorLog      *log.Logger
-	InProduction  bool
-	Session       *scs.SessionManager
-	MailChan      chan models.MailData
+	UseCache       bool
+	TemplateCache  map[string]*template.Template
+	InfoLog        *log.Logger
+	ErrorLog       *log.Logger
+	InProduction   bool
+	Session        *scs.SessionManager
+	MailChan       chan models.MailData
+	HoldDuration   time.Duration
+	BaseURL        string
+	SigningKey     []byte
+	Seller         models.Seller
+	Payments       payments.Provider
+	DepositPercent int
+	DepositTimeout time.Duration
 }
@@ -0,0 +1,85 @@
+//Package extras prices the extras guests book with their stay
+package extras
+
+import (
+	"math"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+)
+
+//Units are the units of extras in the order they are offered
+var Units = []string{models.ExtraPerNight, models.ExtraPerPerson, models.ExtraPerStay}
+
+//labels are the unit names shown to guests
+var labels = map[string]string{
+	models.ExtraPerNight:  "per night",
+	models.ExtraPerPerson: "per person",
+	models.ExtraPerStay:   "per stay",
+}
+
+//Label returns the name of unit shown to guests
+func Label(unit string) string {
+	if l, ok := labels[unit]; ok {
+		return l
+	}
+	return unit
+}
+
+//ValidUnit tells if unit is a known extra unit
+func ValidUnit(unit string) bool {
+	_, ok := labels[unit]
+	return ok
+}
+
+//Quantity returns how many units of unit a stay of nights nights for guests guests takes
+func Quantity(unit string, nights, guests int) int {
+	switch unit {
+	case models.ExtraPerNight:
+		return nights
+	case models.ExtraPerPerson:
+		if guests < 1 {
+			return 1
+		}
+		return guests
+	default:
+		return 1
+	}
+}
+
+//Line returns extra e booked for a stay of nights nights for guests guests
+func Line(e models.Extra, nights, guests int) models.ReservationExtra {
+	l := models.ReservationExtra{
+		ExtraID:   e.ID,
+		Name:      e.Name,
+		Unit:      e.Unit,
+		UnitPrice: e.Price,
+		VATRate:   e.VATRate,
+	}
+	return Requantify(l, nights, guests)
+}
+
+//Requantify returns booked extra l with its quantity and total for a stay of nights nights for guests guests
+func Requantify(l models.ReservationExtra, nights, guests int) models.ReservationExtra {
+	l.Quantity = Quantity(l.Unit, nights, guests)
+	l.Total = round(l.UnitPrice * float32(l.Quantity))
+	return l
+}
+
+//Choose returns the extras of available whose id is in ids booked for a stay of nights nights for guests guests.
+//Ids of extras not available are skipped
+func Choose(available []models.Extra, ids []int, nights, guests int) []models.ReservationExtra {
+	var lines []models.ReservationExtra
+	for _, e := range available {
+		for _, id := range ids {
+			if e.ID == id {
+				lines = append(lines, Line(e, nights, guests))
+				break
+			}
+		}
+	}
+	return lines
+}
+
+func round(f float32) float32 {
+	return float32(math.Round(float64(f)*100) / 100)
+}
@@ -0,0 +1,68 @@
+package extras
+
+import (
+	"testing"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+)
+
+var quantityTests = []struct {
+	unit     string
+	nights   int
+	guests   int
+	expected int
+}{
+	{models.ExtraPerNight, 3, 2, 3},
+	{models.ExtraPerPerson, 3, 2, 2},
+	{models.ExtraPerPerson, 3, 0, 1},
+	{models.ExtraPerStay, 3, 2, 1},
+	{"unknown", 3, 2, 1},
+}
+
+func TestQuantity(t *testing.T) {
+	for _, e := range quantityTests {
+		if q := Quantity(e.unit, e.nights, e.guests); q != e.expected {
+			t.Errorf("for %s expected %d but got %d", e.unit, e.expected, q)
+		}
+	}
+}
+
+var catalogue = []models.Extra{
+	{ID: 1, Name: "Breakfast", Price: 12.5, Unit: models.ExtraPerNight, VATRate: 14},
+	{ID: 2, Name: "Northern lights tour", Price: 89, Unit: models.ExtraPerPerson, VATRate: 25.5},
+	{ID: 3, Name: "Sauna evening", Price: 40, Unit: models.ExtraPerStay, VATRate: 25.5},
+}
+
+func TestChoose(t *testing.T) {
+	lines := Choose(catalogue, []int{3, 1, 7}, 3, 2)
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 extras but got %d", len(lines))
+	}
+	if lines[0].Name != "Breakfast" || lines[0].Quantity != 3 || lines[0].Total != 37.5 || lines[0].VATRate != 14 {
+		t.Errorf("wrong breakfast %+v", lines[0])
+	}
+	if lines[1].Name != "Sauna evening" || lines[1].Quantity != 1 || lines[1].Total != 40 {
+		t.Errorf("wrong sauna evening %+v", lines[1])
+	}
+
+	res := models.Reservation{Extras: lines}
+	if res.ExtrasTotal() != 77.5 {
+		t.Errorf("expected extras total 77.50 but got %.2f", res.ExtrasTotal())
+	}
+}
+
+func TestRequantify(t *testing.T) {
+	l := Requantify(Line(catalogue[1], 3, 2), 5, 4)
+	if l.Quantity != 4 || l.Total != 356 {
+		t.Errorf("expected 4 persons for 356.00 but got %d for %.2f", l.Quantity, l.Total)
+	}
+}
+
+func TestLabel(t *testing.T) {
+	if Label(models.ExtraPerNight) != "per night" || Label("x") != "x" {
+		t.Error("wrong unit labels")
+	}
+	if !ValidUnit(models.ExtraPerStay) || ValidUnit("x") {
+		t.Error("wrong unit validation")
+	}
+}
@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/t-Ikonen/bbbookingsystem/internal/forms"
+	"github.com/t-Ikonen/bbbookingsystem/internal/lifecycle"
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/repository"
+)
+
+//apiDateLayout is the date format used by the REST API
+const apiDateLayout = "2006-01-02"
+
+type apiRoom struct {
+	ID           int     `json:"id"`
+	RoomName     string  `json:"room_name"`
+	Description  string  `json:"description"`
+	MaxOccupancy int     `json:"max_occupancy"`
+	TotalPrice   float32 `json:"total_price,omitempty"`
+}
+
+type apiReservation struct {
+	ID           int     `json:"id"`
+	RoomID       int     `json:"room_id"`
+	RoomName     string  `json:"room_name"`
+	StartDate    string  `json:"start_date"`
+	EndDate      string  `json:"end_date"`
+	Adults       int     `json:"adults"`
+	Children     int     `json:"children"`
+	FirstName    string  `json:"first_name"`
+	LastName     string  `json:"last_name"`
+	Email        string  `json:"email"`
+	Phone        string  `json:"phone"`
+	TotalPrice   float32 `json:"total_price"`
+	Status       string  `json:"status"`
+	Deposit      float32 `json:"deposit,omitempty"`
+	PaymentDueAt string  `json:"payment_due_at,omitempty"`
+	CancelledAt  string  `json:"cancelled_at,omitempty"`
+	RefundAmount float32 `json:"refund_amount,omitempty"`
+}
+
+type apiResponse struct {
+	OK          bool                `json:"ok"`
+	Message     string              `json:"message,omitempty"`
+	Errors      map[string][]string `json:"errors,omitempty"`
+	Rooms       []apiRoom           `json:"rooms,omitempty"`
+	Reservation *apiReservation     `json:"reservation,omitempty"`
+}
+
+//toAPIReservation converts reservation model to its API form
+func toAPIReservation(res models.Reservation) *apiReservation {
+	out := &apiReservation{
+		ID:         res.ID,
+		RoomID:     res.RoomId,
+		RoomName:   res.Room.RoomName,
+		StartDate:  res.StartDate.Format(apiDateLayout),
+		EndDate:    res.EndDate.Format(apiDateLayout),
+		Adults:     res.Adults,
+		Children:   res.Children,
+		FirstName:  res.FirstName,
+		LastName:   res.LastName,
+		Email:      res.Email,
+		Phone:      res.Phone,
+		TotalPrice: res.TotalPrice,
+		Status:     res.Status,
+	}
+	if res.Status == models.StatusPending && !res.PaymentDueAt.IsZero() {
+		out.PaymentDueAt = res.PaymentDueAt.Format(time.RFC3339)
+	}
+	if res.Cancelled() {
+		out.CancelledAt = res.CancelledAt.Format(time.RFC3339)
+		out.RefundAmount = res.RefundAmount
+	}
+	return out
+}
+
+//writeAPI writes an API response with status code
+func writeAPI(w http.ResponseWriter, status int, resp apiResponse) {
+	out, _ := json.MarshalIndent(resp, "", "     ")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+//apiError writes an API error response
+func apiError(w http.ResponseWriter, status int, message string) {
+	writeAPI(w, status, apiResponse{Message: message})
+}
+
+//apiReservationFromURL gets the reservation in the URL, writes error response and returns false if there is none
+func (m *Repository) apiReservationFromURL(w http.ResponseWriter, r *http.Request) (models.Reservation, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "invalid reservation id")
+		return models.Reservation{}, false
+	}
+	res, err := m.DB.GetReservationById(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		apiError(w, http.StatusNotFound, "reservation not found")
+		return res, false
+	}
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		apiError(w, http.StatusInternalServerError, "Error querying database")
+		return res, false
+	}
+	return res, true
+}
+
+//APIRooms lists rooms open for booking
+func (m *Repository) APIRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		apiError(w, http.StatusInternalServerError, "Error querying database")
+		return
+	}
+
+	resp := apiResponse{OK: true, Rooms: []apiRoom{}}
+	for _, x := range rooms {
+		if !x.Active {
+			continue
+		}
+		resp.Rooms = append(resp.Rooms, apiRoom{
+			ID:           x.ID,
+			RoomName:     x.RoomName,
+			Description:  x.Description,
+			MaxOccupancy: x.MaxOccupancy,
+		})
+	}
+	writeAPI(w, http.StatusOK, resp)
+}
+
+//APIAvailability lists rooms free for start and end dates and guests, with the total price of the stay
+func (m *Repository) APIAvailability(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	startDate, err := time.Parse(apiDateLayout, q.Get("start"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "invalid start date")
+		return
+	}
+	endDate, err := time.Parse(apiDateLayout, q.Get("end"))
+	if err != nil || !endDate.After(startDate) {
+		apiError(w, http.StatusBadRequest, "invalid end date")
+		return
+	}
+	adults, children, err := parseGuests(q.Get("adults"), q.Get("children"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "invalid number of guests")
+		return
+	}
+
+	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate, adults+children)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		apiError(w, http.StatusInternalServerError, "Error querying database")
+		return
+	}
+
+	resp := apiResponse{OK: true, Rooms: []apiRoom{}}
+	for _, x := range rooms {
+		reasons, err := m.stayRuleReasons(x.ID, startDate, endDate)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			apiError(w, http.StatusInternalServerError, "Error querying database")
+			return
+		}
+		if len(reasons) > 0 {
+			continue
+		}
+		total, err := m.stayTotal(x.ID, startDate, endDate)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			apiError(w, http.StatusInternalServerError, "cannot get room pricing")
+			return
+		}
+		resp.Rooms = append(resp.Rooms, apiRoom{
+			ID:           x.ID,
+			RoomName:     x.RoomName,
+			MaxOccupancy: x.MaxOccupancy,
+			TotalPrice:   total,
+		})
+	}
+	writeAPI(w, http.StatusOK, resp)
+}
+
+//APICreateReservation books a room from a JSON reservation
+func (m *Repository) APICreateReservation(w http.ResponseWriter, r *http.Request) {
+	var in apiReservation
+	err := json.NewDecoder(r.Body).Decode(&in)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "cannot parse JSON")
+		return
+	}
+
+	form := forms.New(url.Values{
+		"first_name": {in.FirstName},
+		"last_name":  {in.LastName},
+		"email":      {in.Email},
+	})
+	form.Required("first_name", "last_name", "email")
+	form.ValidEmail("email")
+
+	startDate, err := time.Parse(apiDateLayout, in.StartDate)
+	if err != nil {
+		form.Errors.Add("start_date", "Invalid date")
+	}
+	endDate, err := time.Parse(apiDateLayout, in.EndDate)
+	if err != nil || !endDate.After(startDate) {
+		form.Errors.Add("end_date", "Invalid date")
+	}
+	if in.Adults == 0 && in.Children == 0 {
+		in.Adults = 1
+	}
+	if in.Adults < 1 || in.Children < 0 {
+		form.Errors.Add("adults", "At least one adult is required")
+	}
+	if !form.Valid() {
+		writeAPI(w, http.StatusUnprocessableEntity, apiResponse{Message: "invalid reservation", Errors: form.Errors})
+		return
+	}
+
+	room, err := m.DB.GetRoomNameById(in.RoomID)
+	if err != nil {
+		apiError(w, http.StatusNotFound, "room not found")
+		return
+	}
+	if !room.Active {
+		apiError(w, http.StatusUnprocessableEntity, "Room cannot be booked at the moment")
+		return
+	}
+	if in.Adults+in.Children > room.MaxOccupancy {
+		apiError(w, http.StatusUnprocessableEntity, "Too many guests for this room")
+		return
+	}
+	reasons, err := m.stayRuleReasons(room.ID, startDate, endDate)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		apiError(w, http.StatusInternalServerError, "Error querying database")
+		return
+	}
+	if len(reasons) > 0 {
+		apiError(w, http.StatusUnprocessableEntity, joinReasons(reasons))
+		return
+	}
+
+	res := models.Reservation{
+		FirstName: in.FirstName,
+		LastName:  in.LastName,
+		Email:     in.Email,
+		Phone:     in.Phone,
+		StartDate: startDate,
+		EndDate:   endDate,
+		RoomId:    room.ID,
+		Adults:    in.Adults,
+		Children:  in.Children,
+		Status:    models.StatusPending,
+		Room:      room,
+	}
+	res.TotalPrice, err = m.stayTotal(room.ID, startDate, endDate)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		apiError(w, http.StatusInternalServerError, "cannot get room pricing")
+		return
+	}
+	// an unpaid deposit gives the dates back to others when the time to pay runs out
+	deposit := m.depositFor(res)
+	if deposit > 0 {
+		res.PaymentDueAt = time.Now().Add(m.App.DepositTimeout)
+	}
+
+	res.ID, err = m.DB.InsertReservationWithRestriction(res, 0)
+	if errors.Is(err, repository.ErrRoomNotAvailable) {
+		apiError(w, http.StatusConflict, "Room is not available for these dates")
+		return
+	}
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		apiError(w, http.StatusInternalServerError, "cannot insert reservation to DB")
+		return
+	}
+
+	out := toAPIReservation(res)
+	// with a deposit the reservation is confirmed, and the guest emailed, when the deposit is paid
+	if deposit > 0 {
+		out.Deposit = deposit
+	} else {
+		m.sendReservationEmails(res)
+	}
+	writeAPI(w, http.StatusCreated, apiResponse{OK: true, Reservation: out})
+}
+
+//APIGetReservation returns one reservation
+func (m *Repository) APIGetReservation(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.apiReservationFromURL(w, r)
+	if !ok {
+		return
+	}
+	writeAPI(w, http.StatusOK, apiResponse{OK: true, Reservation: toAPIReservation(res)})
+}
+
+//APIUpdateReservation updates guest details of a reservation
+func (m *Repository) APIUpdateReservation(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.apiReservationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var in apiReservation
+	err := json.NewDecoder(r.Body).Decode(&in)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "cannot parse JSON")
+		return
+	}
+
+	form := forms.New(url.Values{
+		"first_name": {in.FirstName},
+		"last_name":  {in.LastName},
+		"email":      {in.Email},
+	})
+	form.Required("first_name", "last_name", "email")
+	form.ValidEmail("email")
+	if !form.Valid() {
+		writeAPI(w, http.StatusUnprocessableEntity, apiResponse{Message: "invalid reservation", Errors: form.Errors})
+		return
+	}
+
+	if !lifecycle.Open(res.Status) {
+		apiError(w, http.StatusConflict, "reservation is "+res.Status)
+		return
+	}
+
+	res.FirstName = in.FirstName
+	res.LastName = in.LastName
+	res.Email = in.Email
+	res.Phone = in.Phone
+
+	err = m.DB.UpdateReservation(res)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		apiError(w, http.StatusInternalServerError, "cannot update reservation")
+		return
+	}
+	writeAPI(w, http.StatusOK, apiResponse{OK: true, Reservation: toAPIReservation(res)})
+}
+
+//APICancelReservation cancels a reservation by its cancellation policy and frees its dates
+func (m *Repository) APICancelReservation(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.apiReservationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	refund, err := m.cancelReservation(res)
+	if errors.Is(err, repository.ErrAlreadyCancelled) || errors.Is(err, lifecycle.ErrTransition) {
+		apiError(w, http.StatusConflict, "reservation is "+res.Status)
+		return
+	}
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		apiError(w, http.StatusInternalServerError, "cannot cancel reservation")
+		return
+	}
+
+	res.Status = models.StatusCancelled
+	res.CancelledAt = time.Now()
+	res.RefundAmount = refund
+	writeAPI(w, http.StatusOK, apiResponse{OK: true, Message: "Reservation cancelled", Reservation: toAPIReservation(res)})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/helpers"
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/render"
+)
+
+//auditEntities lists the kinds of entities admin actions are recorded for
+var auditEntities = []string{"reservation", "room", "room_rule", "ical_import", "api_token", "cancellation_policy", "rate_plan", "invoice", "promo_code", "voucher", "extra", "room_status"}
+
+//audit records an admin action on an entity with its state before and after the action, nil when there is none.
+//Failing to record is logged but does not stop the action
+func (m *Repository) audit(r *http.Request, action, entity string, entityID int, before, after interface{}) {
+	e := models.AuditEntry{
+		UserID:   m.App.Session.GetInt(r.Context(), "user_id"),
+		Action:   action,
+		Entity:   entity,
+		EntityID: entityID,
+	}
+	if before != nil {
+		out, err := json.Marshal(before)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+		e.Before = string(out)
+	}
+	if after != nil {
+		out, err := json.Marshal(after)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+		e.After = string(out)
+	}
+
+	err := m.DB.InsertAuditEntry(e)
+	if err != nil {
+		m.App.ErrorLog.Println("cannot record admin action:", err)
+	}
+}
+
+//AdminAudit lists recorded admin actions, filtered by user, action, entity and dates in the query
+func (m *Repository) AdminAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	layout := "2006-01-02"
+
+	var f models.AuditFilter
+	f.UserID, _ = strconv.Atoi(q.Get("user_id"))
+	f.EntityID, _ = strconv.Atoi(q.Get("entity_id"))
+	f.Action = q.Get("action")
+	f.Entity = q.Get("entity")
+	if from, err := time.Parse(layout, q.Get("from")); err == nil {
+		f.From = from
+	}
+	// the to date is included
+	if to, err := time.Parse(layout, q.Get("to")); err == nil {
+		f.To = to.AddDate(0, 0, 1)
+	}
+
+	entries, err := m.DB.AuditEntries(f)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	for _, key := range []string{"user_id", "action", "entity", "entity_id", "from", "to"} {
+		stringMap[key] = q.Get(key)
+	}
+
+	data := make(map[string]interface{})
+	data["entries"] = entries
+	data["entities"] = auditEntities
+	render.Template(w, "adminaudit.page.tmpl.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	}, r)
+}
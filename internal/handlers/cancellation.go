@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/t-Ikonen/bbbookingsystem/internal/cancellation"
+	"github.com/t-Ikonen/bbbookingsystem/internal/forms"
+	"github.com/t-Ikonen/bbbookingsystem/internal/helpers"
+	"github.com/t-Ikonen/bbbookingsystem/internal/lifecycle"
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/render"
+	"github.com/t-Ikonen/bbbookingsystem/internal/repository"
+)
+
+//refundFor returns the amount refunded if the reservation is cancelled now
+func (m *Repository) refundFor(res models.Reservation) (float32, error) {
+	policy, err := m.DB.GetCancellationPolicyForRoom(res.RoomId)
+	if err != nil {
+		return 0, err
+	}
+	return cancellation.Refund(policy, res.TotalPrice, res.StartDate, time.Now()), nil
+}
+
+//cancelReservation cancels a reservation by its room's cancellation policy, frees its dates and emails the guest the outcome.
+//Returns the refunded amount, repository.ErrAlreadyCancelled if the reservation was cancelled before
+//and lifecycle.ErrTransition if it cannot be cancelled any more
+func (m *Repository) cancelReservation(res models.Reservation) (float32, error) {
+	if res.Cancelled() {
+		return 0, repository.ErrAlreadyCancelled
+	}
+	err := lifecycle.Check(res.Status, models.StatusCancelled)
+	if err != nil {
+		return 0, err
+	}
+
+	refund, err := m.refundFor(res)
+	if err != nil {
+		return 0, err
+	}
+	err = m.DB.CancelReservation(res.ID, refund)
+	if err != nil {
+		return 0, err
+	}
+
+	// the reservation is cancelled already, a failed refund is left for the owner to redo by hand
+	returned, toVoucher, err := m.refundPayments(res, refund)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+
+	refundText := "This reservation is not refundable at the time of cancellation."
+	if refund > 0 {
+		refundText = fmt.Sprintf("You will be refunded %s of the total price %s.", render.Price(refund), render.Price(res.TotalPrice))
+	}
+	if returned > 0 {
+		refundText += fmt.Sprintf("<br>%s of your payments is returned to your card.", render.Price(returned))
+	}
+	if toVoucher > 0 {
+		refundText += fmt.Sprintf("<br>%s is returned to the balance of your gift voucher.", render.Price(toVoucher))
+	}
+	message := fmt.Sprintf(`
+		<strong>Reservation cancelled</strong><br><br>
+		Dear %s %s, <br><hr>
+		Your reservation for %s from %s to %s is cancelled.<br>
+		%s
+		`, res.FirstName, res.LastName, res.Room.RoomName, res.StartDate.Format("02-01-2006"), res.EndDate.Format("02-01-2006"), refundText)
+
+	m.App.MailChan <- models.MailData{
+		To:       res.Email,
+		From:     "ed.glen@blacklodge.xyz",
+		Subject:  "Reservation cancelled",
+		Message:  message,
+		Template: "basic.html",
+	}
+
+	go m.notifyWaitlist()
+	return refund, nil
+}
+
+//AdminCancelReservation cancels a reservation in admin mode, the refund follows the room's cancellation policy
+func (m *Repository) AdminCancelReservation(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	src := chi.URLParam(r, "src")
+
+	res, err := m.DB.GetReservationById(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	refund, err := m.cancelReservation(res)
+	if errors.Is(err, repository.ErrAlreadyCancelled) || errors.Is(err, lifecycle.ErrTransition) {
+		m.App.Session.Put(r.Context(), "error", "Cannot cancel reservation: "+err.Error())
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	after := res
+	after.Status = models.StatusCancelled
+	after.CancelledAt = time.Now()
+	after.RefundAmount = refund
+	m.audit(r, "cancel", "reservation", res.ID, res, after)
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Reservation cancelled, refund %s", render.Price(refund)))
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+}
+
+//AdminCancellationPolicies lists cancellation policies and shows form for a new policy in admin tool
+func (m *Repository) AdminCancellationPolicies(w http.ResponseWriter, r *http.Request) {
+	m.renderCancellationPolicies(w, r, forms.New(nil))
+}
+
+//renderCancellationPolicies renders the cancellation policies page with given form
+func (m *Repository) renderCancellationPolicies(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	policies, err := m.DB.AllCancellationPolicies()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	prices, err := m.DB.AllPricing()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	data := make(map[string]interface{})
+	data["policies"] = policies
+	data["pricing"] = prices
+	render.Template(w, "admincancellationpolicies.page.tmpl.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	}, r)
+}
+
+//AdminPostCancellationPolicy saves a new cancellation policy in admin tool, tier rows left empty are skipped
+func (m *Repository) AdminPostCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name")
+
+	policy := models.CancellationPolicy{Name: r.Form.Get("name")}
+	days := r.PostForm["days_before"]
+	percents := r.PostForm["refund_percent"]
+	seen := make(map[int]bool)
+	for i := range days {
+		if i >= len(percents) {
+			break
+		}
+		if strings.TrimSpace(days[i]) == "" && strings.TrimSpace(percents[i]) == "" {
+			continue
+		}
+		d, err := strconv.Atoi(strings.TrimSpace(days[i]))
+		if err != nil || d < 0 {
+			form.Errors.Add("tiers", "Days before arrival must be zero or more")
+			continue
+		}
+		p, err := strconv.Atoi(strings.TrimSpace(percents[i]))
+		if err != nil || p < 0 || p > 100 {
+			form.Errors.Add("tiers", "Refund must be between 0 and 100 percent")
+			continue
+		}
+		if seen[d] {
+			form.Errors.Add("tiers", "Each tier must have different days before arrival")
+			continue
+		}
+		seen[d] = true
+		policy.Tiers = append(policy.Tiers, models.CancellationTier{DaysBefore: d, RefundPercent: p})
+	}
+	if len(policy.Tiers) == 0 && form.Errors.Get("tiers") == "" {
+		form.Errors.Add("tiers", "Add at least one refund tier")
+	}
+
+	if !form.Valid() {
+		m.renderCancellationPolicies(w, r, form)
+		return
+	}
+
+	policy.ID, err = m.DB.InsertCancellationPolicy(policy)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.audit(r, "create", "cancellation_policy", policy.ID, nil, policy)
+
+	m.App.Session.Put(r.Context(), "flash", "Cancellation policy saved.")
+	http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+}
+
+//AdminPostRatePlanPolicy sets cancellation policy of a rate plan in admin tool
+func (m *Repository) AdminPostRatePlanPolicy(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	pricingID, _ := strconv.Atoi(r.Form.Get("pricing_id"))
+	policyID, _ := strconv.Atoi(r.Form.Get("policy_id"))
+	err = m.DB.UpdatePricingCancellationPolicy(pricingID, policyID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.audit(r, "set_policy", "rate_plan", pricingID, nil, map[string]int{"cancellation_policy_id": policyID})
+
+	m.App.Session.Put(r.Context(), "flash", "Rate plan saved.")
+	http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+}
+
+//AdminDeleteCancellationPolicy deletes a cancellation policy in admin tool
+func (m *Repository) AdminDeleteCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	if err := m.DB.DeleteCancellationPolicy(id); err == nil {
+		m.audit(r, "delete", "cancellation_policy", id, nil, nil)
+	}
+	m.App.Session.Put(r.Context(), "flash", "Cancellation policy deleted.")
+	http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+}
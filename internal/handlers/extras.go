@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/t-Ikonen/bbbookingsystem/internal/extras"
+	"github.com/t-Ikonen/bbbookingsystem/internal/forms"
+	"github.com/t-Ikonen/bbbookingsystem/internal/helpers"
+	"github.com/t-Ikonen/bbbookingsystem/internal/invoice"
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/pricing"
+	"github.com/t-Ikonen/bbbookingsystem/internal/render"
+)
+
+//applyExtras books the extras with ids available for the room of reservation res and adds their price to its total.
+//Returns the extras available for the room
+func (m *Repository) applyExtras(res *models.Reservation, ids []string) ([]models.Extra, error) {
+	available, err := m.DB.ExtrasForRoom(res.RoomId)
+	if err != nil {
+		return nil, err
+	}
+
+	var chosen []int
+	for _, x := range ids {
+		id, err := strconv.Atoi(x)
+		if err == nil {
+			chosen = append(chosen, id)
+		}
+	}
+	res.Extras = extras.Choose(available, chosen, pricing.Nights(res.StartDate, res.EndDate), res.Guests())
+	res.TotalPrice += res.ExtrasTotal()
+	return available, nil
+}
+
+//chosenExtras returns the ids of extras booked with reservation res
+func chosenExtras(res models.Reservation) map[int]bool {
+	chosen := make(map[int]bool)
+	for _, x := range res.Extras {
+		chosen[x.ExtraID] = true
+	}
+	return chosen
+}
+
+//extrasText returns the extras booked with reservation res as lines of an email
+func extrasText(res models.Reservation) string {
+	text := ""
+	for _, x := range res.Extras {
+		text += fmt.Sprintf("%s, %d %s x %s: %s<br>", x.Name, x.Quantity, extras.Label(x.Unit), render.Price(x.UnitPrice), render.Price(x.Total))
+	}
+	return text
+}
+
+//AdminExtras lists the extras catalogue and shows form for a new extra in admin tool
+func (m *Repository) AdminExtras(w http.ResponseWriter, r *http.Request) {
+	form := forms.New(url.Values{})
+	form.Set("unit", models.ExtraPerStay)
+	form.Set("vat_rate", fmt.Sprint(invoice.VATGeneral))
+	m.renderExtras(w, r, models.Extra{}, form)
+}
+
+//AdminShowExtra lists the extras catalogue and shows form for editing extra of the URL in admin tool
+func (m *Repository) AdminShowExtra(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	e, err := m.DB.GetExtraById(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(url.Values{})
+	form.Set("name", e.Name)
+	form.Set("description", e.Description)
+	form.Set("price", fmt.Sprintf("%.2f", e.Price))
+	form.Set("unit", e.Unit)
+	form.Set("vat_rate", fmt.Sprint(e.VATRate))
+	for _, roomID := range e.RoomIDs {
+		form.Add("room_ids", strconv.Itoa(roomID))
+	}
+	m.renderExtras(w, r, e, form)
+}
+
+//renderExtras renders the extras page of admin tool with form for editing extra e, or a new extra when e has no ID
+func (m *Repository) renderExtras(w http.ResponseWriter, r *http.Request, e models.Extra, form *forms.Form) {
+	all, err := m.DB.AllExtras()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	roomNames := make(map[int]string)
+	for _, x := range rooms {
+		roomNames[x.ID] = x.RoomName
+	}
+	chosenRooms := make(map[int]bool)
+	for _, x := range form.Values["room_ids"] {
+		roomID, _ := strconv.Atoi(x)
+		chosenRooms[roomID] = true
+	}
+
+	data := make(map[string]interface{})
+	data["extras"] = all
+	data["extra"] = e
+	data["rooms"] = rooms
+	data["room_names"] = roomNames
+	data["chosen_rooms"] = chosenRooms
+	data["units"] = extras.Units
+	data["vat_rates"] = []float32{invoice.VATAccommodation, invoice.VATFood, invoice.VATGeneral}
+	render.Template(w, "adminextras.page.tmpl.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	}, r)
+}
+
+//AdminPostExtra saves a new extra, or changes to the extra of the URL, in admin tool
+func (m *Repository) AdminPostExtra(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var old models.Extra
+	if chi.URLParam(r, "id") != "" {
+		id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+		old, err = m.DB.GetExtraById(id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "price", "unit", "vat_rate")
+
+	e := models.Extra{
+		ID:          old.ID,
+		Name:        r.Form.Get("name"),
+		Description: r.Form.Get("description"),
+		Unit:        r.Form.Get("unit"),
+	}
+	if !extras.ValidUnit(e.Unit) {
+		form.Errors.Add("unit", "Choose a unit")
+	}
+	price, err := strconv.ParseFloat(r.Form.Get("price"), 32)
+	e.Price = float32(price)
+	if err != nil || e.Price < 0 {
+		form.Errors.Add("price", "Price must be zero or more")
+	}
+	rate, err := strconv.ParseFloat(r.Form.Get("vat_rate"), 32)
+	e.VATRate = float32(rate)
+	if err != nil || e.VATRate < 0 {
+		form.Errors.Add("vat_rate", "Invalid VAT rate")
+	}
+	for _, x := range r.PostForm["room_ids"] {
+		roomID, err := strconv.Atoi(x)
+		if err == nil {
+			e.RoomIDs = append(e.RoomIDs, roomID)
+		}
+	}
+
+	if !form.Valid() {
+		m.renderExtras(w, r, old, form)
+		return
+	}
+
+	if e.ID == 0 {
+		e.ID, err = m.DB.InsertExtra(e)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		m.audit(r, "create", "extra", e.ID, nil, e)
+	} else {
+		err = m.DB.UpdateExtra(e)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		m.audit(r, "update", "extra", e.ID, old, e)
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Extra "+e.Name+" saved.")
+	http.Redirect(w, r, "/admin/extras", http.StatusSeeOther)
+}
+
+//AdminDeleteExtra deletes an extra from the catalogue in admin tool, reservations keep the extras booked
+func (m *Repository) AdminDeleteExtra(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	if err := m.DB.DeleteExtra(id); err != nil {
+		m.App.Session.Put(r.Context(), "error", "Cannot delete extra: "+err.Error())
+		http.Redirect(w, r, "/admin/extras", http.StatusSeeOther)
+		return
+	}
+	m.audit(r, "delete", "extra", id, nil, nil)
+	m.App.Session.Put(r.Context(), "flash", "Extra deleted.")
+	http.Redirect(w, r, "/admin/extras", http.StatusSeeOther)
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/t-Ikonen/bbbookingsystem/internal/forms"
+	"github.com/t-Ikonen/bbbookingsystem/internal/lifecycle"
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/render"
+	"github.com/t-Ikonen/bbbookingsystem/internal/repository"
+	"github.com/t-Ikonen/bbbookingsystem/internal/signedlink"
+)
+
+//guestLinkDays is how many days after departure a guest link keeps working
+const guestLinkDays = 30
+
+//guestLink returns the signed link to a reservation's self-service page
+func (m *Repository) guestLink(res models.Reservation) string {
+	expires := res.EndDate.AddDate(0, 0, guestLinkDays)
+	return m.App.BaseURL + "/my-booking/" + signedlink.Sign(m.App.SigningKey, res.ID, expires)
+}
+
+//guestReservation returns the reservation of the signed link in the URL, redirects home and returns false if the link is not valid
+func (m *Repository) guestReservation(w http.ResponseWriter, r *http.Request) (models.Reservation, bool) {
+	id, err := signedlink.Verify(m.App.SigningKey, chi.URLParam(r, "token"), time.Now())
+	if errors.Is(err, signedlink.ErrExpired) {
+		m.App.Session.Put(r.Context(), "error", "This booking link has expired, please contact us.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return models.Reservation{}, false
+	}
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid booking link")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return models.Reservation{}, false
+	}
+
+	res, err := m.DB.GetReservationById(id)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Cannot find the booking")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return res, false
+	}
+	return res, true
+}
+
+//renderGuestBooking renders the guest's booking page with given form
+func (m *Repository) renderGuestBooking(w http.ResponseWriter, r *http.Request, res models.Reservation, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["reservation"] = res
+
+	stringMap := make(map[string]string)
+	stringMap["token"] = chi.URLParam(r, "token")
+	stringMap["start_date"] = res.StartDate.Format("02-01-2006")
+	stringMap["end_date"] = res.EndDate.Format("02-01-2006")
+	if lifecycle.Open(res.Status) {
+		refund, err := m.refundFor(res)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Cannot find the booking")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		stringMap["refund"] = render.Price(refund)
+	}
+
+	render.Template(w, "guestbooking.page.tmpl.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		Form:      form,
+	}, r)
+}
+
+//GuestBooking shows a reservation to the guest through a signed link
+func (m *Repository) GuestBooking(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.guestReservation(w, r)
+	if !ok {
+		return
+	}
+	m.renderGuestBooking(w, r, res, forms.New(nil))
+}
+
+//PostGuestBooking updates the guest's email and phone through a signed link
+func (m *Repository) PostGuestBooking(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.guestReservation(w, r)
+	if !ok {
+		return
+	}
+	if !lifecycle.Open(res.Status) {
+		m.App.Session.Put(r.Context(), "error", "This booking can no longer be changed")
+		http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot parse form")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("email")
+	form.ValidEmail("email")
+	if !form.Valid() {
+		m.renderGuestBooking(w, r, res, form)
+		return
+	}
+
+	res.Email = r.Form.Get("email")
+	res.Phone = r.Form.Get("phone")
+	err = m.DB.UpdateReservation(res)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot update booking")
+		http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Your details are updated.")
+	http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+}
+
+//PostGuestCancel cancels the guest's booking by the cancellation policy and lets the owner know
+func (m *Repository) PostGuestCancel(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.guestReservation(w, r)
+	if !ok {
+		return
+	}
+	bookingURL := "/my-booking/" + chi.URLParam(r, "token")
+
+	refund, err := m.cancelReservation(res)
+	if errors.Is(err, repository.ErrAlreadyCancelled) {
+		m.App.Session.Put(r.Context(), "error", "This booking is already cancelled")
+		http.Redirect(w, r, bookingURL, http.StatusSeeOther)
+		return
+	}
+	if errors.Is(err, lifecycle.ErrTransition) {
+		m.App.Session.Put(r.Context(), "error", "This booking can no longer be cancelled")
+		http.Redirect(w, r, bookingURL, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Cannot cancel the booking, please contact us.")
+		http.Redirect(w, r, bookingURL, http.StatusSeeOther)
+		return
+	}
+
+	ownerMessage := fmt.Sprintf(`
+	<strong>Reservation cancelled by guest</strong><br>
+	The guest cancelled reservation %d <br><hr><br><br>
+	Name: %s %s<br>
+	Room: %s<br>
+	Start date: %s<br>
+	End date: %s<br>
+	Refund: %s<br>
+	`, res.ID, res.FirstName, res.LastName, res.Room.RoomName, res.StartDate.Format("02-01-2006"), res.EndDate.Format("02-01-2006"), render.Price(refund))
+
+	m.App.MailChan <- models.MailData{
+		To:      "ed.glen@blacklodge.xyz",
+		From:    "ed.glen@blacklodge.xyz",
+		Subject: "Reservation cancelled",
+		Message: ownerMessage,
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Your booking is cancelled, refund %s. A confirmation is sent by email.", render.Price(refund)))
+	http.Redirect(w, r, bookingURL, http.StatusSeeOther)
+}
@@ -12,14 +12,20 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/t-Ikonen/bbbookingsystem/internal/apitoken"
 	"github.com/t-Ikonen/bbbookingsystem/internal/config"
 	"github.com/t-Ikonen/bbbookingsystem/internal/driver"
+	"github.com/t-Ikonen/bbbookingsystem/internal/extras"
 	"github.com/t-Ikonen/bbbookingsystem/internal/forms"
 	"github.com/t-Ikonen/bbbookingsystem/internal/helpers"
+	"github.com/t-Ikonen/bbbookingsystem/internal/lifecycle"
 	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/payments"
+	"github.com/t-Ikonen/bbbookingsystem/internal/pricing"
 	"github.com/t-Ikonen/bbbookingsystem/internal/render"
 	"github.com/t-Ikonen/bbbookingsystem/internal/repository"
 	"github.com/t-Ikonen/bbbookingsystem/internal/repository/dbrepo"
+	"github.com/t-Ikonen/bbbookingsystem/internal/rules"
 )
 
 // Repo used by handlers
@@ -64,7 +70,18 @@ func (m *Repository) About(w http.ResponseWriter, r *http.Request) {
 
 //Booking to render Booking page
 func (m *Repository) Booking(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, "booking.page.tmpl.html", &models.TemplateData{}, r)
+	data := make(map[string]interface{})
+	// offer the waitlist after a search without availability
+	if entry, ok := m.App.Session.Pop(r.Context(), "waitlist").(models.WaitlistEntry); ok {
+		data["waitlist"] = entry
+	}
+	if alternatives, ok := m.App.Session.Pop(r.Context(), "alternatives").([]models.AlternativeStay); ok {
+		data["alternatives"] = alternatives
+	}
+	render.Template(w, "booking.page.tmpl.html", &models.TemplateData{
+		Form: forms.New(nil),
+		Data: data,
+	}, r)
 }
 
 //PostBooking to post Booking page data
@@ -94,30 +111,82 @@ func (m *Repository) PostBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
+	adults, children, err := parseGuests(r.Form.Get("adults"), r.Form.Get("children"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "invalid number of guests")
+		http.Redirect(w, r, "/booking", http.StatusSeeOther)
+		return
+	}
+
+	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate, adults+children)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "cannot parse end date")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
+	// drop rooms whose stay rules do not allow these dates
+	var allowed []models.Room
+	var reasons []string
 	for _, i := range rooms {
+		broken, err := m.stayRuleReasons(i.ID, startDate, endDate)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "cannot check stay rules")
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
+		}
+		if len(broken) > 0 {
+			reasons = append(reasons, broken...)
+			continue
+		}
 		m.App.InfoLog.Println("ROOM:", i.ID, i.RoomName)
+		allowed = append(allowed, i)
 	}
+	rooms = allowed
 
 	if len(rooms) == 0 {
 		m.App.InfoLog.Println("No rooms")
-		m.App.Session.Put(r.Context(), "error", "No availability")
+		if len(reasons) > 0 {
+			m.App.Session.Put(r.Context(), "error", "No availability. "+joinReasons(reasons))
+		} else {
+			m.App.Session.Put(r.Context(), "error", "No availability")
+		}
+		m.App.Session.Put(r.Context(), "waitlist", models.WaitlistEntry{
+			StartDate: startDate,
+			EndDate:   endDate,
+			Adults:    adults,
+			Children:  children,
+		})
+		alternatives, err := m.alternativeStays(startDate, endDate, adults+children)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		} else if len(alternatives) > 0 {
+			m.App.Session.Put(r.Context(), "alternatives", alternatives)
+		}
 		http.Redirect(w, r, "/booking", http.StatusSeeOther)
 		return
 	}
 
+	totals := make(map[int]float32)
+	for _, room := range rooms {
+		total, err := m.stayTotal(room.ID, startDate, endDate)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "cannot get room pricing")
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
+		}
+		totals[room.ID] = total
+	}
+
 	data := make(map[string]interface{})
 	data["rooms"] = rooms
+	data["totals"] = totals
 
 	res := models.Reservation{
 		StartDate: startDate,
 		EndDate:   endDate,
+		Adults:    adults,
+		Children:  children,
 	}
 
 	m.App.Session.Put(r.Context(), "reservation", res)
@@ -130,12 +199,120 @@ func (m *Repository) PostBooking(w http.ResponseWriter, r *http.Request) {
 
 }
 
+//parseGuests parses adults and children from form values, defaults to one adult
+func parseGuests(a, c string) (int, int, error) {
+	adults, children := 1, 0
+	var err error
+	if a != "" {
+		adults, err = strconv.Atoi(a)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if c != "" {
+		children, err = strconv.Atoi(c)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if adults < 1 || children < 0 {
+		return 0, 0, errors.New("at least one adult is required")
+	}
+	return adults, children, nil
+}
+
+//holdRoom releases the guest's previous hold and holds the reservation room until checkout is done
+func (m *Repository) holdRoom(r *http.Request, res models.Reservation) error {
+	if oldHold := m.App.Session.GetInt(r.Context(), "hold_id"); oldHold > 0 {
+		err := m.DB.DeleteHold(oldHold)
+		if err != nil {
+			return err
+		}
+		m.App.Session.Remove(r.Context(), "hold_id")
+	}
+
+	holdID, err := m.DB.InsertHold(res.RoomId, res.StartDate, res.EndDate, time.Now().Add(m.App.HoldDuration))
+	if err != nil {
+		return err
+	}
+	m.App.Session.Put(r.Context(), "hold_id", holdID)
+	return nil
+}
+
+//stayRuleReasons returns reasons why stay rules of a room do not allow the dates
+func (m *Repository) stayRuleReasons(roomID int, start, end time.Time) ([]string, error) {
+	roomRules, err := m.DB.GetRulesForRoomByDate(roomID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return rules.Check(roomRules, start, end), nil
+}
+
+//joinReasons joins rule reasons into one message without duplicates
+func joinReasons(reasons []string) string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, x := range reasons {
+		if !seen[x] {
+			seen[x] = true
+			unique = append(unique, x)
+		}
+	}
+	return strings.Join(unique, ". ")
+}
+
+//alternativeDays is how far alternative dates are searched before and after the requested stay
+const alternativeDays = 14
+
+//alternativeStays returns the nearest earlier and later free stay of the same length for each room
+func (m *Repository) alternativeStays(start, end time.Time, guests int) ([]models.AlternativeStay, error) {
+	stays, err := m.DB.SearchAlternativeDates(start, end, guests, alternativeDays)
+	if err != nil {
+		return nil, err
+	}
+
+	// stays come nearest first per room, keep the first allowed one in each direction
+	type pick struct {
+		roomID int
+		later  bool
+	}
+	picked := make(map[pick]bool)
+	var alternatives []models.AlternativeStay
+	for _, x := range stays {
+		key := pick{x.RoomID, x.Shift > 0}
+		if picked[key] {
+			continue
+		}
+		reasons, err := m.stayRuleReasons(x.RoomID, x.StartDate, x.EndDate)
+		if err != nil {
+			return nil, err
+		}
+		if len(reasons) > 0 {
+			continue
+		}
+		picked[key] = true
+		alternatives = append(alternatives, x)
+	}
+	return alternatives, nil
+}
+
+//stayTotal returns the price of a stay in a room from start to end
+func (m *Repository) stayTotal(roomID int, start, end time.Time) (float32, error) {
+	p, err := m.DB.GetPricingForRoom(roomID)
+	if err != nil {
+		return 0, err
+	}
+	return pricing.Total(p, start, end), nil
+}
+
 type jsonResponse struct {
 	OK        bool   `json:"ok"`
-	Message   string `jsnon:"message"`
+	Message   string `json:"message"`
 	RoomId    string `json:"room_id"`
 	StartDate string `json:"start_date"`
 	EndDate   string `json:"end_date"`
+	Adults    int    `json:"adults"`
+	Children  int    `json:"children"`
 }
 
 //BookingJSON to request availability JSON format
@@ -174,18 +351,36 @@ func (m *Repository) BookingJSON(w http.ResponseWriter, r *http.Request) {
 		helpers.ServerError(w, err)
 		return
 	}
-	available, err := m.DB.SearchAvailabilityByDatesByRoomId(startDate, endDate, roomId)
+	adults, children, err := parseGuests(r.Form.Get("adults"), r.Form.Get("children"))
 	if err != nil {
-		//log.Println(err)
 		helpers.ServerError(w, err)
 		return
 	}
+
 	resp := jsonResponse{
-		OK:        available,
-		Message:   "",
 		StartDate: sd,
 		EndDate:   ed,
 		RoomId:    strconv.Itoa(roomId),
+		Adults:    adults,
+		Children:  children,
+	}
+
+	available, err := m.DB.SearchAvailabilityByDatesByRoomId(startDate, endDate, roomId)
+	if err != nil {
+		resp.Message = "Error querying database"
+	} else if available {
+		room, err := m.DB.GetRoomNameById(roomId)
+		if err != nil {
+			resp.Message = "Error querying database"
+		} else if adults+children > room.MaxOccupancy {
+			resp.Message = fmt.Sprintf("This room sleeps at most %d guests", room.MaxOccupancy)
+		} else if reasons, err := m.stayRuleReasons(roomId, startDate, endDate); err != nil {
+			resp.Message = "Error querying database"
+		} else if len(reasons) > 0 {
+			resp.Message = joinReasons(reasons)
+		} else {
+			resp.OK = true
+		}
 	}
 
 	out, err := json.MarshalIndent(resp, "", "     ")
@@ -199,6 +394,77 @@ func (m *Repository) BookingJSON(w http.ResponseWriter, r *http.Request) {
 	w.Write(out)
 }
 
+type availabilityDay struct {
+	Date   string `json:"date"`
+	Status string `json:"status"`
+}
+
+type availabilityResponse struct {
+	OK      bool              `json:"ok"`
+	Message string            `json:"message"`
+	RoomId  int               `json:"room_id"`
+	Month   string            `json:"month"`
+	Days    []availabilityDay `json:"days"`
+}
+
+//AvailabilityJSON returns the status of every day of a month for a room in JSON format, days are free, blocked or booked
+func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
+	resp := availabilityResponse{
+		Month: r.URL.Query().Get("month"),
+	}
+
+	roomID, err := strconv.Atoi(r.URL.Query().Get("room_id"))
+	firstOfMonth, monthErr := time.Parse("2006-01", resp.Month)
+	if err != nil || monthErr != nil {
+		resp.Message = "room_id and month (YYYY-MM) are required"
+		writeJSON(w, resp)
+		return
+	}
+	resp.RoomId = roomID
+	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+
+	restrictions, err := m.DB.GetRestrictionsForRoomByDate(roomID, firstOfMonth, lastOfMonth)
+	if err != nil {
+		resp.Message = "Error querying database"
+		writeJSON(w, resp)
+		return
+	}
+
+	// restrictions cover nights from start date up to, not including, end date
+	status := make(map[string]string)
+	for _, x := range restrictions {
+		s := "booked"
+		if x.RestrictionId == models.RestrictionOwnerBlock {
+			s = "blocked"
+		}
+		for d := x.StartDate; d.Before(x.EndDate); d = d.AddDate(0, 0, 1) {
+			status[d.Format("2006-01-02")] = s
+		}
+	}
+
+	for d := firstOfMonth; !d.After(lastOfMonth); d = d.AddDate(0, 0, 1) {
+		day := availabilityDay{Date: d.Format("2006-01-02"), Status: "free"}
+		if s, ok := status[day.Date]; ok {
+			day.Status = s
+		}
+		resp.Days = append(resp.Days, day)
+	}
+
+	resp.OK = true
+	writeJSON(w, resp)
+}
+
+//writeJSON writes v as indented JSON
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	out, err := json.MarshalIndent(v, "", "     ")
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
 //Reservation to render Reservation page
 func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 
@@ -217,6 +483,20 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 	}
 	res.Room.RoomName = room.RoomName
 
+	res.TotalPrice, err = m.stayTotal(res.RoomId, res.StartDate, res.EndDate)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot get room pricing")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	available, err := m.DB.ExtrasForRoom(res.RoomId)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot get extras")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
 	m.App.Session.Put(r.Context(), "reservation", res)
 
 	//log.Println("room name: ", res.Room.RoomName)
@@ -230,6 +510,8 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 
 	data := make(map[string]interface{})
 	data["reservation"] = res
+	data["extras"] = available
+	data["chosen_extras"] = chosenExtras(res)
 	render.Template(w, "reservation.page.tmpl.html", &models.TemplateData{
 		Form:      forms.New(nil),
 		Data:      data,
@@ -266,9 +548,28 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	form.MinLenght("first_name", 3)
 	form.ValidEmail("email")
 
+	err = m.applyPromoCode(&reservation, form)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	// the voucher pays extras too, the promo code discounts only the room
+	available, err := m.applyExtras(&reservation, r.PostForm["extras"])
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	err = m.applyVoucher(&reservation, form)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	if !form.Valid() {
 		data := make(map[string]interface{})
 		data["reservation"] = reservation
+		data["extras"] = available
+		data["chosen_extras"] = chosenExtras(reservation)
 
 		render.Template(w, "reservation.page.tmpl.html", &models.TemplateData{
 			Form: form,
@@ -277,37 +578,76 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newReservationId, err := m.DB.InsertReservation(reservation)
+	// an unpaid deposit gives the dates back to others when the time to pay runs out
+	if m.depositFor(reservation) > 0 {
+		reservation.PaymentDueAt = time.Now().Add(m.App.DepositTimeout)
+	}
+
+	holdID := m.App.Session.GetInt(r.Context(), "hold_id")
+	reservation.ID, err = m.DB.InsertReservationWithRestriction(reservation, holdID)
+	if errors.Is(err, repository.ErrRoomNotAvailable) {
+		m.App.Session.Put(r.Context(), "error", "Sorry, this room was just taken for those dates. Please search again.")
+		http.Redirect(w, r, "/booking", http.StatusSeeOther)
+		return
+	}
+	if errors.Is(err, repository.ErrPromoUsedUp) {
+		m.App.Session.Put(r.Context(), "error", "Sorry, this promo code was just used up.")
+		http.Redirect(w, r, "/reservation", http.StatusSeeOther)
+		return
+	}
+	if errors.Is(err, repository.ErrVoucherSpent) {
+		m.App.Session.Put(r.Context(), "error", "Sorry, the balance of this voucher is not enough any more.")
+		http.Redirect(w, r, "/reservation", http.StatusSeeOther)
+		return
+	}
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "cannot insert reservation to DB")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
+	m.App.Session.Remove(r.Context(), "hold_id")
+
+	// with a deposit the reservation is confirmed when the deposit is paid
+	if m.depositFor(reservation) > 0 {
+		reservation.Status = models.StatusPending
+		m.App.Session.Remove(r.Context(), "payment_intent")
+		m.App.Session.Put(r.Context(), "reservation", reservation)
+		http.Redirect(w, r, "/deposit", http.StatusSeeOther)
+		return
+	}
 
-	//m.App.Session.Put(r.Context(), "reservation", reservation)
+	m.sendReservationEmails(reservation)
 
-	restriction := models.RoomRestriction{
-		StartDate:     reservation.StartDate,
-		EndDate:       reservation.EndDate,
-		RoomId:        reservation.RoomId,
-		ReservationId: newReservationId,
-		RestrictionId: 1,
-	}
+	m.App.Session.Put(r.Context(), "reservation", reservation)
+	http.Redirect(w, r, "/reservationsummary", http.StatusSeeOther)
 
-	err = m.DB.InsertRoomRestriction(restriction)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "cannot insert room restriction to DB")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-		return
-	}
+}
 
+//sendReservationEmails sends reservation confirmation to guest and notification to owner
+func (m *Repository) sendReservationEmails(reservation models.Reservation) {
 	//subject := "Reservation confirmation" + strconv.(reservation.StartDate) + "-" + reservation.EndDate
 	//send email notification - first to guest
+	discount := ""
+	if reservation.DiscountAmount > 0 {
+		discount = fmt.Sprintf("Promo code %s: -%s<br>", reservation.PromoCode, render.Price(reservation.DiscountAmount))
+	}
+	booked := ""
+	if len(reservation.Extras) > 0 {
+		booked = "Extras:<br>" + extrasText(reservation)
+	}
+	paid := ""
+	if reservation.VoucherAmount > 0 {
+		paid = fmt.Sprintf("Paid with gift voucher: %s<br>", render.Price(reservation.VoucherAmount))
+	}
 	customerMessage := fmt.Sprintf(`
 		<strong>Reservation confirmation</strong><br><br>
 		Dear %s %s, <br><hr>
-		This is to confirm your reservation for %s from %s to %s.
-		`, reservation.FirstName, reservation.LastName, reservation.Room.RoomName, reservation.StartDate.Format("02-01-2006"), reservation.EndDate.Format("02-01-2006"))
+		This is to confirm your reservation for %s from %s to %s.<br>
+		%s%sTotal price: %.2f €<br>
+		%s<br>
+		View or change your booking: <a href="%s">%s</a>
+		`, reservation.FirstName, reservation.LastName, reservation.Room.RoomName, reservation.StartDate.Format("02-01-2006"), reservation.EndDate.Format("02-01-2006"), booked, discount, reservation.TotalPrice,
+		paid, m.guestLink(reservation), m.guestLink(reservation))
 
 	customerMessage2 := fmt.Sprintln(`
 	<br><br><br>Welcome to be reborn again!<br>
@@ -333,7 +673,8 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	Room: %s<br>
 	Start date: %s<br>
 	End date: %s<br>
-	`, reservation.FirstName, reservation.LastName, reservation.Room.RoomName, reservation.StartDate.Format("02-01-2006"), reservation.EndDate.Format("02-01-2006"))
+	%s
+	`, reservation.FirstName, reservation.LastName, reservation.Room.RoomName, reservation.StartDate.Format("02-01-2006"), reservation.EndDate.Format("02-01-2006"), booked)
 
 	msg2 := models.MailData{
 		To:      reservation.Email,
@@ -342,10 +683,6 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		Message: ownerMessage,
 	}
 	m.App.MailChan <- msg2
-
-	m.App.Session.Put(r.Context(), "reservation", reservation)
-	http.Redirect(w, r, "/reservationsummary", http.StatusSeeOther)
-
 }
 
 //ChooseRoom to render Choose Room page that lists availabe room
@@ -375,6 +712,18 @@ func (m *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
 	}
 	res.RoomId = roomId
 
+	err = m.holdRoom(r, res)
+	if errors.Is(err, repository.ErrRoomNotAvailable) {
+		m.App.Session.Put(r.Context(), "error", "Sorry, this room was just taken for those dates. Please search again.")
+		http.Redirect(w, r, "/booking", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot hold room")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
 	m.App.Session.Put(r.Context(), "reservation", res)
 
 	http.Redirect(w, r, "/reservation", http.StatusSeeOther)
@@ -387,6 +736,12 @@ func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 	roomId, _ := strconv.Atoi(r.URL.Query().Get("id"))
 	sd := r.URL.Query().Get("s")
 	ed := r.URL.Query().Get("e")
+	adults, children, err := parseGuests(r.URL.Query().Get("a"), r.URL.Query().Get("c"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "invalid number of guests")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
 	//log.Println("room ID from URL:", roomId)
 	// log.Println("start from URL:", sd)
 	// log.Println("end from URL:", ed)
@@ -413,10 +768,45 @@ func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 		helpers.ServerError(w, err)
 		return
 	}
+	// links in emails can be edited, they get the same checks as searching
+	if !room.Active {
+		m.App.Session.Put(r.Context(), "error", "Sorry, this room cannot be booked at the moment. Please search again.")
+		http.Redirect(w, r, "/booking", http.StatusSeeOther)
+		return
+	}
+	if adults+children > room.MaxOccupancy {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("This room sleeps at most %d guests", room.MaxOccupancy))
+		http.Redirect(w, r, "/booking", http.StatusSeeOther)
+		return
+	}
+
+	reasons, err := m.stayRuleReasons(roomId, startDate, endDate)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if len(reasons) > 0 {
+		m.App.Session.Put(r.Context(), "error", joinReasons(reasons))
+		http.Redirect(w, r, "/booking", http.StatusSeeOther)
+		return
+	}
 	res.Room.RoomName = room.RoomName
 	res.RoomId = roomId
 	res.StartDate = startDate
 	res.EndDate = endDate
+	res.Adults = adults
+	res.Children = children
+
+	err = m.holdRoom(r, res)
+	if errors.Is(err, repository.ErrRoomNotAvailable) {
+		m.App.Session.Put(r.Context(), "error", "Sorry, this room was just taken for those dates. Please search again.")
+		http.Redirect(w, r, "/booking", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
 
 	m.App.Session.Put(r.Context(), "reservation", res)
 
@@ -461,6 +851,8 @@ func (m *Repository) Reservationsummary(w http.ResponseWriter, r *http.Request)
 	stringmap := make(map[string]string)
 	stringmap["start_date"] = sd
 	stringmap["end_date"] = ed
+	stringmap["guest_link"] = m.guestLink(reservation)
+	stringmap["deposit_paid"] = m.App.Session.PopString(r.Context(), "deposit_paid")
 
 	render.Template(w, "reservationsummary.page.tmpl.html", &models.TemplateData{
 		Data:      data,
@@ -518,41 +910,100 @@ func (m *Repository) ShowLogout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
 
-//AdminDashboard show dashboard page in admin tool
+//AdminDashboard show front desk dashboard in admin tool: arrivals and departures of today and tomorrow and guests in house
 func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, "admindashboard.page.tmpl.html", &models.TemplateData{}, r)
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	tomorrow := today.AddDate(0, 0, 1)
 
-}
+	data := make(map[string]interface{})
+	for _, day := range []struct {
+		name string
+		date time.Time
+	}{{"today", today}, {"tomorrow", tomorrow}} {
+		arrivals, err := m.DB.ArrivalsOn(day.date)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		departures, err := m.DB.DeparturesOn(day.date)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		data["arrivals_"+day.name] = arrivals
+		data["departures_"+day.name] = departures
+	}
 
-//AdminNewReservations show new unprocessed reservations in admin tool
-func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
+	inHouse, err := m.DB.InHouseReservations()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	data["in_house"] = inHouse
 
-	reservations, err := m.DB.AllNewReservations()
+	roomStatuses, err := m.DB.RoomStatuses()
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
-	data := make(map[string]interface{})
-	data["reservations"] = reservations
-	render.Template(w, "adminnewreservations.page.tmpl.html", &models.TemplateData{
-		Data: data,
+	statusByRoom := make(map[int]string)
+	for _, x := range roomStatuses {
+		statusByRoom[x.RoomID] = x.Status
+	}
+	data["room_statuses"] = roomStatuses
+	data["room_status"] = statusByRoom
+
+	stringMap := make(map[string]string)
+	stringMap["today"] = today.Format("2006-01-02")
+	stringMap["tomorrow"] = tomorrow.Format("2006-01-02")
+	stringMap["occupancy"] = fmt.Sprintf("%d / %d", len(inHouse), len(rooms))
+
+	render.Template(w, "admindashboard.page.tmpl.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
 	}, r)
+}
 
+//AdminNewReservations show new reservations in admin tool, pending ones unless other status is chosen
+func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
+	m.renderReservations(w, r, "adminnewreservations.page.tmpl.html", models.StatusPending)
 }
 
-//AdminAllReservations show all reservations in admin tool
+//AdminAllReservations show all reservations in admin tool, can be filtered by status
 func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.AllReservations()
+	m.renderReservations(w, r, "adminallreservations.page.tmpl.html", "")
+}
+
+//renderReservations renders a reservation list filtered by the status in query, defaultStatus if none is chosen
+func (m *Repository) renderReservations(w http.ResponseWriter, r *http.Request, tmpl, defaultStatus string) {
+	status := defaultStatus
+	if r.URL.Query().Has("status") {
+		status = r.URL.Query().Get("status")
+	}
+	if status != "" && !lifecycle.Valid(status) {
+		status = defaultStatus
+	}
+
+	reservations, err := m.DB.AllReservations(status)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 	data := make(map[string]interface{})
 	data["reservations"] = reservations
-	render.Template(w, "adminallreservations.page.tmpl.html", &models.TemplateData{
-		Data: data,
+	data["statuses"] = lifecycle.Statuses
+	stringMap := make(map[string]string)
+	stringMap["status"] = status
+	render.Template(w, tmpl, &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
 	}, r)
-
 }
 
 //AdminCalendar show statistics for admin only
@@ -617,15 +1068,14 @@ func (m *Repository) AdminCalendar(w http.ResponseWriter, r *http.Request) {
 		blockMap := make(map[string]int)
 
 		for d := firstOfMonth; d.After(lastOfMonth) == false; d = d.AddDate(0, 0, 1) {
-			reservationMap[d.Format("2006-2-01")] = 0
-			blockMap[d.Format("2006-2-01")] = 0
+			reservationMap[d.Format("2006-01-2")] = 0
+			blockMap[d.Format("2006-01-2")] = 0
 		}
 		restrictions, err := m.DB.GetRestrictionsForRoomByDate(x.ID, firstOfMonth, lastOfMonth)
 		if err != nil {
 			helpers.ServerError(w, err)
 			return
 		}
-		log.Println("res ", restrictions)
 
 		for _, y := range restrictions {
 			if y.ReservationId > 0 {
@@ -634,9 +1084,11 @@ func (m *Repository) AdminCalendar(w http.ResponseWriter, r *http.Request) {
 					reservationMap[d.Format("2006-01-2")] = y.ReservationId
 				}
 
-			} else {
-				//it is a owner block (reservatioID = 0)
-				blockMap[y.StartDate.Format("2006-01-2")] = y.ID
+			} else if y.RestrictionId == models.RestrictionOwnerBlock {
+				//it is a owner block (reservatioID = 0), imported blocks can span many days, holds are not shown
+				for d := y.StartDate; d.Before(y.EndDate); d = d.AddDate(0, 0, 1) {
+					blockMap[d.Format("2006-01-2")] = y.ID
+				}
 			}
 
 		}
@@ -653,64 +1105,266 @@ func (m *Repository) AdminCalendar(w http.ResponseWriter, r *http.Request) {
 	}, r)
 }
 
-//AdminShowReservation shows one reservation in admin tool for processing
-func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request) {
-	explode := strings.Split(r.RequestURI, "/")
-	id, err := strconv.Atoi(explode[4])
+//AdminPostCalendar saves owner blocks posted from the reservation calendar
+func (m *Repository) AdminPostCalendar(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
-	src := explode[3]
-	stringMap := make(map[string]string)
-	stringMap["src"] = src
 
-	//get reservaton from DB
-	res, err := m.DB.GetReservationById(id)
+	year, err := strconv.Atoi(r.Form.Get("y"))
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
-
-	data := make(map[string]interface{})
-	data["reservation"] = res
-	//fmt.Println(data)
-	render.Template(w, "adminshowreservation.page.tmpl.html", &models.TemplateData{
-		StringMap: stringMap,
-		Data:      data,
-		Form:      forms.New(nil),
-	}, r)
-}
-
-//Save edited reservation in admin mode
-func (m *Repository) AdminPostReservation(w http.ResponseWriter, r *http.Request) {
-
-	err := r.ParseForm()
+	month, err := strconv.Atoi(r.Form.Get("m"))
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	explode := strings.Split(r.RequestURI, "/")
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	removed := false
+	kept := false
+
+	// blocks in session map but not in posted data have been unchecked, remove them.
+	// A block over several days, like an imported one, is removed only when all its days are unchecked
+	for _, x := range rooms {
+		curMap, ok := m.App.Session.Get(r.Context(), fmt.Sprintf("block_map_%d", x.ID)).(map[string]int)
+		if !ok {
+			continue
+		}
+		unchecked := make(map[int][]string)
+		checked := make(map[int]bool)
+		for name, value := range curMap {
+			if value == 0 {
+				continue
+			}
+			if form.Has(fmt.Sprintf("remove_block_%d_%s", x.ID, name)) {
+				checked[value] = true
+			} else {
+				unchecked[value] = append(unchecked[value], name)
+			}
+		}
+		for blockID, days := range unchecked {
+			if checked[blockID] {
+				kept = true
+				continue
+			}
+			err := m.DB.DeleteBlockByID(blockID)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+			m.audit(r, "remove_block", "room", x.ID, map[string]interface{}{"block_id": blockID, "dates": days}, nil)
+			removed = true
+		}
+	}
+	if kept {
+		m.App.Session.Put(r.Context(), "error", "A block over several days is removed only when all its days are unchecked")
+	}
+
+	// checked add_block_<room>_<date> boxes are new blocks
+	for name := range r.PostForm {
+		if strings.HasPrefix(name, "add_block") {
+			exploded := strings.Split(name, "_")
+			if len(exploded) != 4 {
+				continue
+			}
+			roomId, err := strconv.Atoi(exploded[2])
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+			t, err := time.Parse("2006-01-2", exploded[3])
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+			err = m.DB.InsertBlockForRoom(roomId, t)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+			m.audit(r, "add_block", "room", roomId, nil, map[string]string{"date": t.Format("2006-01-02")})
+		}
+	}
+
+	if removed {
+		go m.notifyWaitlist()
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Changes saved.")
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservation-calendar?y=%d&m=%d", year, month), http.StatusSeeOther)
+}
+
+//AdminShowReservation shows one reservation in admin tool for processing
+func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request) {
+	explode := strings.Split(r.RequestURI, "/")
 	id, err := strconv.Atoi(explode[4])
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 	src := explode[3]
+
+	//get reservaton from DB
+	res, err := m.DB.GetReservationById(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.renderAdminReservation(w, r, res, src, forms.New(nil))
+}
+
+//renderAdminReservation renders the admin reservation page with given form
+func (m *Repository) renderAdminReservation(w http.ResponseWriter, r *http.Request, res models.Reservation, src string, form *forms.Form) {
 	stringMap := make(map[string]string)
 	stringMap["src"] = src
+	if lifecycle.Open(res.Status) {
+		refund, err := m.refundFor(res)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		stringMap["refund"] = render.Price(refund)
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	invoices, err := m.DB.InvoicesForReservation(res.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	ledger, err := m.DB.PaymentsForReservation(res.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	paid, outstanding := payments.Balance(res.TotalPrice, ledger)
+	stringMap["paid"] = render.Price(paid)
+	stringMap["outstanding"] = render.Price(outstanding)
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["rooms"] = rooms
+	data["invoices"] = invoices
+	data["payments"] = ledger
+	data["next"] = lifecycle.Next(res.Status)
+	data["open"] = lifecycle.Open(res.Status)
+	render.Template(w, "adminshowreservation.page.tmpl.html", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      form,
+	}, r)
+}
+
+//Save edited reservation in admin mode, changed dates or room are re-checked for availability and the guest is notified
+func (m *Repository) AdminPostReservation(w http.ResponseWriter, r *http.Request) {
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	explode := strings.Split(r.RequestURI, "/")
+	id, err := strconv.Atoi(explode[4])
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	src := explode[3]
 
 	res, err := m.DB.GetReservationById(id)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
+	old := res
 
 	res.FirstName = r.Form.Get("first_name")
 	res.LastName = r.Form.Get("last_name")
 	res.Email = r.Form.Get("email")
 	res.Phone = r.Form.Get("phone")
+
+	form := forms.New(r.PostForm)
+	moved := false
+	if r.Form.Get("start_date") != "" && lifecycle.Open(res.Status) {
+		layout := "2006-01-02"
+		startDate, err := time.Parse(layout, r.Form.Get("start_date"))
+		if err != nil {
+			form.Errors.Add("start_date", "Invalid date")
+		}
+		endDate, err := time.Parse(layout, r.Form.Get("end_date"))
+		if err != nil || !endDate.After(startDate) {
+			form.Errors.Add("end_date", "Departure must be after arrival")
+		}
+		roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
+		if roomID == 0 {
+			roomID = res.RoomId
+		}
+		moved = form.Valid() && (!startDate.Equal(res.StartDate) || !endDate.Equal(res.EndDate) || roomID != res.RoomId)
+
+		if moved {
+			room, err := m.DB.GetRoomNameById(roomID)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+			if res.Guests() > room.MaxOccupancy {
+				form.Errors.Add("room_id", "Too many guests for this room")
+			}
+			res.StartDate = startDate
+			res.EndDate = endDate
+			res.RoomId = room.ID
+			res.Room = room
+		}
+	}
+	if !form.Valid() {
+		m.renderAdminReservation(w, r, res, src, form)
+		return
+	}
+
+	if moved {
+		res.TotalPrice, res.DiscountAmount, err = m.discountedTotal(res)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		// extras keep their price, quantities follow the new dates
+		lines := make([]models.ReservationExtra, 0, len(res.Extras))
+		for _, x := range res.Extras {
+			lines = append(lines, extras.Requantify(x, pricing.Nights(res.StartDate, res.EndDate), res.Guests()))
+		}
+		res.Extras = lines
+		res.TotalPrice += res.ExtrasTotal()
+		err = m.DB.MoveReservation(res)
+		if errors.Is(err, repository.ErrRoomNotAvailable) {
+			form.Errors.Add("start_date", "Room is not available for these dates")
+			m.renderAdminReservation(w, r, res, src, form)
+			return
+		}
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
 	//fmt.Println("update db alkaa")
 	err = m.DB.UpdateReservation(res)
 	//.Println("update db tehty")
@@ -718,33 +1372,437 @@ func (m *Repository) AdminPostReservation(w http.ResponseWriter, r *http.Request
 		helpers.ServerError(w, err)
 		return
 	}
+
+	if moved {
+		m.audit(r, "move", "reservation", res.ID, old, res)
+		m.sendReservationChangedEmail(old, res)
+		go m.notifyWaitlist()
+	} else {
+		m.audit(r, "update", "reservation", res.ID, old, res)
+	}
 	m.App.Session.Put(r.Context(), "flash", "Changes saved.")
 	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
 }
 
+//sendReservationChangedEmail tells the guest the new dates and room of a moved reservation
+func (m *Repository) sendReservationChangedEmail(old, res models.Reservation) {
+	message := fmt.Sprintf(`
+		<strong>Reservation changed</strong><br><br>
+		Dear %s %s, <br><hr>
+		Your reservation is changed.<br>
+		Before: %s from %s to %s<br>
+		Now: %s from %s to %s<br>
+		Total price: %s<br><br>
+		You can see your booking at <a href="%s">%s</a>.
+		`, res.FirstName, res.LastName,
+		old.Room.RoomName, old.StartDate.Format("02-01-2006"), old.EndDate.Format("02-01-2006"),
+		res.Room.RoomName, res.StartDate.Format("02-01-2006"), res.EndDate.Format("02-01-2006"),
+		render.Price(res.TotalPrice), m.guestLink(res), m.guestLink(res))
+
+	m.App.MailChan <- models.MailData{
+		To:       res.Email,
+		From:     "ed.glen@blacklodge.xyz",
+		Subject:  "Reservation changed",
+		Message:  message,
+		Template: "basic.html",
+	}
+}
+
 //AdminStatistics show statistics for admin only
 func (m *Repository) AdminStatistics(w http.ResponseWriter, r *http.Request) {
 	render.Template(w, "statistics.page.tmpl.html", &models.TemplateData{}, r)
 
 }
 
-//AdminProcessReservation marks reservation as processed
-func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	src := chi.URLParam(r, "src")
-	_ = m.DB.UpdatePrcessed(id, 1)
-	m.App.Session.Put(r.Context(), "flash", "Reservation marked as processed.")
-	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
-
-}
-
 //delete-reservation
 //AdminDelteReservation deletes a reservation in admin mode
 func (m *Repository) AdminDelteReservation(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
 	src := chi.URLParam(r, "src")
-	_ = m.DB.DeleteReservation(id)
+	res, _ := m.DB.GetReservationById(id)
+	if err := m.DB.DeleteReservation(id); err == nil {
+		m.audit(r, "delete", "reservation", id, res, nil)
+	}
+	go m.notifyWaitlist()
 	m.App.Session.Put(r.Context(), "flash", "Reservation deleted")
 	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
 
 }
+
+//AdminRooms lists all rooms in admin tool
+func (m *Repository) AdminRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+	render.Template(w, "adminrooms.page.tmpl.html", &models.TemplateData{
+		Data: data,
+	}, r)
+}
+
+//AdminShowRoom shows room edit form in admin tool, room ID 0 is a new room
+func (m *Repository) AdminShowRoom(w http.ResponseWriter, r *http.Request) {
+	explode := strings.Split(r.RequestURI, "/")
+	id, err := strconv.Atoi(explode[3])
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	room := models.Room{Active: true, MaxOccupancy: 2}
+	if id > 0 {
+		room, err = m.DB.GetRoomNameById(id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	prices, err := m.DB.AllPricing()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	policies, err := m.DB.AllCancellationPolicies()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	if room.ICalToken != "" {
+		stringMap["ical_url"] = m.App.BaseURL + "/ical/" + room.ICalToken + ".ics"
+	}
+
+	data := make(map[string]interface{})
+	data["room"] = room
+	data["pricing"] = prices
+	data["policies"] = policies
+	render.Template(w, "adminroom.page.tmpl.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		Form:      forms.New(nil),
+	}, r)
+}
+
+//AdminPostRoom saves a new or edited room in admin tool
+func (m *Repository) AdminPostRoom(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	explode := strings.Split(r.RequestURI, "/")
+	id, err := strconv.Atoi(explode[3])
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	pricingId, _ := strconv.Atoi(r.Form.Get("pricing_id"))
+	maxOccupancy, _ := strconv.Atoi(r.Form.Get("max_occupancy"))
+	policyId, _ := strconv.Atoi(r.Form.Get("cancellation_policy_id"))
+	room := models.Room{
+		ID:                   id,
+		RoomName:             r.Form.Get("room_name"),
+		Shower:               r.Form.Get("shower") != "",
+		Minibar:              r.Form.Get("minibar") != "",
+		PricingId:            pricingId,
+		Description:          r.Form.Get("description"),
+		Active:               r.Form.Get("active") != "",
+		MaxOccupancy:         maxOccupancy,
+		CancellationPolicyID: policyId,
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("room_name", "pricing_id", "max_occupancy")
+	form.MinLenght("room_name", 3)
+	if pricingId < 1 {
+		form.Errors.Add("pricing_id", "Choose pricing for the room")
+	}
+	if maxOccupancy < 1 {
+		form.Errors.Add("max_occupancy", "Room must sleep at least one guest")
+	}
+
+	if !form.Valid() {
+		prices, err := m.DB.AllPricing()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		policies, err := m.DB.AllCancellationPolicies()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		data := make(map[string]interface{})
+		data["room"] = room
+		data["pricing"] = prices
+		data["policies"] = policies
+		render.Template(w, "adminroom.page.tmpl.html", &models.TemplateData{
+			Data: data,
+			Form: form,
+		}, r)
+		return
+	}
+
+	var before interface{}
+	if id == 0 {
+		room.ID, err = m.DB.InsertRoom(room)
+	} else {
+		before, err = m.DB.GetRoomNameById(id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		err = m.DB.UpdateRoom(room)
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if id == 0 {
+		m.audit(r, "create", "room", room.ID, nil, room)
+	} else {
+		m.audit(r, "update", "room", room.ID, before, room)
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Room saved.")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+//AdminDeactivateRoom hides a room from availability searches
+func (m *Repository) AdminDeactivateRoom(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	if err := m.DB.UpdateRoomActive(id, false); err != nil {
+		m.App.Session.Put(r.Context(), "error", "Cannot deactivate room: "+err.Error())
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+	m.audit(r, "deactivate", "room", id, nil, nil)
+	m.App.Session.Put(r.Context(), "flash", "Room deactivated.")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+//AdminActivateRoom makes a room bookable again
+func (m *Repository) AdminActivateRoom(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	if err := m.DB.UpdateRoomActive(id, true); err != nil {
+		m.App.Session.Put(r.Context(), "error", "Cannot activate room: "+err.Error())
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+	m.audit(r, "activate", "room", id, nil, nil)
+	m.App.Session.Put(r.Context(), "flash", "Room activated.")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+//AdminDeleteRoom deletes a room without reservations in admin mode, a room with reservations is deactivated instead
+func (m *Repository) AdminDeleteRoom(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	room, err := m.DB.GetRoomNameById(id)
+	if err == nil {
+		err = m.DB.DeleteRoom(id)
+	}
+	if errors.Is(err, repository.ErrRoomHasReservations) {
+		m.App.Session.Put(r.Context(), "error", "Room "+room.RoomName+" has reservations and cannot be deleted. Deactivate it instead.")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Cannot delete room: "+err.Error())
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+	m.audit(r, "delete", "room", id, room, nil)
+	m.App.Session.Put(r.Context(), "flash", "Room deleted.")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+//AdminRoomRules lists stay rules and shows form for a new rule in admin tool
+func (m *Repository) AdminRoomRules(w http.ResponseWriter, r *http.Request) {
+	m.renderRoomRules(w, r, forms.New(nil))
+}
+
+//renderRoomRules renders the stay rules page with given form
+func (m *Repository) renderRoomRules(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	roomRules, err := m.DB.AllRoomRules()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	data := make(map[string]interface{})
+	data["rules"] = roomRules
+	data["rooms"] = rooms
+	render.Template(w, "adminroomrules.page.tmpl.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	}, r)
+}
+
+//AdminPostRoomRule saves a new stay rule in admin tool
+func (m *Repository) AdminPostRoomRule(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("room_id", "restriction_id", "start_date", "end_date")
+
+	layout := "2006-01-02"
+	roomId, _ := strconv.Atoi(r.Form.Get("room_id"))
+	restrictionId, _ := strconv.Atoi(r.Form.Get("restriction_id"))
+	ruleValue, _ := strconv.Atoi(r.Form.Get("rule_value"))
+	startDate, err := time.Parse(layout, r.Form.Get("start_date"))
+	if err != nil {
+		form.Errors.Add("start_date", "Invalid date")
+	}
+	endDate, err := time.Parse(layout, r.Form.Get("end_date"))
+	if err != nil {
+		form.Errors.Add("end_date", "Invalid date")
+	}
+	if endDate.Before(startDate) {
+		form.Errors.Add("end_date", "End date must not be before start date")
+	}
+	if restrictionId < models.RestrictionMinNights || restrictionId > models.RestrictionClosedToDeparture {
+		form.Errors.Add("restriction_id", "Choose rule type")
+	}
+	if (restrictionId == models.RestrictionMinNights || restrictionId == models.RestrictionMaxNights) && ruleValue < 1 {
+		form.Errors.Add("rule_value", "Nights must be at least 1")
+	}
+
+	if !form.Valid() {
+		m.renderRoomRules(w, r, form)
+		return
+	}
+
+	rule := models.RoomRestriction{
+		RoomId:        roomId,
+		RestrictionId: restrictionId,
+		StartDate:     startDate,
+		EndDate:       endDate,
+		RuleValue:     ruleValue,
+	}
+	err = m.DB.InsertRoomRule(rule)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.audit(r, "create", "room_rule", 0, nil, rule)
+
+	m.App.Session.Put(r.Context(), "flash", "Rule saved.")
+	http.Redirect(w, r, "/admin/room-rules", http.StatusSeeOther)
+}
+
+//AdminDeleteRoomRule deletes a stay rule in admin tool
+func (m *Repository) AdminDeleteRoomRule(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	if err := m.DB.DeleteRoomRule(id); err == nil {
+		m.audit(r, "delete", "room_rule", id, nil, nil)
+	}
+	m.App.Session.Put(r.Context(), "flash", "Rule deleted.")
+	http.Redirect(w, r, "/admin/room-rules", http.StatusSeeOther)
+}
+
+//loggedInUser returns ID of the logged in user, or sends the visitor to log in and returns false
+func (m *Repository) loggedInUser(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+	if userID == 0 {
+		m.App.Session.Put(r.Context(), "error", "Log in first!")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return 0, false
+	}
+	return userID, true
+}
+
+//AdminAPITokens shows API tokens of the logged in user
+func (m *Repository) AdminAPITokens(w http.ResponseWriter, r *http.Request) {
+	if _, ok := m.loggedInUser(w, r); !ok {
+		return
+	}
+	m.renderAPITokens(w, r, forms.New(nil), "")
+}
+
+//renderAPITokens renders the API tokens page, a new token is shown only once
+func (m *Repository) renderAPITokens(w http.ResponseWriter, r *http.Request, form *forms.Form, newToken string) {
+	tokens, err := m.DB.AllAPITokensForUser(m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	data := make(map[string]interface{})
+	data["tokens"] = tokens
+	stringMap := make(map[string]string)
+	stringMap["new_token"] = newToken
+	render.Template(w, "adminapitokens.page.tmpl.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		Form:      form,
+	}, r)
+}
+
+//AdminPostAPIToken creates a new API token for the logged in user
+func (m *Repository) AdminPostAPIToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.loggedInUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name")
+	if !form.Valid() {
+		m.renderAPITokens(w, r, form, "")
+		return
+	}
+
+	plain, hash, err := apitoken.New()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	tokenID, err := m.DB.InsertAPIToken(models.APIToken{
+		UserID:    userID,
+		Name:      r.Form.Get("name"),
+		TokenHash: hash,
+	})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.audit(r, "create", "api_token", tokenID, nil, map[string]string{"name": r.Form.Get("name")})
+
+	m.App.Session.Put(r.Context(), "flash", "Token created. Copy it now, it is not shown again.")
+	m.renderAPITokens(w, r, forms.New(nil), plain)
+}
+
+//AdminDeleteAPIToken revokes an API token of the logged in user
+func (m *Repository) AdminDeleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := m.loggedInUser(w, r)
+	if !ok {
+		return
+	}
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	if err := m.DB.DeleteAPIToken(id, userID); err == nil {
+		m.audit(r, "delete", "api_token", id, nil, nil)
+	}
+	m.App.Session.Put(r.Context(), "flash", "Token revoked.")
+	http.Redirect(w, r, "/admin/api-tokens", http.StatusSeeOther)
+}
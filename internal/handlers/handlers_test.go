@@ -3,14 +3,22 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/payments"
+	"github.com/t-Ikonen/bbbookingsystem/internal/promo"
+	"github.com/t-Ikonen/bbbookingsystem/internal/repository"
+	"github.com/t-Ikonen/bbbookingsystem/internal/signedlink"
 )
 
 // type postData struct {
@@ -301,6 +309,79 @@ func TestRepository_PostReservation(t *testing.T) {
 
 }
 
+func TestRepository_PostReservationTaken(t *testing.T) {
+	reservation := models.Reservation{
+		RoomId: 1,
+		Room: models.Room{
+			ID:       1,
+			RoomName: "Frost Suite",
+		},
+	}
+
+	postedData := url.Values{}
+	postedData.Add("first_name", "John")
+	postedData.Add("last_name", "Smith")
+	postedData.Add("email", "john@smith.com")
+	postedData.Add("phone", "555-555-5555")
+
+	req, _ := http.NewRequest("POST", "/reservation", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	session.Put(ctx, "reservation", reservation)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.PostReservation)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/reservationsummary" {
+		t.Errorf("PostReservation handler returned wrong response: got %d to %s, wanted %d to /reservationsummary", rr.Code, rr.Header().Get("Location"), http.StatusSeeOther)
+	}
+
+	// test for room taken between search and submit (room 2 in test repo)
+	req, _ = http.NewRequest("POST", "/reservation", strings.NewReader(postedData.Encode()))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	reservation.RoomId = 2
+	session.Put(ctx, "reservation", reservation)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/booking" {
+		t.Errorf("PostReservation handler returned wrong response for taken room: got %d to %s, wanted %d to /booking", rr.Code, rr.Header().Get("Location"), http.StatusSeeOther)
+	}
+}
+
+func TestRepository_ChooseRoom(t *testing.T) {
+	var chooseTests = []struct {
+		name             string
+		url              string
+		expectedLocation string
+	}{
+		{"room held", "/chooseroom/1", "/reservation"},
+		{"room just taken", "/chooseroom/2", "/booking"},
+		{"hold fails", "/chooseroom/100", "/"},
+	}
+
+	for _, e := range chooseTests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.RequestURI = e.url
+		session.Put(ctx, "reservation", models.Reservation{})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.ChooseRoom)
+		handler.ServeHTTP(rr, req)
+
+		if loc := rr.Header().Get("Location"); loc != e.expectedLocation {
+			t.Errorf("for %s expected redirect to %s but got %s", e.name, e.expectedLocation, loc)
+		}
+	}
+}
+
 func TestRepository_BookingJSON(t *testing.T) {
 	/*****************************************
 	// first case -- rooms are not available
@@ -458,6 +539,1761 @@ func TestRepository_BookingJSON(t *testing.T) {
 	}
 }
 
+func TestRepository_BookingJSONGuests(t *testing.T) {
+	var guestTests = []struct {
+		name       string
+		adults     string
+		children   string
+		expectedOK bool
+	}{
+		{"fits", "1", "1", true},
+		{"too many", "2", "1", false},
+	}
+
+	for _, e := range guestTests {
+		postedData := url.Values{}
+		postedData.Add("start", "01-02-2040")
+		postedData.Add("end", "02-03-2040")
+		postedData.Add("room_id", "1")
+		postedData.Add("adults", e.adults)
+		postedData.Add("children", e.children)
+
+		req, _ := http.NewRequest("POST", "/bookingjson", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.BookingJSON)
+		handler.ServeHTTP(rr, req)
+
+		var j jsonResponse
+		err := json.Unmarshal(rr.Body.Bytes(), &j)
+		if err != nil {
+			t.Error("failed to parse json!")
+		}
+		if j.OK != e.expectedOK {
+			t.Errorf("for %s expected ok %t but got %t", e.name, e.expectedOK, j.OK)
+		}
+	}
+}
+
+func TestRepository_BookingJSONStayRules(t *testing.T) {
+	// room 3 in test repo requires at least 3 nights
+	postedData := url.Values{}
+	postedData.Add("start", "01-02-2040")
+	postedData.Add("end", "01-03-2040")
+	postedData.Add("room_id", "3")
+
+	req, _ := http.NewRequest("POST", "/bookingjson", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.BookingJSON)
+	handler.ServeHTTP(rr, req)
+
+	var j jsonResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &j)
+	if err != nil {
+		t.Error("failed to parse json!")
+	}
+	if j.OK || !strings.Contains(j.Message, "at least 3 nights") {
+		t.Errorf("Got availability when minimum stay was broken, message %q", j.Message)
+	}
+}
+
+func TestRepository_AdminPostCalendar(t *testing.T) {
+	postedData := url.Values{}
+	postedData.Add("y", "2050")
+	postedData.Add("m", "1")
+	postedData.Add("add_block_1_2050-01-2", "1")
+	postedData.Add("remove_block_1_2050-01-3", "4")
+
+	req, _ := http.NewRequest("POST", "/admin/reservation-calendar", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	session.Put(ctx, "block_map_1", map[string]int{
+		"2050-01-2": 0,
+		"2050-01-3": 4,
+		"2050-01-4": 5,
+	})
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.AdminPostCalendar)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminPostCalendar handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if loc := rr.Header().Get("Location"); loc != "/admin/reservation-calendar?y=2050&m=1" {
+		t.Errorf("AdminPostCalendar redirected to wrong location: %s", loc)
+	}
+
+	// test for invalid date in block name
+	postedData = url.Values{}
+	postedData.Add("y", "2050")
+	postedData.Add("m", "1")
+	postedData.Add("add_block_1_invalid", "1")
+
+	req, _ = http.NewRequest("POST", "/admin/reservation-calendar", strings.NewReader(postedData.Encode()))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("AdminPostCalendar handler returned wrong response code for invalid date: got %d, wanted %d", rr.Code, http.StatusInternalServerError)
+	}
+
+	// test for invalid year and month
+	for _, field := range []string{"y", "m"} {
+		postedData = url.Values{}
+		postedData.Add("y", "2050")
+		postedData.Add("m", "1")
+		postedData.Set(field, "junk")
+
+		req, _ = http.NewRequest("POST", "/admin/reservation-calendar", strings.NewReader(postedData.Encode()))
+		ctx = getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("AdminPostCalendar handler returned wrong response code for invalid %s: got %d, wanted %d", field, rr.Code, http.StatusInternalServerError)
+		}
+	}
+
+	// block 6 spans three days, unchecking one of them keeps the block
+	var blockTests = []struct {
+		name        string
+		checked     []string
+		expectError bool
+	}{
+		{"one day unchecked", []string{"2050-01-5", "2050-01-7"}, true},
+		{"all days unchecked", nil, false},
+		{"nothing unchecked", []string{"2050-01-5", "2050-01-6", "2050-01-7"}, false},
+	}
+	for _, e := range blockTests {
+		postedData = url.Values{}
+		postedData.Add("y", "2050")
+		postedData.Add("m", "1")
+		for _, day := range e.checked {
+			postedData.Add("remove_block_1_"+day, "6")
+		}
+
+		req, _ = http.NewRequest("POST", "/admin/reservation-calendar", strings.NewReader(postedData.Encode()))
+		ctx = getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		session.Put(ctx, "block_map_1", map[string]int{
+			"2050-01-4": 0,
+			"2050-01-5": 6,
+			"2050-01-6": 6,
+			"2050-01-7": 6,
+		})
+
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("for %s expected code %d but got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+		hasError := session.GetString(ctx, "error") != ""
+		if hasError != e.expectError {
+			t.Errorf("for %s expected error %v but got %v", e.name, e.expectError, hasError)
+		}
+	}
+}
+
+func TestRepository_AdminPostRoom(t *testing.T) {
+	var roomTests = []struct {
+		name               string
+		url                string
+		roomName           string
+		pricingId          string
+		expectedStatusCode int
+	}{
+		{"new room", "/admin/rooms/0", "Reindeer Cabin", "1", http.StatusSeeOther},
+		{"edit room", "/admin/rooms/1", "Frost Suite", "1", http.StatusSeeOther},
+		{"invalid form", "/admin/rooms/1", "F", "", http.StatusOK},
+		{"insert fails", "/admin/rooms/0", "fail", "1", http.StatusInternalServerError},
+		{"update fails", "/admin/rooms/100", "Frost Suite", "1", http.StatusInternalServerError},
+		{"invalid id", "/admin/rooms/x", "Frost Suite", "1", http.StatusInternalServerError},
+	}
+
+	for _, e := range roomTests {
+		postedData := url.Values{}
+		postedData.Add("room_name", e.roomName)
+		postedData.Add("pricing_id", e.pricingId)
+		postedData.Add("max_occupancy", "4")
+		postedData.Add("shower", "1")
+
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RequestURI = e.url
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostRoom)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s AdminPostRoom expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_AdminDeleteRoom(t *testing.T) {
+	var deleteTests = []struct {
+		name        string
+		url         string
+		expectError bool
+	}{
+		{"no reservations", "/admin/delete-room/2", false},
+		{"has reservations", "/admin/delete-room/1", true},
+		{"no such room", "/admin/delete-room/100", true},
+		{"deactivate", "/admin/deactivate-room/2", false},
+		{"activate", "/admin/activate-room/2", false},
+	}
+
+	routes := getRoutes()
+	for _, e := range deleteTests {
+		req, _ := http.NewRequest("POST", e.url, nil)
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/rooms" {
+			t.Errorf("for %s expected %d to /admin/rooms but got %d to %s", e.name, http.StatusSeeOther, rr.Code, rr.Header().Get("Location"))
+		}
+		cookies := rr.Result().Cookies()
+		if len(cookies) == 0 {
+			t.Errorf("for %s no session cookie", e.name)
+			continue
+		}
+		next, _ := http.NewRequest("GET", "/", nil)
+		ctx, _ := session.Load(next.Context(), cookies[0].Value)
+		hasError := session.GetString(ctx, "error") != ""
+		if hasError != e.expectError {
+			t.Errorf("for %s expected error %v but got %v", e.name, e.expectError, hasError)
+		}
+	}
+
+	// a link cannot change a room
+	for _, path := range []string{"/admin/delete-room/2", "/admin/deactivate-room/2", "/admin/activate-room/2"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+		if rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("GET %s returned %d, wanted %d", path, rr.Code, http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func TestRepository_BookRoom(t *testing.T) {
+	var bookTests = []struct {
+		name             string
+		url              string
+		expectedLocation string
+		expectError      bool
+	}{
+		{"room fits", "/bookroom?id=1&s=01-10-2050&e=01-12-2050&a=1&c=1", "/reservation", false},
+		{"too many guests", "/bookroom?id=1&s=01-10-2050&e=01-12-2050&a=2&c=1", "/booking", true},
+		{"deactivated room", "/bookroom?id=3&s=01-10-2050&e=01-12-2050&a=1&c=0", "/booking", true},
+	}
+
+	routes := getRoutes()
+	for _, e := range bookTests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("for %s expected %d to %s but got %d to %s", e.name, http.StatusSeeOther, e.expectedLocation, rr.Code, rr.Header().Get("Location"))
+		}
+		cookies := rr.Result().Cookies()
+		if len(cookies) == 0 {
+			t.Errorf("for %s no session cookie", e.name)
+			continue
+		}
+		next, _ := http.NewRequest("GET", "/", nil)
+		ctx, _ := session.Load(next.Context(), cookies[0].Value)
+		hasError := session.GetString(ctx, "error") != ""
+		if hasError != e.expectError {
+			t.Errorf("for %s expected error %v but got %v", e.name, e.expectError, hasError)
+		}
+	}
+}
+
+//postOnlyTests are admin actions changing data, they are posted with the CSRF token and a link cannot run them
+var postOnlyTests = []struct {
+	name             string
+	url              string
+	expectedLocation string
+}{
+	{"delete room rule", "/admin/delete-room-rule/1", "/admin/room-rules"},
+	{"revoke api token logged out", "/admin/delete-api-token/1", "/user/login"},
+	{"new ical token", "/admin/new-ical-token/1", "/admin/rooms/1"},
+	{"sync ical imports", "/admin/sync-ical-imports", "/admin/ical-imports"},
+	{"delete ical import", "/admin/delete-ical-import/1", "/admin/ical-imports"},
+	{"delete cancellation policy", "/admin/delete-cancellation-policy/1", "/admin/cancellation-policies"},
+	{"check in", "/admin/check-in/8", "/admin/dashboard"},
+	{"check out", "/admin/check-out/7", "/admin/dashboard"},
+	{"create invoice", "/admin/create-invoice/all/1", "/admin/reservations/all/1"},
+	{"email invoice", "/admin/email-invoice/all/1", "/admin/reservations/all/1"},
+	{"delete promo code", "/admin/delete-promo-code/1", "/admin/promo-codes"},
+	{"email voucher without address", "/admin/email-voucher/1", "/admin/vouchers/1"},
+	{"delete extra", "/admin/delete-extra/1", "/admin/extras"},
+}
+
+func TestRepository_AdminPostOnly(t *testing.T) {
+	routes := getRoutes()
+	for _, e := range postOnlyTests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+		if rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("for %s GET returned %d, wanted %d", e.name, rr.Code, http.StatusMethodNotAllowed)
+		}
+
+		req, _ = http.NewRequest("POST", e.url, nil)
+		rr = httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("for %s POST returned %d to %s, wanted %d to %s", e.name, rr.Code, rr.Header().Get("Location"), http.StatusSeeOther, e.expectedLocation)
+		}
+	}
+}
+
+func TestRepository_PostWaitlist(t *testing.T) {
+	var waitlistTests = []struct {
+		name               string
+		postedData         url.Values
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"valid entry", url.Values{"start_date": {"01-01-2050"}, "end_date": {"01-05-2050"}, "first_name": {"Laura"}, "last_name": {"Palmer"}, "email": {"laura@here.com"}}, http.StatusSeeOther, "/"},
+		{"invalid email", url.Values{"start_date": {"01-01-2050"}, "end_date": {"01-05-2050"}, "first_name": {"Laura"}, "last_name": {"Palmer"}, "email": {"laura"}}, http.StatusOK, ""},
+		{"invalid start date", url.Values{"start_date": {"invalid"}, "end_date": {"01-05-2050"}, "first_name": {"Laura"}, "last_name": {"Palmer"}, "email": {"laura@here.com"}}, http.StatusTemporaryRedirect, "/"},
+		{"database error", url.Values{"start_date": {"01-01-2050"}, "end_date": {"01-05-2050"}, "first_name": {"Laura"}, "last_name": {"Palmer"}, "email": {"fail@here.com"}}, http.StatusTemporaryRedirect, "/"},
+	}
+
+	for _, e := range waitlistTests {
+		req, _ := http.NewRequest("POST", "/waitlist", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostWaitlist)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if loc := rr.Header().Get("Location"); loc != e.expectedLocation {
+			t.Errorf("for %s expected redirect to %s but got %s", e.name, e.expectedLocation, loc)
+		}
+	}
+}
+
+func TestRepository_PostBookingAlternatives(t *testing.T) {
+	postedData := url.Values{}
+	postedData.Add("startDate", "01-10-2050")
+	postedData.Add("endDate", "01-12-2050")
+
+	req, _ := http.NewRequest("POST", "/booking", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.PostBooking)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("PostBooking without availability gave wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
+	alternatives, ok := session.Get(ctx, "alternatives").([]models.AlternativeStay)
+	if !ok {
+		t.Fatal("no alternative dates in session")
+	}
+	if len(alternatives) != 2 {
+		t.Fatalf("expected 2 alternative stays but got %d", len(alternatives))
+	}
+	if alternatives[0].StartDate.Format("01-02-2006") != "01-08-2050" || alternatives[1].EndDate.Format("01-02-2006") != "01-15-2050" {
+		t.Errorf("alternative stays have wrong dates: %v", alternatives)
+	}
+}
+
+func TestRepository_AvailabilityJSON(t *testing.T) {
+	var availabilityTests = []struct {
+		name          string
+		url           string
+		expectedOK    bool
+		expectedDays  int
+		expectedState map[string]string
+	}{
+		{"free month", "/api/availability?room_id=1&month=2050-02", true, 28, map[string]string{"2050-02-01": "free"}},
+		{"booked and blocked", "/api/availability?room_id=2&month=2050-01", true, 31, map[string]string{
+			"2050-01-02": "free",
+			"2050-01-03": "booked",
+			"2050-01-04": "booked",
+			"2050-01-05": "free",
+			"2050-01-10": "blocked",
+		}},
+		{"missing month", "/api/availability?room_id=1", false, 0, nil},
+		{"invalid room id", "/api/availability?room_id=x&month=2050-01", false, 0, nil},
+		{"database error", "/api/availability?room_id=100&month=2050-01", false, 0, nil},
+	}
+
+	for _, e := range availabilityTests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AvailabilityJSON)
+		handler.ServeHTTP(rr, req)
+
+		var j availabilityResponse
+		err := json.Unmarshal(rr.Body.Bytes(), &j)
+		if err != nil {
+			t.Fatalf("for %s failed to parse json: %s", e.name, err)
+		}
+		if j.OK != e.expectedOK {
+			t.Errorf("for %s expected ok %v but got %v", e.name, e.expectedOK, j.OK)
+		}
+		if len(j.Days) != e.expectedDays {
+			t.Errorf("for %s expected %d days but got %d", e.name, e.expectedDays, len(j.Days))
+		}
+		for _, d := range j.Days {
+			if want, ok := e.expectedState[d.Date]; ok && d.Status != want {
+				t.Errorf("for %s expected %s to be %s but got %s", e.name, d.Date, want, d.Status)
+			}
+		}
+	}
+}
+
+var apiTests = []struct {
+	name               string
+	method             string
+	url                string
+	body               string
+	expectedStatusCode int
+}{
+	{"rooms", "GET", "/api/v1/rooms", "", http.StatusOK},
+	{"availability", "GET", "/api/v1/availability?start=2050-01-01&end=2050-01-04&adults=2", "", http.StatusOK},
+	{"availability invalid start", "GET", "/api/v1/availability?start=x&end=2050-01-04", "", http.StatusBadRequest},
+	{"availability end before start", "GET", "/api/v1/availability?start=2050-01-04&end=2050-01-01", "", http.StatusBadRequest},
+	{"create", "POST", "/api/v1/reservations", `{"room_id": 1, "start_date": "2050-01-01", "end_date": "2050-01-04", "adults": 2, "first_name": "Dale", "last_name": "Cooper", "email": "dale@here.com"}`, http.StatusCreated},
+	{"create room taken", "POST", "/api/v1/reservations", `{"room_id": 2, "start_date": "2050-01-01", "end_date": "2050-01-04", "first_name": "Dale", "last_name": "Cooper", "email": "dale@here.com"}`, http.StatusConflict},
+	{"create invalid email", "POST", "/api/v1/reservations", `{"room_id": 1, "start_date": "2050-01-01", "end_date": "2050-01-04", "first_name": "Dale", "last_name": "Cooper", "email": "dale"}`, http.StatusUnprocessableEntity},
+	{"create too many guests", "POST", "/api/v1/reservations", `{"room_id": 1, "start_date": "2050-01-01", "end_date": "2050-01-04", "adults": 3, "first_name": "Dale", "last_name": "Cooper", "email": "dale@here.com"}`, http.StatusUnprocessableEntity},
+	{"create breaks stay rule", "POST", "/api/v1/reservations", `{"room_id": 2, "start_date": "2050-01-01", "end_date": "2050-02-01", "first_name": "Dale", "last_name": "Cooper", "email": "dale@here.com"}`, http.StatusUnprocessableEntity},
+	{"create deactivated room", "POST", "/api/v1/reservations", `{"room_id": 3, "start_date": "2050-01-01", "end_date": "2050-01-04", "first_name": "Dale", "last_name": "Cooper", "email": "dale@here.com"}`, http.StatusUnprocessableEntity},
+	{"create unknown room", "POST", "/api/v1/reservations", `{"room_id": 100, "start_date": "2050-01-01", "end_date": "2050-01-04", "first_name": "Dale", "last_name": "Cooper", "email": "dale@here.com"}`, http.StatusNotFound},
+	{"create invalid json", "POST", "/api/v1/reservations", `{"room_id":`, http.StatusBadRequest},
+	{"get", "GET", "/api/v1/reservations/1", "", http.StatusOK},
+	{"get not found", "GET", "/api/v1/reservations/101", "", http.StatusNotFound},
+	{"get invalid id", "GET", "/api/v1/reservations/x", "", http.StatusBadRequest},
+	{"update", "PUT", "/api/v1/reservations/1", `{"first_name": "Dale", "last_name": "Cooper", "email": "dale@here.com"}`, http.StatusOK},
+	{"update invalid email", "PUT", "/api/v1/reservations/1", `{"first_name": "Dale", "last_name": "Cooper", "email": "dale"}`, http.StatusUnprocessableEntity},
+	{"cancel", "DELETE", "/api/v1/reservations/1", "", http.StatusOK},
+	{"cancel not found", "DELETE", "/api/v1/reservations/101", "", http.StatusNotFound},
+	{"cancel cancelled", "DELETE", "/api/v1/reservations/5", "", http.StatusConflict},
+	{"cancel fails", "DELETE", "/api/v1/reservations/6", "", http.StatusInternalServerError},
+	{"cancel checked in", "DELETE", "/api/v1/reservations/7", "", http.StatusConflict},
+	{"update cancelled", "PUT", "/api/v1/reservations/5", `{"first_name": "Dale", "last_name": "Cooper", "email": "dale@here.com"}`, http.StatusConflict},
+}
+
+func TestRepository_API(t *testing.T) {
+	routes := getRoutes()
+
+	for _, e := range apiTests {
+		req, _ := http.NewRequest(e.method, e.url, strings.NewReader(e.body))
+		req.Header.Set("Content-Type", "application/json")
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d: %s", e.name, e.expectedStatusCode, rr.Code, rr.Body.String())
+		}
+
+		var j apiResponse
+		err := json.Unmarshal(rr.Body.Bytes(), &j)
+		if err != nil {
+			t.Errorf("for %s failed to parse json: %s", e.name, err)
+		}
+		if j.OK != (rr.Code < http.StatusBadRequest) {
+			t.Errorf("for %s ok is %v for code %d", e.name, j.OK, rr.Code)
+		}
+	}
+}
+
+func TestRepository_APICreateReservationDeposit(t *testing.T) {
+	body := `{"room_id": 1, "start_date": "2050-01-01", "end_date": "2050-01-04", "first_name": "Dale", "last_name": "Cooper", "email": "dale@here.com"}`
+	req, _ := http.NewRequest("POST", "/api/v1/reservations", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	getRoutes().ServeHTTP(rr, req)
+
+	var j apiResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &j)
+	if err != nil || j.Reservation == nil {
+		t.Fatalf("failed to parse json: %s", rr.Body.String())
+	}
+	if j.Reservation.Status != models.StatusPending || j.Reservation.Deposit <= 0 || j.Reservation.PaymentDueAt == "" {
+		t.Errorf("expected pending reservation waiting for deposit, got %+v", j.Reservation)
+	}
+}
+
+func TestRepository_RoomICal(t *testing.T) {
+	routes := getRoutes()
+
+	req, _ := http.NewRequest("GET", "/ical/secret.ics", nil)
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("RoomICal returned %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/calendar") {
+		t.Errorf("RoomICal returned content type %s", ct)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{"UID:rr-1@blacklodge.xyz", "SUMMARY:Reserved", "UID:rr-2@blacklodge.xyz", "SUMMARY:Blocked", "X-WR-CALNAME:Snow Suite"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("RoomICal feed is missing %s", want)
+		}
+	}
+	if strings.Contains(body, "UID:rr-3@blacklodge.xyz") {
+		t.Error("RoomICal feed contains a block imported from another calendar")
+	}
+
+	req, _ = http.NewRequest("GET", "/ical/unknown.ics", nil)
+	rr = httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("RoomICal with unknown token returned %d, wanted %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestRepository_SyncICalImport(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("./../ical/testdata")))
+	defer ts.Close()
+
+	uploaded, err := os.ReadFile("./../ical/testdata/timed.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var syncTests = []struct {
+		name             string
+		imp              models.ICalImport
+		expectedImported int
+		wantErr          bool
+	}{
+		{"url", models.ICalImport{ID: 1, RoomID: 1, URL: ts.URL + "/airbnb.ics"}, 2, false},
+		{"uploaded file", models.ICalImport{ID: 1, RoomID: 1, Data: string(uploaded)}, 2, false},
+		{"overlapping bookings", models.ICalImport{ID: 1, RoomID: 2, URL: ts.URL + "/airbnb.ics"}, 0, false},
+		{"missing feed", models.ICalImport{ID: 1, RoomID: 1, URL: ts.URL + "/missing.ics"}, 0, true},
+		{"not a calendar", models.ICalImport{ID: 1, RoomID: 1, URL: ts.URL + "/notcalendar.ics"}, 0, true},
+		{"database error", models.ICalImport{ID: 1, RoomID: 100, URL: ts.URL + "/airbnb.ics"}, 0, true},
+	}
+
+	for _, e := range syncTests {
+		imported, err := Repo.SyncICalImport(ts.Client(), e.imp)
+		if (err != nil) != e.wantErr {
+			t.Errorf("for %s got error %v", e.name, err)
+		}
+		if imported != e.expectedImported {
+			t.Errorf("for %s expected %d imported blocks but got %d", e.name, e.expectedImported, imported)
+		}
+	}
+}
+
+func TestRepository_AdminPostICalImport(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("./../ical/testdata")))
+	defer ts.Close()
+
+	var postTests = []struct {
+		name               string
+		postedData         url.Values
+		expectedStatusCode int
+	}{
+		{"valid url", url.Values{"room_id": {"1"}, "name": {"Airbnb"}, "url": {ts.URL + "/airbnb.ics"}}, http.StatusSeeOther},
+		{"failing url is added", url.Values{"room_id": {"1"}, "name": {"Airbnb"}, "url": {ts.URL + "/missing.ics"}}, http.StatusSeeOther},
+		{"no url or file", url.Values{"room_id": {"1"}, "name": {"Airbnb"}}, http.StatusOK},
+		{"invalid url", url.Values{"room_id": {"1"}, "name": {"Airbnb"}, "url": {"ftp://example.com/cal.ics"}}, http.StatusOK},
+		{"missing name", url.Values{"room_id": {"1"}, "url": {ts.URL + "/airbnb.ics"}}, http.StatusOK},
+	}
+
+	for _, e := range postTests {
+		req, _ := http.NewRequest("POST", "/admin/ical-imports", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostICalImport)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_GuestBooking(t *testing.T) {
+	valid := signedlink.Sign(appCnf.SigningKey, 1, time.Now().Add(time.Hour))
+	expired := signedlink.Sign(appCnf.SigningKey, 1, time.Now().Add(-time.Hour))
+	missing := signedlink.Sign(appCnf.SigningKey, 101, time.Now().Add(time.Hour))
+	cancelled := signedlink.Sign(appCnf.SigningKey, 5, time.Now().Add(time.Hour))
+	checkedIn := signedlink.Sign(appCnf.SigningKey, 7, time.Now().Add(time.Hour))
+	forged := signedlink.Sign([]byte("other key"), 1, time.Now().Add(time.Hour))
+
+	var guestTests = []struct {
+		name               string
+		method             string
+		url                string
+		postedData         url.Values
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"show", "GET", "/my-booking/" + valid, nil, http.StatusOK, ""},
+		{"expired", "GET", "/my-booking/" + expired, nil, http.StatusSeeOther, "/"},
+		{"forged", "GET", "/my-booking/" + forged, nil, http.StatusSeeOther, "/"},
+		{"no such reservation", "GET", "/my-booking/" + missing, nil, http.StatusSeeOther, "/"},
+		{"update", "POST", "/my-booking/" + valid, url.Values{"email": {"audrey@here.com"}, "phone": {"555"}}, http.StatusSeeOther, "/my-booking/" + valid},
+		{"update invalid email", "POST", "/my-booking/" + valid, url.Values{"email": {"audrey"}}, http.StatusOK, ""},
+		{"update expired", "POST", "/my-booking/" + expired, url.Values{"email": {"audrey@here.com"}}, http.StatusSeeOther, "/"},
+		{"cancel", "POST", "/my-booking/" + valid + "/cancel", url.Values{}, http.StatusSeeOther, "/my-booking/" + valid},
+		{"cancel forged", "POST", "/my-booking/" + forged + "/cancel", url.Values{}, http.StatusSeeOther, "/"},
+		{"show cancelled", "GET", "/my-booking/" + cancelled, nil, http.StatusOK, ""},
+		{"update cancelled", "POST", "/my-booking/" + cancelled, url.Values{"email": {"audrey@here.com"}}, http.StatusSeeOther, "/my-booking/" + cancelled},
+		{"cancel cancelled", "POST", "/my-booking/" + cancelled + "/cancel", url.Values{}, http.StatusSeeOther, "/my-booking/" + cancelled},
+		{"cancel checked in", "POST", "/my-booking/" + checkedIn + "/cancel", url.Values{}, http.StatusSeeOther, "/my-booking/" + checkedIn},
+	}
+
+	routes := getRoutes()
+	for _, e := range guestTests {
+		var req *http.Request
+		if e.postedData != nil {
+			req, _ = http.NewRequest(e.method, e.url, strings.NewReader(e.postedData.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req, _ = http.NewRequest(e.method, e.url, nil)
+		}
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if loc := rr.Header().Get("Location"); loc != e.expectedLocation {
+			t.Errorf("for %s expected redirect to %s but got %s", e.name, e.expectedLocation, loc)
+		}
+	}
+}
+
+func TestRepository_AdminPostReservation(t *testing.T) {
+	details := url.Values{"first_name": {"Audrey"}, "last_name": {"Horne"}, "email": {"audrey@here.com"}, "phone": {"555"}}
+	withDates := func(start, end, room string) url.Values {
+		v := url.Values{}
+		for key, value := range details {
+			v[key] = value
+		}
+		v.Set("start_date", start)
+		v.Set("end_date", end)
+		v.Set("room_id", room)
+		return v
+	}
+
+	var moveTests = []struct {
+		name               string
+		postedData         url.Values
+		expectedStatusCode int
+	}{
+		{"details only", details, http.StatusSeeOther},
+		{"move", withDates("2050-01-01", "2050-01-03", "1"), http.StatusSeeOther},
+		{"move to taken room", withDates("2050-01-01", "2050-01-03", "2"), http.StatusOK},
+		{"end before start", withDates("2050-01-03", "2050-01-01", "1"), http.StatusOK},
+		{"invalid date", withDates("x", "2050-01-01", "1"), http.StatusOK},
+		{"unknown room", withDates("2050-01-01", "2050-01-03", "4"), http.StatusInternalServerError},
+	}
+
+	for _, e := range moveTests {
+		req, _ := http.NewRequest("POST", "/admin/reservations/all/1", strings.NewReader(e.postedData.Encode()))
+		req.RequestURI = "/admin/reservations/all/1"
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_CancelReservation(t *testing.T) {
+	// reservation 1 starts in 30 days in room 1 with a free cancellation policy until 14 days before
+	res, _ := Repo.DB.GetReservationById(1)
+	refund, err := Repo.cancelReservation(res)
+	if err != nil {
+		t.Fatalf("cancelReservation returned error %s", err)
+	}
+	if refund != res.TotalPrice {
+		t.Errorf("expected refund %.2f but got %.2f", res.TotalPrice, refund)
+	}
+
+	res.StartDate = time.Now().AddDate(0, 0, 10)
+	refund, err = Repo.cancelReservation(res)
+	if err != nil {
+		t.Fatalf("cancelReservation returned error %s", err)
+	}
+	if refund != res.TotalPrice/2 {
+		t.Errorf("expected refund %.2f but got %.2f", res.TotalPrice/2, refund)
+	}
+
+	res.StartDate = time.Now().AddDate(0, 0, 2)
+	refund, _ = Repo.cancelReservation(res)
+	if refund != 0 {
+		t.Errorf("expected no refund but got %.2f", refund)
+	}
+
+	// rooms without a policy are refunded in full
+	res.RoomId = 3
+	refund, _ = Repo.cancelReservation(res)
+	if refund != res.TotalPrice {
+		t.Errorf("expected refund %.2f without policy but got %.2f", res.TotalPrice, refund)
+	}
+
+	res.ID = 5
+	_, err = Repo.cancelReservation(res)
+	if !errors.Is(err, repository.ErrAlreadyCancelled) {
+		t.Errorf("expected ErrAlreadyCancelled but got %v", err)
+	}
+}
+
+func TestRepository_AdminReservationStatus(t *testing.T) {
+	var statusTests = []struct {
+		name               string
+		url                string
+		expectedStatusCode int
+		expectedLocation   string
+		expectError        bool
+	}{
+		{"check in", "/admin/reservation-status/all/1/checked-in", http.StatusSeeOther, "/admin/reservations/all/1", false},
+		{"no-show", "/admin/reservation-status/new/1/no-show", http.StatusSeeOther, "/admin/reservations/new/1", false},
+		{"check out before check in", "/admin/reservation-status/all/1/checked-out", http.StatusSeeOther, "/admin/reservations/all/1", true},
+		{"back to pending", "/admin/reservation-status/all/1/pending", http.StatusSeeOther, "/admin/reservations/all/1", true},
+		{"unknown status", "/admin/reservation-status/all/1/lost", http.StatusSeeOther, "/admin/reservations/all/1", true},
+		{"check out", "/admin/reservation-status/all/7/checked-out", http.StatusSeeOther, "/admin/reservations/all/7", false},
+		{"changed meanwhile", "/admin/reservation-status/all/6/checked-in", http.StatusSeeOther, "/admin/reservations/all/6", true},
+		{"cancel", "/admin/reservation-status/all/1/cancelled", http.StatusSeeOther, "/admin/reservations-all", false},
+		{"cancel checked in", "/admin/reservation-status/all/7/cancelled", http.StatusSeeOther, "/admin/reservations-all", true},
+		{"no such reservation", "/admin/reservation-status/all/101/checked-in", http.StatusInternalServerError, "", false},
+		{"cancel from button", "/admin/cancel-reservation/new/1", http.StatusSeeOther, "/admin/reservations-new", false},
+		{"cancel twice", "/admin/cancel-reservation/all/5", http.StatusSeeOther, "/admin/reservations-all", true},
+	}
+
+	routes := getRoutes()
+	for _, e := range statusTests {
+		req, _ := http.NewRequest("POST", e.url, nil)
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if loc := rr.Header().Get("Location"); loc != e.expectedLocation {
+			t.Errorf("for %s expected redirect to %s but got %s", e.name, e.expectedLocation, loc)
+		}
+
+		// the error or flash message waits in the session for the redirected page
+		cookies := rr.Result().Cookies()
+		if e.expectedStatusCode != http.StatusSeeOther || len(cookies) == 0 {
+			continue
+		}
+		next, _ := http.NewRequest("GET", "/", nil)
+		next.AddCookie(cookies[0])
+		ctx, _ := session.Load(next.Context(), cookies[0].Value)
+		hasError := session.GetString(ctx, "error") != ""
+		if hasError != e.expectError {
+			t.Errorf("for %s expected error %v but got %v", e.name, e.expectError, hasError)
+		}
+	}
+
+	// a link cannot change the reservation
+	req, _ := http.NewRequest("GET", "/admin/cancel-reservation/all/1", nil)
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("cancel with GET returned %d, wanted %d", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestRepository_AdminAudit(t *testing.T) {
+	var auditTests = []struct {
+		name               string
+		url                string
+		expectedStatusCode int
+	}{
+		{"all", "/admin/audit", http.StatusOK},
+		{"filtered", "/admin/audit?entity=reservation&entity_id=1&action=move&user_id=1&from=2050-01-01&to=2050-01-31", http.StatusOK},
+		{"invalid filters", "/admin/audit?entity_id=x&from=x&to=x", http.StatusOK},
+		{"db error", "/admin/audit?entity=reservation&entity_id=101", http.StatusInternalServerError},
+	}
+
+	routes := getRoutes()
+	for _, e := range auditTests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_AdminCancellationPolicies(t *testing.T) {
+	var policyTests = []struct {
+		name               string
+		postedData         url.Values
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"valid", url.Values{"name": {"Moderate"}, "days_before": {"14", "7", ""}, "refund_percent": {"100", "50", ""}}, http.StatusSeeOther, "/admin/cancellation-policies"},
+		{"missing name", url.Values{"days_before": {"14"}, "refund_percent": {"100"}}, http.StatusOK, ""},
+		{"no tiers", url.Values{"name": {"Strict"}, "days_before": {""}, "refund_percent": {""}}, http.StatusOK, ""},
+		{"percent over 100", url.Values{"name": {"Strict"}, "days_before": {"14"}, "refund_percent": {"150"}}, http.StatusOK, ""},
+		{"same days twice", url.Values{"name": {"Strict"}, "days_before": {"7", "7"}, "refund_percent": {"100", "50"}}, http.StatusOK, ""},
+		{"insert fails", url.Values{"name": {"fail"}, "days_before": {"7"}, "refund_percent": {"50"}}, http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range policyTests {
+		req, _ := http.NewRequest("POST", "/admin/cancellation-policies", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostCancellationPolicy)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if loc := rr.Header().Get("Location"); loc != e.expectedLocation {
+			t.Errorf("for %s expected redirect to %s but got %s", e.name, e.expectedLocation, loc)
+		}
+	}
+}
+
+func TestRepository_FrontDesk(t *testing.T) {
+	var frontDeskTests = []struct {
+		name               string
+		method             string
+		url                string
+		expectedStatusCode int
+		expectedLocation   string
+		expectError        bool
+	}{
+		{"dashboard", "GET", "/admin/dashboard", http.StatusOK, "", false},
+		{"check in", "POST", "/admin/check-in/8", http.StatusSeeOther, "/admin/dashboard", false},
+		{"check in pending", "POST", "/admin/check-in/9", http.StatusSeeOther, "/admin/dashboard", true},
+		{"check in before arrival", "POST", "/admin/check-in/1", http.StatusSeeOther, "/admin/dashboard", true},
+		{"check in twice", "POST", "/admin/check-in/7", http.StatusSeeOther, "/admin/dashboard", true},
+		{"check out", "POST", "/admin/check-out/7", http.StatusSeeOther, "/admin/dashboard", false},
+		{"check out before check in", "POST", "/admin/check-out/8", http.StatusSeeOther, "/admin/dashboard", true},
+		{"no such reservation", "POST", "/admin/check-out/101", http.StatusInternalServerError, "", false},
+	}
+
+	routes := getRoutes()
+	for _, e := range frontDeskTests {
+		req, _ := http.NewRequest(e.method, e.url, nil)
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if loc := rr.Header().Get("Location"); loc != e.expectedLocation {
+			t.Errorf("for %s expected redirect to %s but got %s", e.name, e.expectedLocation, loc)
+		}
+
+		cookies := rr.Result().Cookies()
+		if e.expectedStatusCode != http.StatusSeeOther || len(cookies) == 0 {
+			continue
+		}
+		next, _ := http.NewRequest("GET", "/", nil)
+		next.AddCookie(cookies[0])
+		ctx, _ := session.Load(next.Context(), cookies[0].Value)
+		hasError := session.GetString(ctx, "error") != ""
+		if hasError != e.expectError {
+			t.Errorf("for %s expected error %v but got %v", e.name, e.expectError, hasError)
+		}
+	}
+}
+
+func TestRepository_Invoices(t *testing.T) {
+	var invoiceTests = []struct {
+		name               string
+		method             string
+		url                string
+		expectedStatusCode int
+		expectedLocation   string
+		expectError        bool
+	}{
+		{"create", "POST", "/admin/create-invoice/all/1", http.StatusSeeOther, "/admin/reservations/all/1", false},
+		{"create cancelled", "POST", "/admin/create-invoice/all/5", http.StatusSeeOther, "/admin/reservations/all/5", true},
+		{"create twice", "POST", "/admin/create-invoice/new/7", http.StatusSeeOther, "/admin/reservations/new/7", true},
+		{"create fails", "POST", "/admin/create-invoice/all/6", http.StatusInternalServerError, "", false},
+		{"create no such reservation", "POST", "/admin/create-invoice/all/101", http.StatusInternalServerError, "", false},
+		{"show", "GET", "/admin/invoices/1", http.StatusOK, "", false},
+		{"show no such invoice", "GET", "/admin/invoices/101", http.StatusInternalServerError, "", false},
+		{"pdf", "GET", "/admin/invoices/1/pdf", http.StatusOK, "", false},
+		{"pdf no such invoice", "GET", "/admin/invoices/101/pdf", http.StatusInternalServerError, "", false},
+		{"email", "POST", "/admin/email-invoice/all/1", http.StatusSeeOther, "/admin/reservations/all/1", false},
+		{"email no such invoice", "POST", "/admin/email-invoice/all/101", http.StatusInternalServerError, "", false},
+		{"show paid deposit", "GET", "/admin/invoices/7", http.StatusOK, "", false},
+		{"pdf paid deposit", "GET", "/admin/invoices/7/pdf", http.StatusOK, "", false},
+		{"email paid deposit", "POST", "/admin/email-invoice/all/7", http.StatusSeeOther, "/admin/reservations/all/7", false},
+	}
+
+	routes := getRoutes()
+	for _, e := range invoiceTests {
+		req, _ := http.NewRequest(e.method, e.url, nil)
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if loc := rr.Header().Get("Location"); loc != e.expectedLocation {
+			t.Errorf("for %s expected redirect to %s but got %s", e.name, e.expectedLocation, loc)
+		}
+
+		cookies := rr.Result().Cookies()
+		if e.expectedStatusCode != http.StatusSeeOther || len(cookies) == 0 {
+			continue
+		}
+		next, _ := http.NewRequest("GET", "/", nil)
+		next.AddCookie(cookies[0])
+		ctx, _ := session.Load(next.Context(), cookies[0].Value)
+		hasError := session.GetString(ctx, "error") != ""
+		if hasError != e.expectError {
+			t.Errorf("for %s expected error %v but got %v", e.name, e.expectError, hasError)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/admin/invoices/1/pdf", nil)
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+	if ct := rr.Header().Get("Content-Type"); ct != "application/pdf" {
+		t.Errorf("expected PDF content type but got %s", ct)
+	}
+	if !strings.HasPrefix(rr.Body.String(), "%PDF-") {
+		t.Error("invoice download is not a PDF document")
+	}
+}
+
+func TestInvoiceMessage(t *testing.T) {
+	inv, _ := Repo.invoiceWithPayments(7)
+	if inv.Paid != 60 || inv.Outstanding != 140 {
+		t.Errorf("expected 60.00 paid and 140.00 outstanding but got %.2f and %.2f", inv.Paid, inv.Outstanding)
+	}
+	message := invoiceMessage(inv)
+	if !strings.Contains(message, "paid 60.00 €") || !strings.Contains(message, "pay 140.00 €") {
+		t.Errorf("message does not take off the paid deposit: %s", message)
+	}
+
+	inv.Paid, inv.Outstanding = 200, 0
+	if message := invoiceMessage(inv); strings.Contains(message, "reference") {
+		t.Errorf("message of a paid invoice asks to pay: %s", message)
+	}
+
+	inv, _ = Repo.invoiceWithPayments(1)
+	if message := invoiceMessage(inv); !strings.Contains(message, "pay 200.00 €") {
+		t.Errorf("message of an unpaid invoice does not ask for the total: %s", message)
+	}
+}
+
+func TestRepository_Deposit(t *testing.T) {
+	reservation := models.Reservation{
+		ID:         1,
+		RoomId:     1,
+		TotalPrice: 200,
+		Status:     models.StatusPending,
+		Room: models.Room{
+			ID:       1,
+			RoomName: "Frost Suite",
+		},
+	}
+
+	// a reservation with a price goes to the deposit step
+	postedData := url.Values{}
+	postedData.Add("first_name", "John")
+	postedData.Add("last_name", "Smith")
+	postedData.Add("email", "john@smith.com")
+	postedData.Add("phone", "555-555-5555")
+
+	req, _ := http.NewRequest("POST", "/reservation", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	session.Put(ctx, "reservation", reservation)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostReservation).ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/deposit" {
+		t.Errorf("PostReservation returned %d to %s, wanted %d to /deposit", rr.Code, rr.Header().Get("Location"), http.StatusSeeOther)
+	}
+	if res, _ := session.Get(ctx, "reservation").(models.Reservation); res.PaymentDueAt.IsZero() {
+		t.Error("PostReservation did not set time to pay the deposit")
+	}
+
+	// deposit page starts a payment intent
+	req, _ = http.NewRequest("GET", "/deposit", nil)
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	session.Put(ctx, "reservation", reservation)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.Deposit).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Deposit returned %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	if session.GetString(ctx, "payment_intent") == "" {
+		t.Error("Deposit did not start a payment intent")
+	}
+
+	// deposit page without reservation
+	req, _ = http.NewRequest("GET", "/deposit", nil)
+	req = req.WithContext(getCtx(req))
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.Deposit).ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/" {
+		t.Errorf("Deposit without reservation returned %d to %s", rr.Code, rr.Header().Get("Location"))
+	}
+
+	var postTests = []struct {
+		name               string
+		reservationID      int
+		paymentMethod      string
+		withIntent         bool
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"paid", 1, payments.FakeCardOK, true, http.StatusSeeOther, "/reservationsummary"},
+		{"declined", 1, payments.FakeCardDeclined, true, http.StatusSeeOther, "/deposit"},
+		{"no intent", 1, payments.FakeCardOK, false, http.StatusSeeOther, "/deposit"},
+		{"ledger fails", 6, payments.FakeCardOK, true, http.StatusInternalServerError, ""},
+		{"cancelled meanwhile", 5, payments.FakeCardOK, true, http.StatusSeeOther, "/"},
+		{"no such reservation", 101, payments.FakeCardOK, true, http.StatusInternalServerError, ""},
+	}
+	for _, e := range postTests {
+		postedData := url.Values{}
+		postedData.Add("payment_method", e.paymentMethod)
+		req, _ := http.NewRequest("POST", "/deposit", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		reservation.ID = e.reservationID
+		session.Put(ctx, "reservation", reservation)
+		if e.withIntent {
+			intent, _ := appCnf.Payments.CreateIntent(60, strconv.Itoa(e.reservationID))
+			session.Put(ctx, "payment_intent", intent.ID)
+		}
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.PostDeposit).ServeHTTP(rr, req)
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if loc := rr.Header().Get("Location"); loc != e.expectedLocation {
+			t.Errorf("for %s expected redirect to %s but got %s", e.name, e.expectedLocation, loc)
+		}
+	}
+
+	// time to pay ran out before the sweeper cancelled the reservation
+	reservation.ID = 1
+	reservation.PaymentDueAt = time.Now().Add(-time.Minute)
+	for _, handler := range []http.HandlerFunc{Repo.Deposit, Repo.PostDeposit} {
+		postedData := url.Values{}
+		postedData.Add("payment_method", payments.FakeCardOK)
+		req, _ := http.NewRequest("POST", "/deposit", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		session.Put(ctx, "reservation", reservation)
+		session.Put(ctx, "payment_intent", "fake_pi_1")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/" {
+			t.Errorf("expired deposit returned %d to %s, wanted %d to /", rr.Code, rr.Header().Get("Location"), http.StatusSeeOther)
+		}
+		if session.Exists(ctx, "reservation") {
+			t.Error("expired reservation was left in session")
+		}
+	}
+}
+
+func TestRepository_ExpireUnpaidReservations(t *testing.T) {
+	expired, err := Repo.ExpireUnpaidReservations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// reservation 6 was paid after it was listed
+	if expired != 2 {
+		t.Errorf("expected 2 reservations cancelled but got %d", expired)
+	}
+}
+
+func TestRepository_PaymentWebhook(t *testing.T) {
+	fake := appCnf.Payments.(*payments.Fake)
+
+	var webhookTests = []struct {
+		name               string
+		payload            string
+		signed             bool
+		expectedStatusCode int
+	}{
+		{"payment", `{"type":"payment.succeeded","intent_id":"fake_pi_9","reference":"1","amount":60}`, true, http.StatusOK},
+		{"payment of pending reservation", `{"type":"payment.succeeded","intent_id":"fake_pi_9","reference":"9","amount":60}`, true, http.StatusOK},
+		{"refund", `{"type":"payment.refunded","intent_id":"fake_pi_9","refund_id":"fake_re_10","reference":"1","amount":20}`, true, http.StatusOK},
+		{"other event", `{"type":"payment.created","intent_id":"fake_pi_9","reference":"1","amount":60}`, true, http.StatusOK},
+		{"not signed", `{"type":"payment.succeeded","intent_id":"fake_pi_9","reference":"1","amount":60}`, false, http.StatusBadRequest},
+		{"bad reference", `{"type":"payment.succeeded","intent_id":"fake_pi_9","reference":"x","amount":60}`, true, http.StatusBadRequest},
+		{"voucher purchase", `{"type":"payment.succeeded","intent_id":"fake_pi_9","reference":"voucher","amount":60}`, true, http.StatusOK},
+		{"ledger fails", `{"type":"payment.succeeded","intent_id":"fake_pi_9","reference":"6","amount":60}`, true, http.StatusInternalServerError},
+		{"no such reservation", `{"type":"payment.succeeded","intent_id":"fake_pi_9","reference":"101","amount":60}`, true, http.StatusInternalServerError},
+	}
+
+	routes := getRoutes()
+	for _, e := range webhookTests {
+		req, _ := http.NewRequest("POST", "/payments/webhook", strings.NewReader(e.payload))
+		if e.signed {
+			req.Header.Set(payments.FakeSignatureHeader, fake.Sign([]byte(e.payload)))
+		}
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_PromoCodes(t *testing.T) {
+	reservation := models.Reservation{
+		RoomId:     1,
+		StartDate:  time.Now().AddDate(0, 0, 10),
+		EndDate:    time.Now().AddDate(0, 0, 12),
+		TotalPrice: 200,
+		Room: models.Room{
+			ID:       1,
+			RoomName: "Frost Suite",
+		},
+	}
+
+	var reservationTests = []struct {
+		name               string
+		code               string
+		expectedStatusCode int
+		expectedLocation   string
+		expectedTotal      float32
+	}{
+		{"no code", "", http.StatusSeeOther, "/deposit", 200},
+		{"valid", " summer ", http.StatusSeeOther, "/deposit", 180},
+		{"other room", "ROOM3", http.StatusOK, "", 200},
+		{"expired", "OLD", http.StatusOK, "", 200},
+		{"used up", "FULL", http.StatusOK, "", 200},
+		{"unknown", "NOPE", http.StatusOK, "", 200},
+		{"used up while booking", "RACE", http.StatusSeeOther, "/reservation", 200},
+		{"database error", "ERROR", http.StatusInternalServerError, "", 200},
+	}
+	for _, e := range reservationTests {
+		postedData := url.Values{}
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", "john@smith.com")
+		postedData.Add("promo_code", e.code)
+
+		req, _ := http.NewRequest("POST", "/reservation", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		session.Put(ctx, "reservation", reservation)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.PostReservation).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if e.expectedLocation != "" && rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("for %s expected location %s but got %s", e.name, e.expectedLocation, rr.Header().Get("Location"))
+		}
+		res, _ := session.Get(ctx, "reservation").(models.Reservation)
+		if res.TotalPrice != e.expectedTotal {
+			t.Errorf("for %s expected total %.2f but got %.2f", e.name, e.expectedTotal, res.TotalPrice)
+		}
+	}
+
+	// a moved reservation gets the discount of its code on the new price
+	res := reservation
+	res.PromoCodeID = 1
+	total, discount, err := Repo.discountedTotal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, _ := Repo.stayTotal(res.RoomId, res.StartDate, res.EndDate)
+	if discount != promo.Discount(models.PromoCode{Kind: models.PromoPercent, Value: 10}, full) || total != full-discount {
+		t.Errorf("wrong discounted total %.2f with discount %.2f of %.2f", total, discount, full)
+	}
+
+	// a reservation whose code was deleted keeps its discount
+	res.PromoCodeID = 0
+	res.DiscountAmount = 15
+	total, discount, _ = Repo.discountedTotal(res)
+	if discount != 15 || total != full-15 {
+		t.Errorf("deleted code gave total %.2f with discount %.2f", total, discount)
+	}
+
+	req, _ := http.NewRequest("GET", "/admin/promo-codes", nil)
+	req = req.WithContext(getCtx(req))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminPromoCodes).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminPromoCodes returned %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	var postTests = []struct {
+		name               string
+		code               string
+		kind               string
+		value              string
+		validTo            string
+		expectedStatusCode int
+	}{
+		{"valid", "winter", models.PromoPercent, "15", "2050-11-30", http.StatusSeeOther},
+		{"duplicate", "summer", models.PromoPercent, "15", "2050-11-30", http.StatusOK},
+		{"over 100 percent", "WINTER", models.PromoPercent, "150", "2050-11-30", http.StatusOK},
+		{"fixed over 100", "WINTER", models.PromoFixed, "150", "2050-11-30", http.StatusSeeOther},
+		{"unknown kind", "WINTER", "gift", "15", "2050-11-30", http.StatusOK},
+		{"ends before start", "WINTER", models.PromoFixed, "15", "2050-10-30", http.StatusOK},
+		{"missing code", "", models.PromoFixed, "15", "2050-11-30", http.StatusOK},
+		{"lookup fails", "ERROR", models.PromoFixed, "15", "2050-11-30", http.StatusInternalServerError},
+		{"insert fails", "FAIL", models.PromoFixed, "15", "2050-11-30", http.StatusInternalServerError},
+	}
+	for _, e := range postTests {
+		postedData := url.Values{}
+		postedData.Add("code", e.code)
+		postedData.Add("kind", e.kind)
+		postedData.Add("value", e.value)
+		postedData.Add("valid_from", "2050-11-01")
+		postedData.Add("valid_to", e.validTo)
+		postedData.Add("min_nights", "2")
+		postedData.Add("room_ids", "1")
+		postedData.Add("room_ids", "3")
+
+		req, _ := http.NewRequest("POST", "/admin/promo-codes", strings.NewReader(postedData.Encode()))
+		req = req.WithContext(getCtx(req))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostPromoCode).ServeHTTP(rr, req)
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+
+	// promo codes over 100 cannot be deleted in test repo
+	for id, expectError := range map[int]bool{1: false, 101: true} {
+		req, _ = http.NewRequest("POST", "/admin/delete-promo-code/"+strconv.Itoa(id), nil)
+		rr = httptest.NewRecorder()
+		getRoutes().ServeHTTP(rr, req)
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/promo-codes" {
+			t.Errorf("AdminDeletePromoCode %d returned %d to %s", id, rr.Code, rr.Header().Get("Location"))
+			continue
+		}
+		cookies := rr.Result().Cookies()
+		next, _ := http.NewRequest("GET", "/", nil)
+		ctx, _ := session.Load(next.Context(), cookies[0].Value)
+		if hasError := session.GetString(ctx, "error") != ""; hasError != expectError {
+			t.Errorf("AdminDeletePromoCode %d expected error %v but got %v", id, expectError, hasError)
+		}
+	}
+}
+
+func TestRepository_Vouchers(t *testing.T) {
+	reservation := models.Reservation{
+		RoomId:     1,
+		StartDate:  time.Now().AddDate(0, 0, 10),
+		EndDate:    time.Now().AddDate(0, 0, 12),
+		TotalPrice: 200,
+		Room: models.Room{
+			ID:       1,
+			RoomName: "Frost Suite",
+		},
+	}
+
+	var reservationTests = []struct {
+		name               string
+		code               string
+		total              float32
+		expectedStatusCode int
+		expectedLocation   string
+		expectedPaid       float32
+	}{
+		{"part of deposit", " gift-1111 ", 200, http.StatusSeeOther, "/deposit", 50},
+		{"whole deposit", "GIFT-1111", 100, http.StatusSeeOther, "/reservationsummary", 50},
+		{"whole price", "GIFT-1111", 40, http.StatusSeeOther, "/reservationsummary", 40},
+		{"expired", "GIFT-OLD", 200, http.StatusOK, "", 0},
+		{"spent", "GIFT-EMPTY", 200, http.StatusOK, "", 0},
+		{"unknown", "NOPE", 200, http.StatusOK, "", 0},
+		{"spent while booking", "GIFT-RACE", 200, http.StatusSeeOther, "/reservation", 0},
+		{"database error", "ERROR", 200, http.StatusInternalServerError, "", 0},
+	}
+	for _, e := range reservationTests {
+		postedData := url.Values{}
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", "john@smith.com")
+		postedData.Add("voucher_code", e.code)
+
+		res := reservation
+		res.TotalPrice = e.total
+		req, _ := http.NewRequest("POST", "/reservation", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		session.Put(ctx, "reservation", res)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.PostReservation).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if e.expectedLocation != "" && rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("for %s expected location %s but got %s", e.name, e.expectedLocation, rr.Header().Get("Location"))
+		}
+		res, _ = session.Get(ctx, "reservation").(models.Reservation)
+		if res.VoucherAmount != e.expectedPaid {
+			t.Errorf("for %s expected %.2f paid with voucher but got %.2f", e.name, e.expectedPaid, res.VoucherAmount)
+		}
+	}
+
+	// the deposit is what the voucher does not cover
+	res := reservation
+	res.VoucherAmount = 50
+	if d := Repo.depositFor(res); d != 10 {
+		t.Errorf("expected deposit 10.00 but got %.2f", d)
+	}
+
+	// cancelling returns voucher payments to the voucher
+	toCard, toVoucher, err := Repo.refundPayments(models.Reservation{ID: 10}, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if toCard != 0 || toVoucher != 50 {
+		t.Errorf("expected 50.00 back to voucher but got %.2f to card and %.2f to voucher", toCard, toVoucher)
+	}
+
+	// the fake provider moves no money, so vouchers are not sold through it
+	postedData := url.Values{}
+	postedData.Add("amount", "100")
+	postedData.Add("recipient_name", "Laura Palmer")
+	postedData.Add("buyer_name", "Dale Cooper")
+	postedData.Add("buyer_email", "dale@here.com")
+	postedData.Add("payment_method", payments.FakeCardOK)
+	req, _ := http.NewRequest("POST", "/vouchers", strings.NewReader(postedData.Encode()))
+	req = req.WithContext(getCtx(req))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.PostVoucher).ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/vouchers" {
+		t.Errorf("voucher bought through fake provider: got %d to %s", rr.Code, rr.Header().Get("Location"))
+	}
+
+	fake := appCnf.Payments
+	appCnf.Payments = livePayments{fake.(*payments.Fake)}
+	defer func() { appCnf.Payments = fake }()
+
+	var purchaseTests = []struct {
+		name               string
+		amount             string
+		recipient          string
+		paymentMethod      string
+		expectedStatusCode int
+	}{
+		{"bought", "100", "Laura Palmer", payments.FakeCardOK, http.StatusSeeOther},
+		{"declined", "100", "Laura Palmer", payments.FakeCardDeclined, http.StatusOK},
+		{"too small", "5", "Laura Palmer", payments.FakeCardOK, http.StatusOK},
+		{"not a number", "lots", "Laura Palmer", payments.FakeCardOK, http.StatusOK},
+		{"no recipient", "100", "", payments.FakeCardOK, http.StatusOK},
+		{"insert fails", "100", "FAIL", payments.FakeCardOK, http.StatusInternalServerError},
+	}
+	for _, e := range purchaseTests {
+		postedData := url.Values{}
+		postedData.Add("amount", e.amount)
+		postedData.Add("recipient_name", e.recipient)
+		postedData.Add("buyer_name", "Dale Cooper")
+		postedData.Add("buyer_email", "dale@here.com")
+		postedData.Add("payment_method", e.paymentMethod)
+
+		req, _ := http.NewRequest("POST", "/vouchers", strings.NewReader(postedData.Encode()))
+		req = req.WithContext(getCtx(req))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.PostVoucher).ServeHTTP(rr, req)
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if rr.Code == http.StatusSeeOther && !strings.HasPrefix(rr.Header().Get("Location"), "/voucher/") {
+			t.Errorf("for %s expected redirect to the voucher but got %s", e.name, rr.Header().Get("Location"))
+		}
+	}
+
+	v := models.Voucher{ID: 1, ExpiresAt: time.Now().AddDate(1, 0, 0)}
+	var pageTests = []struct {
+		name               string
+		url                string
+		expectedStatusCode int
+	}{
+		{"purchase page", "/vouchers", http.StatusOK},
+		{"printable voucher", Repo.voucherPath(v), http.StatusOK},
+		{"booking link", "/voucher/" + signedlink.Sign(appCnf.SigningKey, 1, time.Now().AddDate(1, 0, 0)), http.StatusSeeOther},
+		{"expired link", "/voucher/" + signedlink.Sign(Repo.voucherKey(), 1, time.Now().AddDate(0, 0, -1)), http.StatusSeeOther},
+		{"admin list", "/admin/vouchers", http.StatusOK},
+		{"admin show", "/admin/vouchers/1", http.StatusOK},
+		{"admin show missing", "/admin/vouchers/101", http.StatusInternalServerError},
+		{"admin print", "/admin/vouchers/1/print", http.StatusOK},
+	}
+	routes := getRoutes()
+	for _, e := range pageTests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+
+	var adminTests = []struct {
+		name               string
+		code               string
+		amount             string
+		recipient          string
+		email              string
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"random code", "", "100", "Laura Palmer", "", http.StatusSeeOther, "/admin/vouchers/5"},
+		{"own code emailed", "xmas-2050", "100", "Laura Palmer", "dale@here.com", http.StatusSeeOther, "/admin/vouchers/5"},
+		{"code in use", "gift-1111", "100", "Laura Palmer", "", http.StatusOK, ""},
+		{"no amount", "", "0", "Laura Palmer", "", http.StatusOK, ""},
+		{"bad email", "", "100", "Laura Palmer", "dale", http.StatusOK, ""},
+		{"lookup fails", "ERROR", "100", "Laura Palmer", "", http.StatusInternalServerError, ""},
+		{"insert fails", "", "100", "FAIL", "", http.StatusInternalServerError, ""},
+	}
+	for _, e := range adminTests {
+		postedData := url.Values{}
+		postedData.Add("code", e.code)
+		postedData.Add("amount", e.amount)
+		postedData.Add("expires_at", "2050-11-30")
+		postedData.Add("recipient_name", e.recipient)
+		postedData.Add("buyer_email", e.email)
+
+		req, _ := http.NewRequest("POST", "/admin/vouchers", strings.NewReader(postedData.Encode()))
+		req = req.WithContext(getCtx(req))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostVoucher).ServeHTTP(rr, req)
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if e.expectedLocation != "" && rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("for %s expected location %s but got %s", e.name, e.expectedLocation, rr.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRepository_Extras(t *testing.T) {
+	reservation := models.Reservation{
+		RoomId:     1,
+		StartDate:  time.Now().AddDate(0, 0, 10),
+		EndDate:    time.Now().AddDate(0, 0, 12),
+		Adults:     2,
+		TotalPrice: 200,
+		Room: models.Room{
+			ID:       1,
+			RoomName: "Frost Suite",
+		},
+	}
+
+	var reservationTests = []struct {
+		name               string
+		roomID             int
+		extras             []string
+		expectedStatusCode int
+		expectedTotal      float32
+		expectedLines      int
+	}{
+		{"no extras", 1, nil, http.StatusSeeOther, 200, 0},
+		{"breakfast and tour", 1, []string{"1", "2"}, http.StatusSeeOther, 200 + 2*12.5 + 2*89, 2},
+		{"sauna not for this room", 1, []string{"3"}, http.StatusSeeOther, 200, 0},
+		{"sauna for room 3", 3, []string{"3", "junk"}, http.StatusSeeOther, 240, 1},
+		{"extras cannot be read", 99, []string{"1"}, http.StatusInternalServerError, 200, 0},
+	}
+	for _, e := range reservationTests {
+		postedData := url.Values{}
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", "john@smith.com")
+		for _, x := range e.extras {
+			postedData.Add("extras", x)
+		}
+
+		res := reservation
+		res.RoomId = e.roomID
+		req, _ := http.NewRequest("POST", "/reservation", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		session.Put(ctx, "reservation", res)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.PostReservation).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		res, _ = session.Get(ctx, "reservation").(models.Reservation)
+		if res.TotalPrice != e.expectedTotal {
+			t.Errorf("for %s expected total %.2f but got %.2f", e.name, e.expectedTotal, res.TotalPrice)
+		}
+		if len(res.Extras) != e.expectedLines {
+			t.Errorf("for %s expected %d extras but got %d", e.name, e.expectedLines, len(res.Extras))
+		}
+	}
+
+	var getTests = []struct {
+		name               string
+		url                string
+		expectedStatusCode int
+	}{
+		{"list", "/admin/extras", http.StatusOK},
+		{"edit", "/admin/extras/1", http.StatusOK},
+		{"edit unknown", "/admin/extras/101", http.StatusInternalServerError},
+	}
+	for _, e := range getTests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		req = req.WithContext(getCtx(req))
+		rr := httptest.NewRecorder()
+		getRoutes().ServeHTTP(rr, req)
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+
+	var postTests = []struct {
+		name               string
+		url                string
+		extraName          string
+		price              string
+		unit               string
+		expectedStatusCode int
+	}{
+		{"create", "/admin/extras", "Sauna evening", "40", models.ExtraPerStay, http.StatusSeeOther},
+		{"update", "/admin/extras/1", "Breakfast", "13.5", models.ExtraPerNight, http.StatusSeeOther},
+		{"free", "/admin/extras", "Towels", "0", models.ExtraPerPerson, http.StatusSeeOther},
+		{"unknown unit", "/admin/extras", "Sauna evening", "40", "hour", http.StatusOK},
+		{"negative price", "/admin/extras", "Sauna evening", "-40", models.ExtraPerStay, http.StatusOK},
+		{"missing name", "/admin/extras/1", "", "40", models.ExtraPerStay, http.StatusOK},
+		{"update unknown", "/admin/extras/101", "Breakfast", "13.5", models.ExtraPerNight, http.StatusInternalServerError},
+		{"insert fails", "/admin/extras", "FAIL", "40", models.ExtraPerStay, http.StatusInternalServerError},
+		{"update fails", "/admin/extras/1", "FAIL", "40", models.ExtraPerStay, http.StatusInternalServerError},
+	}
+	for _, e := range postTests {
+		postedData := url.Values{}
+		postedData.Add("name", e.extraName)
+		postedData.Add("price", e.price)
+		postedData.Add("unit", e.unit)
+		postedData.Add("vat_rate", "25.5")
+		postedData.Add("room_ids", "3")
+
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader(postedData.Encode()))
+		req = req.WithContext(getCtx(req))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		getRoutes().ServeHTTP(rr, req)
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if rr.Code == http.StatusSeeOther && rr.Header().Get("Location") != "/admin/extras" {
+			t.Errorf("for %s expected location /admin/extras but got %s", e.name, rr.Header().Get("Location"))
+		}
+	}
+
+	// extras over 100 cannot be deleted in test repo
+	for id, expectError := range map[int]bool{1: false, 101: true} {
+		req, _ := http.NewRequest("POST", "/admin/delete-extra/"+strconv.Itoa(id), nil)
+		rr := httptest.NewRecorder()
+		getRoutes().ServeHTTP(rr, req)
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/extras" {
+			t.Errorf("AdminDeleteExtra %d returned %d to %s", id, rr.Code, rr.Header().Get("Location"))
+			continue
+		}
+		cookies := rr.Result().Cookies()
+		next, _ := http.NewRequest("GET", "/", nil)
+		ctx, _ := session.Load(next.Context(), cookies[0].Value)
+		if hasError := session.GetString(ctx, "error") != ""; hasError != expectError {
+			t.Errorf("AdminDeleteExtra %d expected error %v but got %v", id, expectError, hasError)
+		}
+	}
+}
+
+func TestRepository_Housekeeping(t *testing.T) {
+	var getTests = []struct {
+		name string
+		url  string
+	}{
+		{"today", "/admin/housekeeping"},
+		{"my tasks of a day", "/admin/housekeeping?date=2050-11-15&mine=1"},
+		{"invalid date", "/admin/housekeeping?date=junk"},
+	}
+	for _, e := range getTests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		req = req.WithContext(getCtx(req))
+		rr := httptest.NewRecorder()
+		getRoutes().ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Errorf("for %s expected code %d but got %d", e.name, http.StatusOK, rr.Code)
+		}
+	}
+
+	// room 1 is clean, 2 dirty, 3 inspected, 4 changes while the form is open and 99 cannot be saved
+	var postTests = []struct {
+		name               string
+		url                string
+		roomID             string
+		field              string
+		value              string
+		mine               bool
+		expectedStatusCode int
+		expectError        bool
+	}{
+		{"start cleaning", "/admin/housekeeping/status", "2", "status", models.RoomCleaning, false, http.StatusSeeOther, false},
+		{"inspected room dirty again", "/admin/housekeeping/status", "3", "status", models.RoomDirty, true, http.StatusSeeOther, false},
+		{"clean room cleaned again", "/admin/housekeeping/status", "1", "status", models.RoomCleaning, false, http.StatusSeeOther, true},
+		{"unknown status", "/admin/housekeeping/status", "1", "status", "sparkling", false, http.StatusSeeOther, true},
+		{"changed meanwhile", "/admin/housekeeping/status", "4", "status", models.RoomClean, false, http.StatusSeeOther, true},
+		{"status not saved", "/admin/housekeeping/status", "99", "status", models.RoomClean, false, http.StatusInternalServerError, false},
+		{"no such room", "/admin/housekeeping/status", "101", "status", models.RoomDirty, false, http.StatusInternalServerError, false},
+		{"assign", "/admin/housekeeping/assign", "1", "user_id", "2", true, http.StatusSeeOther, false},
+		{"unassign", "/admin/housekeeping/assign", "1", "user_id", "0", false, http.StatusSeeOther, false},
+		{"assign to other user", "/admin/housekeeping/assign", "1", "user_id", "5", false, http.StatusSeeOther, true},
+		{"assignment not saved", "/admin/housekeeping/assign", "101", "user_id", "2", false, http.StatusInternalServerError, false},
+	}
+
+	routes := getRoutes()
+	for _, e := range postTests {
+		postedData := url.Values{}
+		postedData.Add("date", "2050-11-15")
+		postedData.Add("room_id", e.roomID)
+		postedData.Add(e.field, e.value)
+		expectedLocation := "/admin/housekeeping?date=2050-11-15"
+		if e.mine {
+			postedData.Add("mine", "1")
+			expectedLocation += "&mine=1"
+		}
+
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader(postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if e.expectedStatusCode != http.StatusSeeOther {
+			continue
+		}
+		if loc := rr.Header().Get("Location"); loc != expectedLocation {
+			t.Errorf("for %s expected redirect to %s but got %s", e.name, expectedLocation, loc)
+		}
+
+		cookies := rr.Result().Cookies()
+		if len(cookies) == 0 {
+			t.Errorf("for %s expected a session cookie", e.name)
+			continue
+		}
+		next, _ := http.NewRequest("GET", "/", nil)
+		next.AddCookie(cookies[0])
+		ctx, _ := session.Load(next.Context(), cookies[0].Value)
+		hasError := session.GetString(ctx, "error") != ""
+		if hasError != e.expectError {
+			t.Errorf("for %s expected error %v but got %v", e.name, e.expectError, hasError)
+		}
+	}
+}
+
+func TestRepository_AdminAPITokens(t *testing.T) {
+	var tokenTests = []struct {
+		name               string
+		method             string
+		handler            http.HandlerFunc
+		userID             int
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"list", "GET", Repo.AdminAPITokens, 1, http.StatusOK, ""},
+		{"list logged out", "GET", Repo.AdminAPITokens, 0, http.StatusSeeOther, "/user/login"},
+		{"create", "POST", Repo.AdminPostAPIToken, 1, http.StatusOK, ""},
+		{"create logged out", "POST", Repo.AdminPostAPIToken, 0, http.StatusSeeOther, "/user/login"},
+		{"revoke", "POST", Repo.AdminDeleteAPIToken, 1, http.StatusSeeOther, "/admin/api-tokens"},
+		{"revoke logged out", "POST", Repo.AdminDeleteAPIToken, 0, http.StatusSeeOther, "/user/login"},
+	}
+	for _, e := range tokenTests {
+		postedData := url.Values{}
+		postedData.Add("name", "channel manager")
+
+		req, _ := http.NewRequest(e.method, "/admin/api-tokens", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if e.userID != 0 {
+			session.Put(ctx, "user_id", e.userID)
+		}
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected code %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if loc := rr.Header().Get("Location"); loc != e.expectedLocation {
+			t.Errorf("for %s expected redirect to %s but got %s", e.name, e.expectedLocation, loc)
+		}
+	}
+}
+
 func getCtx(req *http.Request) context.Context {
 	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
 	if err != nil {
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/helpers"
+	"github.com/t-Ikonen/bbbookingsystem/internal/housekeeping"
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/render"
+	"github.com/t-Ikonen/bbbookingsystem/internal/repository"
+)
+
+//housekeepingPath returns the housekeeping list of day, only the tasks of the logged in user when mine is set
+func housekeepingPath(day time.Time, mine bool) string {
+	q := url.Values{}
+	q.Set("date", day.Format("2006-01-02"))
+	if mine {
+		q.Set("mine", "1")
+	}
+	return "/admin/housekeeping?" + q.Encode()
+}
+
+//housekeepingDay returns the day in value, today if value is not a date
+func housekeepingDay(value string) time.Time {
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		now := time.Now()
+		day = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+//markDirty marks the room of a departing guest dirty for housekeeping.
+//Failing to mark is logged but does not stop the check-out
+func (m *Repository) markDirty(r *http.Request, roomID int) {
+	s, err := m.DB.GetRoomStatus(roomID)
+	if err == nil && s.Status != models.RoomDirty {
+		err = m.DB.UpdateRoomStatus(roomID, s.Status, models.RoomDirty, m.App.Session.GetInt(r.Context(), "user_id"))
+	}
+	if err != nil {
+		m.App.ErrorLog.Println("cannot mark room dirty:", err)
+	}
+}
+
+//AdminHousekeeping lists the cleaning tasks of the day in query, today by default, with room statuses and assigned users
+func (m *Repository) AdminHousekeeping(w http.ResponseWriter, r *http.Request) {
+	day := housekeepingDay(r.URL.Query().Get("date"))
+	mine := r.URL.Query().Get("mine") != ""
+	userID := m.App.Session.GetInt(r.Context(), "user_id")
+
+	stays, err := m.DB.StaysOn(day)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	statuses, err := m.DB.RoomStatuses()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	assigned, err := m.DB.HousekeepingAssignments(day)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	users, err := m.DB.HousekeepingUsers()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	byRoom := make(map[int]string)
+	for _, s := range statuses {
+		byRoom[s.RoomID] = s.Status
+	}
+	var tasks []models.HousekeepingTask
+	hasTask := make(map[int]bool)
+	for _, t := range housekeeping.Tasks(day, stays) {
+		hasTask[t.RoomID] = true
+		t.Status = byRoom[t.RoomID]
+		t.AssignedTo = assigned[t.RoomID]
+		if mine && t.AssignedTo != userID {
+			continue
+		}
+		tasks = append(tasks, t)
+	}
+	// rooms without a task can still need cleaning, the list of one user has only their tasks
+	var otherRooms []models.RoomStatus
+	if !mine {
+		for _, s := range statuses {
+			if !hasTask[s.RoomID] {
+				otherRooms = append(otherRooms, s)
+			}
+		}
+	}
+
+	userNames := make(map[int]string)
+	for _, u := range users {
+		userNames[u.ID] = u.FirstName + " " + u.LastName
+	}
+
+	data := make(map[string]interface{})
+	data["tasks"] = tasks
+	data["other_rooms"] = otherRooms
+	data["users"] = users
+	data["user_names"] = userNames
+
+	stringMap := make(map[string]string)
+	stringMap["date"] = day.Format("2006-01-02")
+	stringMap["day"] = day.Format("Mon 02-01-2006")
+	stringMap["previous"] = housekeepingPath(day.AddDate(0, 0, -1), mine)
+	stringMap["next"] = housekeepingPath(day.AddDate(0, 0, 1), mine)
+	stringMap["all"] = housekeepingPath(day, false)
+	stringMap["mine"] = housekeepingPath(day, true)
+	if mine {
+		stringMap["only_mine"] = "1"
+	}
+
+	render.Template(w, "adminhousekeeping.page.tmpl.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	}, r)
+}
+
+//AdminPostRoomStatus changes the housekeeping status of a room if housekeeping allows it
+func (m *Repository) AdminPostRoomStatus(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
+	to := r.Form.Get("status")
+	back := housekeepingPath(housekeepingDay(r.Form.Get("date")), r.Form.Get("mine") != "")
+
+	before, err := m.DB.GetRoomStatus(roomID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	err = housekeeping.Check(before.Status, to)
+	if err == nil {
+		err = m.DB.UpdateRoomStatus(roomID, before.Status, to, m.App.Session.GetInt(r.Context(), "user_id"))
+	}
+	if errors.Is(err, housekeeping.ErrTransition) || errors.Is(err, repository.ErrRoomStatusChanged) {
+		m.App.Session.Put(r.Context(), "error", "Cannot change room status: "+err.Error())
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	after := before
+	after.Status = to
+	m.audit(r, "status", "room_status", roomID, before, after)
+
+	m.App.Session.Put(r.Context(), "flash", before.Room.RoomName+" is now "+housekeeping.Label(to)+".")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+//AdminPostHousekeepingAssign gives the cleaning task of a room on a day to a housekeeping user, or to nobody
+func (m *Repository) AdminPostHousekeepingAssign(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	day := housekeepingDay(r.Form.Get("date"))
+	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
+	userID, _ := strconv.Atoi(r.Form.Get("user_id"))
+	back := housekeepingPath(day, r.Form.Get("mine") != "")
+
+	if userID != 0 {
+		users, err := m.DB.HousekeepingUsers()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		found := false
+		for _, u := range users {
+			found = found || u.ID == userID
+		}
+		if !found {
+			m.App.Session.Put(r.Context(), "error", "Tasks can only be given to housekeeping users")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+	}
+
+	err = m.DB.AssignHousekeeping(day, roomID, userID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.audit(r, "assign", "room_status", roomID, nil, map[string]interface{}{
+		"date":    day.Format("2006-01-02"),
+		"user_id": userID,
+	})
+
+	m.App.Session.Put(r.Context(), "flash", "Task assigned.")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
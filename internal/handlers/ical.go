@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/t-Ikonen/bbbookingsystem/internal/forms"
+	"github.com/t-Ikonen/bbbookingsystem/internal/helpers"
+	"github.com/t-Ikonen/bbbookingsystem/internal/ical"
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/render"
+)
+
+const (
+	//icalMonths is how far ahead the room calendar feed reaches
+	icalMonths = 12
+	//maxICalUpload limits uploaded .ics files
+	maxICalUpload = 1 << 20
+	//icalFetchTimeout limits fetching one external calendar
+	icalFetchTimeout = 20 * time.Second
+)
+
+//icalUID is the stable UID of a room restriction in calendar feeds
+func icalUID(restrictionID int) string {
+	return fmt.Sprintf("rr-%d@blacklodge.xyz", restrictionID)
+}
+
+//RoomICal serves the iCalendar feed of a room's reservations and owner blocks, the URL token is the secret
+func (m *Repository) RoomICal(w http.ResponseWriter, r *http.Request) {
+	room, err := m.DB.GetRoomByICalToken(chi.URLParam(r, "token"))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	restrictions, err := m.DB.GetRestrictionsForRoomByDate(room.ID, today, today.AddDate(0, icalMonths, 0))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var events []ical.Event
+	for _, x := range restrictions {
+		// blocks imported from other channels are not sent back to them
+		if x.ImportID != 0 {
+			continue
+		}
+		// holds are short lived and not pushed to other channels
+		summary := "Reserved"
+		switch x.RestrictionId {
+		case models.RestrictionReservation:
+		case models.RestrictionOwnerBlock:
+			summary = "Blocked"
+		default:
+			continue
+		}
+		events = append(events, ical.Event{
+			UID:     icalUID(x.ID),
+			Start:   x.StartDate,
+			End:     x.EndDate,
+			Summary: summary,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	err = ical.Write(w, room.RoomName, events, now)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+}
+
+//AdminNewICalToken gives a room a new calendar feed URL
+func (m *Repository) AdminNewICalToken(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	err := m.DB.UpdateRoomICalToken(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.audit(r, "new_ical_token", "room", id, nil, nil)
+	m.App.Session.Put(r.Context(), "flash", "New calendar feed URL created, the old one no longer works.")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d", id), http.StatusSeeOther)
+}
+
+//SyncICalImport mirrors one external calendar as owner blocks of its room, returns the number of blocks mirrored
+func (m *Repository) SyncICalImport(client *http.Client, imp models.ICalImport) (int, error) {
+	var events []ical.Event
+	var err error
+	if imp.URL != "" {
+		events, err = ical.Fetch(client, imp.URL)
+	} else {
+		events, err = ical.Parse(strings.NewReader(imp.Data))
+	}
+	if err != nil {
+		_ = m.DB.UpdateICalImportStatus(imp.ID, err.Error())
+		return 0, err
+	}
+
+	var blocks []models.RoomRestriction
+	for _, e := range events {
+		blocks = append(blocks, models.RoomRestriction{
+			StartDate:     e.Start,
+			EndDate:       e.End,
+			RoomId:        imp.RoomID,
+			RestrictionId: models.RestrictionOwnerBlock,
+			ImportID:      imp.ID,
+			ExternalUID:   e.UID,
+		})
+	}
+
+	skipped, err := m.DB.SyncImportedBlocks(imp.ID, imp.RoomID, blocks)
+	if err != nil {
+		_ = m.DB.UpdateICalImportStatus(imp.ID, err.Error())
+		return 0, err
+	}
+
+	status := ""
+	if skipped > 0 {
+		status = fmt.Sprintf("%d events overlap bookings of this room and were not imported", skipped)
+	}
+	err = m.DB.UpdateICalImportStatus(imp.ID, status)
+	if err != nil {
+		return 0, err
+	}
+	return len(blocks) - skipped, nil
+}
+
+//SyncICalImports mirrors all external calendars, a failing calendar does not stop the others
+func (m *Repository) SyncICalImports(client *http.Client) {
+	imports, err := m.DB.AllICalImports()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		return
+	}
+	for _, imp := range imports {
+		_, err := m.SyncICalImport(client, imp)
+		if err != nil {
+			m.App.ErrorLog.Println("calendar import", imp.ID, err)
+		}
+	}
+}
+
+//AdminICalImports shows external calendars of rooms
+func (m *Repository) AdminICalImports(w http.ResponseWriter, r *http.Request) {
+	m.renderICalImports(w, r, forms.New(nil))
+}
+
+//renderICalImports renders the calendar imports page with given form
+func (m *Repository) renderICalImports(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	imports, err := m.DB.AllICalImports()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	data := make(map[string]interface{})
+	data["imports"] = imports
+	data["rooms"] = rooms
+	render.Template(w, "adminicalimports.page.tmpl.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	}, r)
+}
+
+//AdminPostICalImport adds an external calendar by URL or uploaded .ics file and imports it right away
+func (m *Repository) AdminPostICalImport(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(maxICalUpload)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		helpers.ServerError(w, err)
+		return
+	}
+	if errors.Is(err, http.ErrNotMultipart) {
+		err = r.ParseForm()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("room_id", "name")
+
+	imp := models.ICalImport{
+		Name: r.Form.Get("name"),
+		URL:  strings.TrimSpace(r.Form.Get("url")),
+	}
+	imp.RoomID, _ = strconv.Atoi(r.Form.Get("room_id"))
+
+	file, _, err := r.FormFile("file")
+	if err == nil {
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, maxICalUpload))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		imp.Data = string(data)
+	}
+
+	switch {
+	case imp.URL == "" && imp.Data == "":
+		form.Errors.Add("url", "Give a calendar URL or upload an .ics file")
+	case imp.URL != "" && imp.Data != "":
+		form.Errors.Add("url", "Give either a URL or a file, not both")
+	case imp.URL != "" && !strings.HasPrefix(imp.URL, "http://") && !strings.HasPrefix(imp.URL, "https://"):
+		form.Errors.Add("url", "URL must start with http:// or https://")
+	}
+	if imp.Data != "" {
+		_, err := ical.Parse(strings.NewReader(imp.Data))
+		if err != nil {
+			form.Errors.Add("file", err.Error())
+		}
+	}
+
+	if !form.Valid() {
+		m.renderICalImports(w, r, form)
+		return
+	}
+
+	imp.ID, err = m.DB.InsertICalImport(imp)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.audit(r, "create", "ical_import", imp.ID, nil, map[string]interface{}{
+		"room_id": imp.RoomID,
+		"name":    imp.Name,
+		"url":     imp.URL,
+	})
+
+	imported, err := m.SyncICalImport(NewICalClient(), imp)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "warning", "Calendar added but importing failed: "+err.Error())
+	} else {
+		m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Calendar added, %d blocks imported.", imported))
+	}
+	http.Redirect(w, r, "/admin/ical-imports", http.StatusSeeOther)
+}
+
+//AdminSyncICalImports imports all external calendars now
+func (m *Repository) AdminSyncICalImports(w http.ResponseWriter, r *http.Request) {
+	m.SyncICalImports(NewICalClient())
+	m.audit(r, "sync", "ical_import", 0, nil, nil)
+	m.App.Session.Put(r.Context(), "flash", "Calendars imported.")
+	http.Redirect(w, r, "/admin/ical-imports", http.StatusSeeOther)
+}
+
+//AdminDeleteICalImport removes an external calendar and its blocks
+func (m *Repository) AdminDeleteICalImport(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	imp, _ := m.DB.GetICalImportByID(id)
+	if err := m.DB.DeleteICalImport(id); err == nil {
+		m.audit(r, "delete", "ical_import", id, map[string]interface{}{
+			"room_id": imp.RoomID,
+			"name":    imp.Name,
+			"url":     imp.URL,
+		}, nil)
+	}
+	go m.notifyWaitlist()
+	m.App.Session.Put(r.Context(), "flash", "Calendar removed.")
+	http.Redirect(w, r, "/admin/ical-imports", http.StatusSeeOther)
+}
+
+//NewICalClient returns the HTTP client used to fetch external calendars
+func NewICalClient() *http.Client {
+	return &http.Client{Timeout: icalFetchTimeout}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/t-Ikonen/bbbookingsystem/internal/helpers"
+	"github.com/t-Ikonen/bbbookingsystem/internal/invoice"
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/render"
+)
+
+//AdminCreateInvoice creates the invoice of a reservation in admin tool, a reservation is invoiced only once
+func (m *Repository) AdminCreateInvoice(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	src := chi.URLParam(r, "src")
+	back := fmt.Sprintf("/admin/reservations/%s/%d", src, id)
+
+	res, err := m.DB.GetReservationById(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if res.Cancelled() {
+		m.App.Session.Put(r.Context(), "error", "Cancelled reservation is not invoiced")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	invoices, err := m.DB.InvoicesForReservation(res.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if len(invoices) > 0 {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Reservation is already invoiced with invoice %d", invoices[0].Number))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	inv, err := m.DB.InsertInvoice(invoice.ForReservation(res, m.App.Seller, time.Now()))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.audit(r, "create", "invoice", inv.ID, nil, inv)
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Invoice %d created.", inv.Number))
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+//AdminShowInvoice shows an invoice as printable page in admin tool
+func (m *Repository) AdminShowInvoice(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	inv, err := m.invoiceWithPayments(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["invoice"] = inv
+	data["vat"] = invoice.Breakdown(inv.Lines)
+	stringMap := make(map[string]string)
+	stringMap["reference"] = invoice.Reference(inv.Number)
+	render.Template(w, "invoice.page.tmpl.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	}, r)
+}
+
+//AdminInvoicePDF downloads an invoice as PDF in admin tool
+func (m *Repository) AdminInvoicePDF(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	inv, err := m.invoiceWithPayments(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	err = invoice.PDF(&buf, inv)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, invoiceFileName(inv)))
+	w.Write(buf.Bytes())
+}
+
+//AdminEmailInvoice emails an invoice as PDF attachment to the guest in admin tool
+func (m *Repository) AdminEmailInvoice(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	src := chi.URLParam(r, "src")
+	inv, err := m.invoiceWithPayments(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	err = invoice.PDF(&buf, inv)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.MailChan <- models.MailData{
+		To:       inv.BuyerEmail,
+		From:     inv.Seller.Email,
+		Subject:  fmt.Sprintf("Invoice %d", inv.Number),
+		Message:  invoiceMessage(inv),
+		Template: "basic.html",
+		Attachments: []models.MailAttachment{
+			{Name: invoiceFileName(inv), MimeType: "application/pdf", Data: buf.Bytes()},
+		},
+	}
+	m.audit(r, "email", "invoice", inv.ID, nil, map[string]string{"to": inv.BuyerEmail})
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Invoice %d emailed to %s.", inv.Number, inv.BuyerEmail))
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%s/%d", src, inv.ReservationID), http.StatusSeeOther)
+}
+
+//invoiceWithPayments returns an invoice with what is paid of its reservation so far
+func (m *Repository) invoiceWithPayments(id int) (models.Invoice, error) {
+	inv, err := m.DB.GetInvoiceById(id)
+	if err != nil {
+		return inv, err
+	}
+	ledger, err := m.DB.PaymentsForReservation(inv.ReservationID)
+	if err != nil {
+		return inv, err
+	}
+	invoice.SetPaid(&inv, ledger)
+	return inv, nil
+}
+
+//invoiceMessage returns the email sent with invoice inv, deposits and gift vouchers paid are taken off the sum to pay
+func invoiceMessage(inv models.Invoice) string {
+	toPay := inv.Total
+	paid := ""
+	if inv.Paid > 0 {
+		toPay = inv.Outstanding
+		paid = fmt.Sprintf(" You have paid %s of it already.", render.Price(inv.Paid))
+	}
+	payment := fmt.Sprintf("Please pay %s by %s to account %s using reference %s.",
+		render.Price(toPay), inv.DueDate.Format("02-01-2006"), inv.Seller.IBAN, invoice.Reference(inv.Number))
+	if toPay <= 0 {
+		payment = "The invoice is paid in full, there is nothing left to pay."
+	}
+	return fmt.Sprintf(`
+		<strong>Invoice %d</strong><br><br>
+		Dear %s, <br><hr>
+		Thank you for staying with us. Your invoice of %s is attached.%s<br>
+		%s
+		`, inv.Number, inv.BuyerName, render.Price(inv.Total), paid, payment)
+}
+
+//invoiceFileName returns file name of an invoice PDF
+func invoiceFileName(inv models.Invoice) string {
+	return fmt.Sprintf("invoice-%d.pdf", inv.Number)
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/helpers"
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/payments"
+	"github.com/t-Ikonen/bbbookingsystem/internal/render"
+	"github.com/t-Ikonen/bbbookingsystem/internal/repository"
+)
+
+//depositFor returns the deposit paid when booking reservation res, less what is paid with a gift voucher
+func (m *Repository) depositFor(res models.Reservation) float32 {
+	deposit := payments.Deposit(res.TotalPrice, m.App.DepositPercent) - res.VoucherAmount
+	if deposit <= 0 {
+		return 0
+	}
+	return float32(math.Round(float64(deposit)*100) / 100)
+}
+
+//depositExpired tells if the time to pay the deposit of reservation res ran out or the reservation was cancelled meanwhile
+func (m *Repository) depositExpired(res models.Reservation) (bool, error) {
+	if !res.PaymentDueAt.IsZero() && time.Now().After(res.PaymentDueAt) {
+		return true, nil
+	}
+	stored, err := m.DB.GetReservationById(res.ID)
+	if err != nil {
+		return false, err
+	}
+	return stored.Cancelled(), nil
+}
+
+//refuseExpiredDeposit sends the guest back to book again, the reservation in session is gone
+func (m *Repository) refuseExpiredDeposit(w http.ResponseWriter, r *http.Request) {
+	m.App.Session.Remove(r.Context(), "reservation")
+	m.App.Session.Remove(r.Context(), "payment_intent")
+	m.App.Session.Put(r.Context(), "error", "Sorry, the time to pay the deposit ran out. Please book again.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+//ExpireUnpaidReservations cancels pending reservations whose deposit was not paid in time,
+//frees their dates and returns what was paid with gift vouchers. Returns number of reservations cancelled
+func (m *Repository) ExpireUnpaidReservations() (int, error) {
+	unpaid, err := m.DB.UnpaidReservations(time.Now())
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, res := range unpaid {
+		err = m.DB.ExpireReservation(res.ID)
+		if errors.Is(err, repository.ErrStatusChanged) {
+			// paid or changed after it was listed
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		expired++
+		_, _, err = m.refundPayments(res, res.TotalPrice)
+		if err != nil {
+			m.App.ErrorLog.Println("cannot return voucher payments of expired reservation", res.ID, ":", err)
+		}
+	}
+	return expired, nil
+}
+
+//Deposit renders the deposit payment page between the reservation form and the summary
+func (m *Repository) Deposit(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	expired, err := m.depositExpired(res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if expired {
+		m.refuseExpiredDeposit(w, r)
+		return
+	}
+	deposit := m.depositFor(res)
+
+	// the same intent is reused when the guest retries after a declined payment
+	if m.App.Session.GetString(r.Context(), "payment_intent") == "" {
+		intent, err := m.App.Payments.CreateIntent(deposit, strconv.Itoa(res.ID))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		m.App.Session.Put(r.Context(), "payment_intent", intent.ID)
+	}
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	stringMap := make(map[string]string)
+	stringMap["deposit"] = render.Price(deposit)
+	stringMap["provider"] = m.App.Payments.Name()
+	if !res.PaymentDueAt.IsZero() {
+		stringMap["due"] = res.PaymentDueAt.Format("15:04")
+	}
+	render.Template(w, "deposit.page.tmpl.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	}, r)
+}
+
+//PostDeposit charges the deposit, records it in the payments ledger and confirms the reservation
+func (m *Repository) PostDeposit(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	intentID := m.App.Session.GetString(r.Context(), "payment_intent")
+	if intentID == "" {
+		http.Redirect(w, r, "/deposit", http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	expired, err := m.depositExpired(res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if expired {
+		m.refuseExpiredDeposit(w, r)
+		return
+	}
+
+	intent, err := m.App.Payments.Capture(intentID, r.Form.Get("payment_method"))
+	if errors.Is(err, payments.ErrDeclined) {
+		m.App.Session.Put(r.Context(), "error", "Your payment was declined, please try another card.")
+		http.Redirect(w, r, "/deposit", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.App.Session.Remove(r.Context(), "payment_intent")
+
+	_, err = m.DB.InsertPayment(models.Payment{
+		ReservationID: res.ID,
+		Kind:          models.PaymentKindPayment,
+		Amount:        intent.Amount,
+		Provider:      m.App.Payments.Name(),
+		ProviderRef:   intent.ID,
+		IntentID:      intent.ID,
+	})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// the money is taken, a reservation changed meanwhile is left for the owner to sort out
+	err = m.changeStatus(res, models.StatusConfirmed)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	} else {
+		res.Status = models.StatusConfirmed
+	}
+
+	m.sendReservationEmails(res)
+
+	m.App.Session.Put(r.Context(), "reservation", res)
+	m.App.Session.Put(r.Context(), "deposit_paid", render.Price(intent.Amount))
+	http.Redirect(w, r, "/reservationsummary", http.StatusSeeOther)
+}
+
+//PaymentWebhook records payments and refunds the provider reports, calls already in the ledger change nothing
+func (m *Repository) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "cannot read body", http.StatusBadRequest)
+		return
+	}
+	event, err := m.App.Payments.VerifyWebhook(payload, r.Header)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if event.Reference == voucherReference {
+		// vouchers are issued when their payment is captured
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	resID, err := strconv.Atoi(event.Reference)
+	if err != nil {
+		http.Error(w, "unknown reference", http.StatusBadRequest)
+		return
+	}
+
+	p := models.Payment{
+		ReservationID: resID,
+		Amount:        event.Amount,
+		Provider:      m.App.Payments.Name(),
+		IntentID:      event.IntentID,
+	}
+	switch event.Type {
+	case payments.EventPaymentSucceeded:
+		p.Kind = models.PaymentKindPayment
+		p.ProviderRef = event.IntentID
+	case payments.EventRefunded:
+		p.Kind = models.PaymentKindRefund
+		p.ProviderRef = event.RefundID
+	default:
+		// other events are of no interest
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	_, err = m.DB.InsertPayment(p)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if p.Kind == models.PaymentKindPayment {
+		res, err := m.DB.GetReservationById(resID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		// reservations made through the API are paid outside the deposit page, their guests are emailed here
+		if res.Status == models.StatusPending {
+			err = m.changeStatus(res, models.StatusConfirmed)
+			if err != nil {
+				m.App.ErrorLog.Println(err)
+			} else {
+				res.Status = models.StatusConfirmed
+				m.sendReservationEmails(res)
+			}
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+//refundPayments returns up to amount of what was paid for reservation res, through the provider or back to
+//the gift voucher it was paid with, recording each refund in the payments ledger. Returns the amounts refunded
+func (m *Repository) refundPayments(res models.Reservation, amount float32) (toCard, toVoucher float32, err error) {
+	ledger, err := m.DB.PaymentsForReservation(res.ID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	left := payments.Refundable(ledger)
+	for _, p := range ledger {
+		if amount-toCard-toVoucher <= 0 {
+			break
+		}
+		if p.Kind != models.PaymentKindPayment || left[p.IntentID] <= 0 {
+			continue
+		}
+		part := left[p.IntentID]
+		if part > amount-toCard-toVoucher {
+			part = amount - toCard - toVoucher
+		}
+
+		switch p.Provider {
+		case models.PaymentProviderVoucher:
+			err = m.DB.RefundToVoucher(p, part)
+			if err != nil {
+				return toCard, toVoucher, err
+			}
+			left[p.IntentID] -= part
+			toVoucher += part
+		case m.App.Payments.Name():
+			refundID, err := m.App.Payments.Refund(p.IntentID, part)
+			if err != nil {
+				return toCard, toVoucher, err
+			}
+			left[p.IntentID] -= part
+			toCard += part
+			_, err = m.DB.InsertPayment(models.Payment{
+				ReservationID: res.ID,
+				Kind:          models.PaymentKindRefund,
+				Amount:        part,
+				Provider:      m.App.Payments.Name(),
+				ProviderRef:   refundID,
+				IntentID:      p.IntentID,
+			})
+			if err != nil {
+				return toCard, toVoucher, err
+			}
+		}
+	}
+	return toCard, toVoucher, nil
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/t-Ikonen/bbbookingsystem/internal/forms"
+	"github.com/t-Ikonen/bbbookingsystem/internal/helpers"
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/pricing"
+	"github.com/t-Ikonen/bbbookingsystem/internal/promo"
+	"github.com/t-Ikonen/bbbookingsystem/internal/render"
+)
+
+//applyPromoCode takes the discount of promo code in field promo_code of form off reservation res.
+//Problems with the code are added as form errors, an empty field leaves res as it is
+func (m *Repository) applyPromoCode(res *models.Reservation, form *forms.Form) error {
+	code := promo.Normalize(form.Get("promo_code"))
+	if code == "" {
+		return nil
+	}
+
+	p, err := m.DB.GetPromoCodeByCode(code)
+	if errors.Is(err, sql.ErrNoRows) {
+		form.Errors.Add("promo_code", "Unknown promo code")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = promo.Check(p, res.RoomId, pricing.Nights(res.StartDate, res.EndDate), time.Now())
+	if err != nil {
+		form.Errors.Add("promo_code", "Cannot use promo code: "+err.Error())
+		return nil
+	}
+
+	res.PromoCodeID = p.ID
+	res.PromoCode = p.Code
+	res.DiscountAmount = promo.Discount(p, res.TotalPrice)
+	res.TotalPrice -= res.DiscountAmount
+	return nil
+}
+
+//discountedTotal returns the price of stay res and the discount of its promo code taken off it.
+//A reservation whose code was deleted keeps the discount it got when booked
+func (m *Repository) discountedTotal(res models.Reservation) (float32, float32, error) {
+	total, err := m.stayTotal(res.RoomId, res.StartDate, res.EndDate)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	discount := res.DiscountAmount
+	if res.PromoCodeID != 0 {
+		p, err := m.DB.GetPromoCodeById(res.PromoCodeID)
+		if err != nil {
+			return 0, 0, err
+		}
+		discount = promo.Discount(p, total)
+	}
+	if discount > total {
+		discount = total
+	}
+	return total - discount, discount, nil
+}
+
+//AdminPromoCodes lists promo codes with their use and shows form for a new code in admin tool
+func (m *Repository) AdminPromoCodes(w http.ResponseWriter, r *http.Request) {
+	m.renderPromoCodes(w, r, forms.New(nil))
+}
+
+//renderPromoCodes renders the promo codes page with given form
+func (m *Repository) renderPromoCodes(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	codes, err := m.DB.AllPromoCodes()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	roomNames := make(map[int]string)
+	for _, x := range rooms {
+		roomNames[x.ID] = x.RoomName
+	}
+
+	data := make(map[string]interface{})
+	data["codes"] = codes
+	data["rooms"] = rooms
+	data["room_names"] = roomNames
+	render.Template(w, "adminpromocodes.page.tmpl.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	}, r)
+}
+
+//AdminPostPromoCode saves a new promo code in admin tool
+func (m *Repository) AdminPostPromoCode(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code", "kind", "value", "valid_from", "valid_to")
+
+	p := models.PromoCode{
+		Code: promo.Normalize(r.Form.Get("code")),
+		Kind: r.Form.Get("kind"),
+	}
+	if p.Kind != models.PromoPercent && p.Kind != models.PromoFixed {
+		form.Errors.Add("kind", "Choose percentage or fixed amount")
+	}
+
+	value, err := strconv.ParseFloat(r.Form.Get("value"), 32)
+	p.Value = float32(value)
+	if err != nil || p.Value <= 0 {
+		form.Errors.Add("value", "Discount must be more than zero")
+	} else if p.Kind == models.PromoPercent && p.Value > 100 {
+		form.Errors.Add("value", "Discount cannot be over 100 percent")
+	}
+
+	layout := "2006-01-02"
+	p.ValidFrom, err = time.Parse(layout, r.Form.Get("valid_from"))
+	if err != nil {
+		form.Errors.Add("valid_from", "Invalid date")
+	}
+	p.ValidTo, err = time.Parse(layout, r.Form.Get("valid_to"))
+	if err != nil {
+		form.Errors.Add("valid_to", "Invalid date")
+	} else if p.ValidTo.Before(p.ValidFrom) {
+		form.Errors.Add("valid_to", "Last day cannot be before first day")
+	}
+
+	p.MinNights, err = strconv.Atoi(r.Form.Get("min_nights"))
+	if r.Form.Get("min_nights") != "" && (err != nil || p.MinNights < 0) {
+		form.Errors.Add("min_nights", "Minimum nights must be zero or more")
+	}
+	p.UsageLimit, err = strconv.Atoi(r.Form.Get("usage_limit"))
+	if r.Form.Get("usage_limit") != "" && (err != nil || p.UsageLimit < 0) {
+		form.Errors.Add("usage_limit", "Usage limit must be zero or more")
+	}
+
+	for _, x := range r.PostForm["room_ids"] {
+		roomID, err := strconv.Atoi(x)
+		if err == nil {
+			p.RoomIDs = append(p.RoomIDs, roomID)
+		}
+	}
+
+	if p.Code != "" {
+		_, err = m.DB.GetPromoCodeByCode(p.Code)
+		if err == nil {
+			form.Errors.Add("code", "This code is already in use")
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		m.renderPromoCodes(w, r, form)
+		return
+	}
+
+	p.ID, err = m.DB.InsertPromoCode(p)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.audit(r, "create", "promo_code", p.ID, nil, p)
+
+	m.App.Session.Put(r.Context(), "flash", "Promo code "+p.Code+" saved.")
+	http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+}
+
+//AdminDeletePromoCode deletes a promo code in admin tool
+func (m *Repository) AdminDeletePromoCode(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	if err := m.DB.DeletePromoCode(id); err != nil {
+		m.App.Session.Put(r.Context(), "error", "Cannot delete promo code: "+err.Error())
+		http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+		return
+	}
+	m.audit(r, "delete", "promo_code", id, nil, nil)
+	m.App.Session.Put(r.Context(), "flash", "Promo code deleted.")
+	http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+}
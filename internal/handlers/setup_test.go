@@ -14,12 +14,14 @@ import (
 
 	"github.com/alexedwards/scs/v2"
 
-	"github.com/go-chi/chi"
-	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 
 	"github.com/justinas/nosurf"
 	"github.com/t-Ikonen/bbbookingsystem/internal/config"
+	"github.com/t-Ikonen/bbbookingsystem/internal/helpers"
 	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/payments"
 	"github.com/t-Ikonen/bbbookingsystem/internal/render"
 )
 
@@ -29,12 +31,26 @@ var pathToTemplates = "./../../templates"
 
 var functions = template.FuncMap{}
 
+//livePayments is the fake provider posing as one that moves real money
+type livePayments struct {
+	*payments.Fake
+}
+
+func (livePayments) Live() bool {
+	return true
+}
+
 func TestMain(m *testing.M) {
 	// Reservation model stored in session
 	gob.Register(models.Reservation{})
 
 	//change to true when in production
 	appCnf.InProduction = false
+	appCnf.SigningKey = []byte("test signing key")
+	appCnf.Payments = payments.NewFake([]byte("test webhook secret"))
+	appCnf.DepositPercent = 30
+	appCnf.DepositTimeout = 30 * time.Minute
+	appCnf.Seller = models.Seller{Name: "Blacklodge B&B", BusinessID: "1234567-8", Email: "ed.glen@blacklodge.xyz", IBAN: "FI21 1234 5600 0007 85"}
 
 	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	appCnf.InfoLog = infoLog
@@ -67,6 +83,7 @@ func TestMain(m *testing.M) {
 	repo := NewTestRepo(&appCnf)
 	NewHandlers(repo)
 	render.NewRenderer(&appCnf)
+	helpers.NewHelpers(&appCnf)
 	os.Exit(m.Run())
 }
 
@@ -94,14 +111,73 @@ func getRoutes() http.Handler {
 	mux.Get("/booking", Repo.Booking)
 	mux.Post("/booking", Repo.PostBooking)
 	mux.Post("/bookingjson", Repo.BookingJSON)
+	mux.Post("/waitlist", Repo.PostWaitlist)
+	mux.Get("/api/availability", Repo.AvailabilityJSON)
+	mux.Get("/ical/{token}.ics", Repo.RoomICal)
 
 	mux.Get("/frostsuite", Repo.Frostsuite)
 	mux.Get("/northernlights", Repo.Northernlights)
 
+	mux.Get("/bookroom", Repo.BookRoom)
 	mux.Get("/reservation", Repo.Reservation)
 	mux.Post("/reservation", Repo.PostReservation)
+	mux.Get("/deposit", Repo.Deposit)
+	mux.Post("/deposit", Repo.PostDeposit)
+	mux.Get("/vouchers", Repo.Vouchers)
+	mux.Post("/vouchers", Repo.PostVoucher)
+	mux.Get("/voucher/{token}", Repo.ShowVoucher)
+	mux.Post("/payments/webhook", Repo.PaymentWebhook)
 	mux.Get("/reservationsummary", Repo.Reservationsummary)
 
+	mux.Get("/my-booking/{token}", Repo.GuestBooking)
+	mux.Post("/my-booking/{token}", Repo.PostGuestBooking)
+	mux.Post("/my-booking/{token}/cancel", Repo.PostGuestCancel)
+
+	mux.Post("/admin/reservation-status/{src}/{id}/{status}", Repo.AdminReservationStatus)
+	mux.Post("/admin/cancel-reservation/{src}/{id}", Repo.AdminCancelReservation)
+	mux.Post("/admin/deactivate-room/{id}", Repo.AdminDeactivateRoom)
+	mux.Post("/admin/activate-room/{id}", Repo.AdminActivateRoom)
+	mux.Post("/admin/delete-room/{id}", Repo.AdminDeleteRoom)
+	mux.Post("/admin/delete-room-rule/{id}", Repo.AdminDeleteRoomRule)
+	mux.Post("/admin/delete-api-token/{id}", Repo.AdminDeleteAPIToken)
+	mux.Post("/admin/new-ical-token/{id}", Repo.AdminNewICalToken)
+	mux.Post("/admin/sync-ical-imports", Repo.AdminSyncICalImports)
+	mux.Post("/admin/delete-ical-import/{id}", Repo.AdminDeleteICalImport)
+	mux.Post("/admin/delete-cancellation-policy/{id}", Repo.AdminDeleteCancellationPolicy)
+	mux.Get("/admin/audit", Repo.AdminAudit)
+	mux.Get("/admin/dashboard", Repo.AdminDashboard)
+	mux.Get("/admin/housekeeping", Repo.AdminHousekeeping)
+	mux.Post("/admin/housekeeping/status", Repo.AdminPostRoomStatus)
+	mux.Post("/admin/housekeeping/assign", Repo.AdminPostHousekeepingAssign)
+	mux.Post("/admin/check-in/{id}", Repo.AdminCheckIn)
+	mux.Post("/admin/check-out/{id}", Repo.AdminCheckOut)
+	mux.Post("/admin/create-invoice/{src}/{id}", Repo.AdminCreateInvoice)
+	mux.Post("/admin/email-invoice/{src}/{id}", Repo.AdminEmailInvoice)
+	mux.Get("/admin/invoices/{id}", Repo.AdminShowInvoice)
+	mux.Get("/admin/invoices/{id}/pdf", Repo.AdminInvoicePDF)
+	mux.Get("/admin/promo-codes", Repo.AdminPromoCodes)
+	mux.Post("/admin/promo-codes", Repo.AdminPostPromoCode)
+	mux.Post("/admin/delete-promo-code/{id}", Repo.AdminDeletePromoCode)
+	mux.Get("/admin/extras", Repo.AdminExtras)
+	mux.Post("/admin/extras", Repo.AdminPostExtra)
+	mux.Get("/admin/extras/{id}", Repo.AdminShowExtra)
+	mux.Post("/admin/extras/{id}", Repo.AdminPostExtra)
+	mux.Post("/admin/delete-extra/{id}", Repo.AdminDeleteExtra)
+	mux.Get("/admin/vouchers", Repo.AdminVouchers)
+	mux.Post("/admin/vouchers", Repo.AdminPostVoucher)
+	mux.Get("/admin/vouchers/{id}", Repo.AdminShowVoucher)
+	mux.Get("/admin/vouchers/{id}/print", Repo.AdminPrintVoucher)
+	mux.Post("/admin/email-voucher/{id}", Repo.AdminEmailVoucher)
+
+	mux.Route("/api/v1", func(mux chi.Router) {
+		mux.Get("/rooms", Repo.APIRooms)
+		mux.Get("/availability", Repo.APIAvailability)
+		mux.Post("/reservations", Repo.APICreateReservation)
+		mux.Get("/reservations/{id}", Repo.APIGetReservation)
+		mux.Put("/reservations/{id}", Repo.APIUpdateReservation)
+		mux.Delete("/reservations/{id}", Repo.APICancelReservation)
+	})
+
 	fileServer := http.FileServer(http.Dir("./static/"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
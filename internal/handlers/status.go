@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/t-Ikonen/bbbookingsystem/internal/helpers"
+	"github.com/t-Ikonen/bbbookingsystem/internal/lifecycle"
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/repository"
+)
+
+//changeStatus moves a reservation to status to if the lifecycle allows it.
+//Cancelling goes through cancelReservation because it refunds and frees the dates
+func (m *Repository) changeStatus(res models.Reservation, to string) error {
+	err := lifecycle.Check(res.Status, to)
+	if err != nil {
+		return err
+	}
+	return m.DB.UpdateReservationStatus(res.ID, res.Status, to)
+}
+
+//advanceStatus changes status of a reservation and records the change in audit log, returns the reservation after the change.
+//A checked out room is left dirty for housekeeping
+func (m *Repository) advanceStatus(r *http.Request, res models.Reservation, to string) (models.Reservation, error) {
+	err := m.changeStatus(res, to)
+	if err != nil {
+		return res, err
+	}
+	after := res
+	after.Status = to
+	m.audit(r, "status", "reservation", res.ID, res, after)
+	if to == models.StatusCheckedOut {
+		m.markDirty(r, res.RoomId)
+	}
+	return after, nil
+}
+
+//AdminReservationStatus changes status of a reservation in admin tool
+func (m *Repository) AdminReservationStatus(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	src := chi.URLParam(r, "src")
+	to := chi.URLParam(r, "status")
+	back := fmt.Sprintf("/admin/reservations/%s/%d", src, id)
+
+	if to == models.StatusCancelled {
+		m.AdminCancelReservation(w, r)
+		return
+	}
+
+	res, err := m.DB.GetReservationById(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	_, err = m.advanceStatus(r, res, to)
+	if errors.Is(err, lifecycle.ErrTransition) || errors.Is(err, repository.ErrStatusChanged) {
+		m.App.Session.Put(r.Context(), "error", "Cannot change status: "+err.Error())
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation is now "+lifecycle.Label(to)+".")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+//AdminCheckIn checks in a guest from front desk dashboard, a pending reservation is confirmed on the way
+func (m *Repository) AdminCheckIn(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	res, err := m.DB.GetReservationById(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if res.StartDate.Format("2006-01-02") > time.Now().Format("2006-01-02") {
+		m.App.Session.Put(r.Context(), "error", "Cannot check in before arrival date "+res.StartDate.Format("02-01-2006"))
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	// a pending reservation may wait for its deposit, the owner confirms it on the reservation page first
+	if res.Status == models.StatusPending {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Reservation of %s %s is not confirmed yet, confirm it before check-in", res.FirstName, res.LastName))
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	_, err = m.advanceStatus(r, res, models.StatusCheckedIn)
+	m.frontDeskResult(w, r, err, fmt.Sprintf("%s %s checked in.", res.FirstName, res.LastName))
+}
+
+//AdminCheckOut checks out a guest from front desk dashboard
+func (m *Repository) AdminCheckOut(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	res, err := m.DB.GetReservationById(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	_, err = m.advanceStatus(r, res, models.StatusCheckedOut)
+	m.frontDeskResult(w, r, err, fmt.Sprintf("%s %s checked out.", res.FirstName, res.LastName))
+}
+
+//frontDeskResult reports outcome of a front desk action and returns to dashboard
+func (m *Repository) frontDeskResult(w http.ResponseWriter, r *http.Request, err error, done string) {
+	if errors.Is(err, lifecycle.ErrTransition) || errors.Is(err, repository.ErrStatusChanged) {
+		m.App.Session.Put(r.Context(), "error", "Cannot change status: "+err.Error())
+		http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.App.Session.Put(r.Context(), "flash", done)
+	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
+}
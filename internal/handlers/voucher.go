@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/t-Ikonen/bbbookingsystem/internal/forms"
+	"github.com/t-Ikonen/bbbookingsystem/internal/helpers"
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/payments"
+	"github.com/t-Ikonen/bbbookingsystem/internal/render"
+	"github.com/t-Ikonen/bbbookingsystem/internal/signedlink"
+	"github.com/t-Ikonen/bbbookingsystem/internal/voucher"
+)
+
+//voucherReference is the payment reference of voucher purchases, reservation payments have the reservation id
+const voucherReference = "voucher"
+
+//voucherKey is the key voucher links are signed with, different from booking links so that
+//a voucher link never opens the booking of the same id
+func (m *Repository) voucherKey() []byte {
+	return append([]byte("voucher:"), m.App.SigningKey...)
+}
+
+//voucherPath returns the signed path of the printable voucher v, valid until the voucher expires
+func (m *Repository) voucherPath(v models.Voucher) string {
+	return "/voucher/" + signedlink.Sign(m.voucherKey(), v.ID, v.ExpiresAt.AddDate(0, 0, 1))
+}
+
+//voucherLink returns the signed link to the printable voucher v
+func (m *Repository) voucherLink(v models.Voucher) string {
+	return m.App.BaseURL + m.voucherPath(v)
+}
+
+//applyVoucher pays what it can of reservation res with the gift voucher in field voucher_code of form.
+//Problems with the voucher are added as form errors, an empty field leaves res as it is
+func (m *Repository) applyVoucher(res *models.Reservation, form *forms.Form) error {
+	code := voucher.Normalize(form.Get("voucher_code"))
+	if code == "" {
+		return nil
+	}
+
+	v, err := m.DB.GetVoucherByCode(code)
+	if errors.Is(err, sql.ErrNoRows) {
+		form.Errors.Add("voucher_code", "Unknown voucher code")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = voucher.Check(v, time.Now())
+	if err != nil {
+		form.Errors.Add("voucher_code", "Cannot use voucher: "+err.Error())
+		return nil
+	}
+
+	res.VoucherID = v.ID
+	res.VoucherCode = v.Code
+	res.VoucherAmount = voucher.Redeemable(v, res.TotalPrice)
+	return nil
+}
+
+//sendVoucherEmail emails voucher v with a link to its printable page to the buyer
+func (m *Repository) sendVoucherEmail(v models.Voucher) {
+	message := ""
+	if v.Message != "" {
+		message = "<em>" + template.HTMLEscapeString(v.Message) + "</em><br><br>"
+	}
+	body := fmt.Sprintf(`
+		<strong>Gift voucher</strong><br><br>
+		Dear %s, <br><hr>
+		Here is your gift voucher to Black Lodge B&B.<br><br>
+		For: %s<br>
+		Code: <strong>%s</strong><br>
+		Value: %s<br>
+		Valid until: %s<br><br>
+		%s
+		The voucher is used by entering its code when booking, what is not spent stays on the voucher.<br>
+		Print the voucher: <a href="%s">%s</a>
+		`, template.HTMLEscapeString(v.BuyerName), template.HTMLEscapeString(v.RecipientName), v.Code, render.Price(v.Balance),
+		v.ExpiresAt.Format("02-01-2006"), message, m.voucherLink(v), m.voucherLink(v))
+
+	m.App.MailChan <- models.MailData{
+		To:       v.BuyerEmail,
+		From:     "ed.glen@blacklodge.xyz",
+		Subject:  "Gift voucher " + v.Code,
+		Message:  body,
+		Template: "basic.html",
+	}
+}
+
+//Vouchers renders the page where guests buy gift vouchers
+func (m *Repository) Vouchers(w http.ResponseWriter, r *http.Request) {
+	m.renderVouchers(w, r, forms.New(nil))
+}
+
+//renderVouchers renders the voucher purchase page with given form, vouchers are sold only through a live payment provider
+func (m *Repository) renderVouchers(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	stringMap := make(map[string]string)
+	stringMap["provider"] = m.App.Payments.Name()
+	if !m.App.Payments.Live() {
+		stringMap["unavailable"] = "1"
+	}
+	stringMap["min"] = strconv.Itoa(voucher.MinAmount)
+	stringMap["max"] = strconv.Itoa(voucher.MaxAmount)
+	render.Template(w, "vouchers.page.tmpl.html", &models.TemplateData{
+		Form:      form,
+		StringMap: stringMap,
+	}, r)
+}
+
+//PostVoucher charges a gift voucher bought by a guest, records the payment and emails the voucher to the buyer.
+//A provider that moves no money would hand out vouchers for free, so then nothing is sold
+func (m *Repository) PostVoucher(w http.ResponseWriter, r *http.Request) {
+	if !m.App.Payments.Live() {
+		m.App.Session.Put(r.Context(), "error", "Gift vouchers cannot be bought online at the moment.")
+		http.Redirect(w, r, "/vouchers", http.StatusSeeOther)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("amount", "buyer_name", "buyer_email", "recipient_name")
+	form.ValidEmail("buyer_email")
+
+	amount, err := strconv.Atoi(r.Form.Get("amount"))
+	if err != nil || amount < voucher.MinAmount || amount > voucher.MaxAmount {
+		form.Errors.Add("amount", fmt.Sprintf("Amount must be from %d to %d euros", voucher.MinAmount, voucher.MaxAmount))
+	}
+	if !form.Valid() {
+		m.renderVouchers(w, r, form)
+		return
+	}
+
+	intent, err := m.App.Payments.CreateIntent(float32(amount), voucherReference)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	intent, err = m.App.Payments.Capture(intent.ID, r.Form.Get("payment_method"))
+	if errors.Is(err, payments.ErrDeclined) {
+		form.Errors.Add("payment_method", "Your payment was declined, please try another card.")
+		m.renderVouchers(w, r, form)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	code, err := voucher.NewCode()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	v := models.Voucher{
+		Code:          code,
+		Amount:        intent.Amount,
+		Balance:       intent.Amount,
+		ExpiresAt:     voucher.Expiry(time.Now()),
+		BuyerName:     r.Form.Get("buyer_name"),
+		BuyerEmail:    r.Form.Get("buyer_email"),
+		RecipientName: r.Form.Get("recipient_name"),
+		Message:       r.Form.Get("message"),
+		PaymentRef:    intent.ID,
+	}
+	v.ID, err = m.DB.InsertVoucher(v)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	_, err = m.DB.InsertPayment(models.Payment{
+		Kind:        models.PaymentKindPayment,
+		Amount:      intent.Amount,
+		Provider:    m.App.Payments.Name(),
+		ProviderRef: intent.ID,
+		IntentID:    intent.ID,
+	})
+	if err != nil {
+		// the voucher is issued, a missing ledger row is left for the owner to sort out
+		m.App.ErrorLog.Println(err)
+	}
+
+	m.sendVoucherEmail(v)
+
+	http.Redirect(w, r, m.voucherPath(v), http.StatusSeeOther)
+}
+
+//ShowVoucher shows the printable voucher of the signed link in the URL
+func (m *Repository) ShowVoucher(w http.ResponseWriter, r *http.Request) {
+	id, err := signedlink.Verify(m.voucherKey(), chi.URLParam(r, "token"), time.Now())
+	if errors.Is(err, signedlink.ErrExpired) {
+		m.App.Session.Put(r.Context(), "error", "This voucher has expired.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid voucher link")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	v, err := m.DB.GetVoucherById(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.renderPrintableVoucher(w, r, v)
+}
+
+//renderPrintableVoucher renders voucher v as printable page
+func (m *Repository) renderPrintableVoucher(w http.ResponseWriter, r *http.Request, v models.Voucher) {
+	data := make(map[string]interface{})
+	data["voucher"] = v
+	stringMap := make(map[string]string)
+	stringMap["seller"] = m.App.Seller.Name
+	stringMap["url"] = m.App.BaseURL
+	render.Template(w, "voucher.page.tmpl.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	}, r)
+}
+
+//AdminVouchers lists gift vouchers with their balance and shows form for issuing a voucher in admin tool
+func (m *Repository) AdminVouchers(w http.ResponseWriter, r *http.Request) {
+	form := forms.New(url.Values{})
+	form.Set("expires_at", voucher.Expiry(time.Now()).Format("2006-01-02"))
+	m.renderAdminVouchers(w, r, form)
+}
+
+//renderAdminVouchers renders the gift vouchers page of admin tool with given form
+func (m *Repository) renderAdminVouchers(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	vouchers, err := m.DB.AllVouchers()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["vouchers"] = vouchers
+	render.Template(w, "adminvouchers.page.tmpl.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	}, r)
+}
+
+//AdminPostVoucher issues a gift voucher in admin tool, the voucher is emailed when an email is given
+func (m *Repository) AdminPostVoucher(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("amount", "expires_at", "recipient_name")
+	if form.Get("buyer_email") != "" {
+		form.ValidEmail("buyer_email")
+	}
+
+	v := models.Voucher{
+		Code:          voucher.Normalize(r.Form.Get("code")),
+		BuyerName:     r.Form.Get("buyer_name"),
+		BuyerEmail:    r.Form.Get("buyer_email"),
+		RecipientName: r.Form.Get("recipient_name"),
+		Message:       r.Form.Get("message"),
+	}
+
+	amount, err := strconv.ParseFloat(r.Form.Get("amount"), 32)
+	v.Amount = float32(amount)
+	v.Balance = v.Amount
+	if err != nil || v.Amount <= 0 {
+		form.Errors.Add("amount", "Amount must be more than zero")
+	}
+	v.ExpiresAt, err = time.Parse("2006-01-02", r.Form.Get("expires_at"))
+	if err != nil {
+		form.Errors.Add("expires_at", "Invalid date")
+	}
+
+	if v.Code == "" {
+		v.Code, err = voucher.NewCode()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	} else {
+		_, err = m.DB.GetVoucherByCode(v.Code)
+		if err == nil {
+			form.Errors.Add("code", "This code is already in use")
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		m.renderAdminVouchers(w, r, form)
+		return
+	}
+
+	v.ID, err = m.DB.InsertVoucher(v)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.audit(r, "create", "voucher", v.ID, nil, v)
+
+	flash := "Voucher " + v.Code + " issued."
+	if v.BuyerEmail != "" {
+		m.sendVoucherEmail(v)
+		flash = "Voucher " + v.Code + " issued and emailed to " + v.BuyerEmail + "."
+	}
+	m.App.Session.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, fmt.Sprintf("/admin/vouchers/%d", v.ID), http.StatusSeeOther)
+}
+
+//AdminShowVoucher shows a gift voucher with the reservations it was spent on in admin tool
+func (m *Repository) AdminShowVoucher(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	v, err := m.DB.GetVoucherById(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["voucher"] = v
+	render.Template(w, "adminvoucher.page.tmpl.html", &models.TemplateData{
+		Data: data,
+	}, r)
+}
+
+//AdminPrintVoucher shows a gift voucher as printable page in admin tool
+func (m *Repository) AdminPrintVoucher(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	v, err := m.DB.GetVoucherById(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.renderPrintableVoucher(w, r, v)
+}
+
+//AdminEmailVoucher emails a gift voucher to its buyer in admin tool
+func (m *Repository) AdminEmailVoucher(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	v, err := m.DB.GetVoucherById(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	back := fmt.Sprintf("/admin/vouchers/%d", v.ID)
+	if v.BuyerEmail == "" {
+		m.App.Session.Put(r.Context(), "error", "Voucher has no email to send it to")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	m.sendVoucherEmail(v)
+	m.audit(r, "email", "voucher", v.ID, nil, map[string]string{"to": v.BuyerEmail})
+
+	m.App.Session.Put(r.Context(), "flash", "Voucher emailed to "+v.BuyerEmail+".")
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/forms"
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/render"
+)
+
+//PostWaitlist puts a guest on the waitlist for dates without availability
+func (m *Repository) PostWaitlist(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot parse form")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	layout := "01-02-2006"
+	startDate, err := time.Parse(layout, r.Form.Get("start_date"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot parse start date")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	endDate, err := time.Parse(layout, r.Form.Get("end_date"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot parse end date")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+	adults, children, err := parseGuests(r.Form.Get("adults"), r.Form.Get("children"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "invalid number of guests")
+		http.Redirect(w, r, "/booking", http.StatusSeeOther)
+		return
+	}
+
+	entry := models.WaitlistEntry{
+		FirstName: r.Form.Get("first_name"),
+		LastName:  r.Form.Get("last_name"),
+		Email:     r.Form.Get("email"),
+		Phone:     r.Form.Get("phone"),
+		StartDate: startDate,
+		EndDate:   endDate,
+		Adults:    adults,
+		Children:  children,
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "email")
+	form.ValidEmail("email")
+
+	if !form.Valid() {
+		data := make(map[string]interface{})
+		data["waitlist"] = entry
+		render.Template(w, "booking.page.tmpl.html", &models.TemplateData{
+			Form: form,
+			Data: data,
+		}, r)
+		return
+	}
+
+	_, err = m.DB.InsertWaitlistEntry(entry)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot insert waitlist entry to DB")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "You are on the waitlist. We will email you if a room becomes available.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+//notifyWaitlist emails waitlisted guests whose dates have become available
+func (m *Repository) notifyWaitlist() {
+	entries, err := m.DB.PendingWaitlistEntries()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	for _, e := range entries {
+		rooms, err := m.DB.SearchAvailabilityForAllRooms(e.StartDate, e.EndDate, e.Adults+e.Children)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			return
+		}
+
+		var links []string
+		for _, room := range rooms {
+			reasons, err := m.stayRuleReasons(room.ID, e.StartDate, e.EndDate)
+			if err != nil {
+				m.App.ErrorLog.Println(err)
+				return
+			}
+			if len(reasons) > 0 {
+				continue
+			}
+			links = append(links, fmt.Sprintf(`<a href="%s/bookroom?id=%d&s=%s&e=%s&a=%d&c=%d">%s</a>`,
+				m.App.BaseURL, room.ID, e.StartDate.Format("01-02-2006"), e.EndDate.Format("01-02-2006"),
+				e.Adults, e.Children, room.RoomName))
+		}
+		if len(links) == 0 {
+			continue
+		}
+
+		message := fmt.Sprintf(`
+		<strong>A room is available</strong><br><br>
+		Dear %s %s, <br><hr>
+		Good news, a room became available for your dates %s to %s.
+		Book it before someone else does:<br><br>
+		%s
+		`, e.FirstName, e.LastName, e.StartDate.Format("02-01-2006"), e.EndDate.Format("02-01-2006"), strings.Join(links, "<br>"))
+
+		m.App.MailChan <- models.MailData{
+			To:       e.Email,
+			From:     "ed.glen@blacklodge.xyz",
+			Subject:  "A room is available for your dates",
+			Message:  message,
+			Template: "basic.html",
+		}
+
+		err = m.DB.UpdateWaitlistNotified(e.ID)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+	}
+}
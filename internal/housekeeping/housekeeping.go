@@ -0,0 +1,134 @@
+//Package housekeeping derives the daily cleaning tasks from stays and holds the room statuses and the allowed changes between them
+package housekeeping
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+)
+
+//ErrTransition is returned for room status changes housekeeping does not allow
+var ErrTransition = errors.New("room status change is not allowed")
+
+//Statuses lists the room statuses in cleaning order
+var Statuses = []string{
+	models.RoomDirty,
+	models.RoomCleaning,
+	models.RoomClean,
+	models.RoomInspected,
+}
+
+//transitions maps a status to the statuses it can change to, any room can be marked dirty again
+var transitions = map[string][]string{
+	models.RoomDirty:     {models.RoomCleaning},
+	models.RoomCleaning:  {models.RoomClean, models.RoomDirty},
+	models.RoomClean:     {models.RoomInspected, models.RoomDirty},
+	models.RoomInspected: {models.RoomDirty},
+}
+
+var labels = map[string]string{
+	models.RoomDirty:     "Dirty",
+	models.RoomCleaning:  "Cleaning",
+	models.RoomClean:     "Clean",
+	models.RoomInspected: "Inspected",
+	models.TaskTurnover:  "Turnover",
+	models.TaskDeparture: "Departure",
+	models.TaskArrival:   "Arrival",
+	models.TaskStayOver:  "Stay-over",
+}
+
+//priority orders tasks, rooms with guests arriving are cleaned first
+var priority = map[string]int{
+	models.TaskTurnover:  0,
+	models.TaskDeparture: 1,
+	models.TaskArrival:   2,
+	models.TaskStayOver:  3,
+}
+
+//Valid tells if status is a known room status
+func Valid(status string) bool {
+	for _, s := range Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+//Label returns a room status or task kind in human readable form
+func Label(s string) string {
+	if l, ok := labels[s]; ok {
+		return l
+	}
+	return s
+}
+
+//Next returns the statuses a room in status from can change to
+func Next(from string) []string {
+	return transitions[from]
+}
+
+//Check returns ErrTransition if a room cannot change from status from to status to
+func Check(from, to string) error {
+	for _, s := range transitions[from] {
+		if s == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s to %s", ErrTransition, Label(from), Label(to))
+}
+
+//Tasks returns the cleaning tasks of day for stays, reservations with their rooms whose dates include day.
+//Imported stays without a reservation ID make tasks the same way.
+//A room gets one task, turnovers first and stay-overs last, rooms in name order within a kind
+func Tasks(day time.Time, stays []models.Reservation) []models.HousekeepingTask {
+	date := day.Format("2006-01-02")
+	byRoom := make(map[int]*models.HousekeepingTask)
+	var rooms []int
+
+	for _, res := range stays {
+		t, ok := byRoom[res.RoomId]
+		if !ok {
+			t = &models.HousekeepingTask{Date: day, RoomID: res.RoomId, Room: res.Room}
+			byRoom[res.RoomId] = t
+			rooms = append(rooms, res.RoomId)
+		}
+		switch {
+		case res.EndDate.Format("2006-01-02") == date:
+			t.Departing = res
+		case res.StartDate.Format("2006-01-02") == date:
+			t.Arriving = res
+		case res.StartDate.Format("2006-01-02") < date && res.EndDate.Format("2006-01-02") > date:
+			t.Staying = res
+		}
+	}
+
+	var tasks []models.HousekeepingTask
+	for _, roomID := range rooms {
+		t := byRoom[roomID]
+		switch {
+		case t.Departing.RoomId != 0 && t.Arriving.RoomId != 0:
+			t.Kind = models.TaskTurnover
+		case t.Departing.RoomId != 0:
+			t.Kind = models.TaskDeparture
+		case t.Arriving.RoomId != 0:
+			t.Kind = models.TaskArrival
+		case t.Staying.RoomId != 0:
+			t.Kind = models.TaskStayOver
+		default:
+			continue
+		}
+		tasks = append(tasks, *t)
+	}
+
+	sort.SliceStable(tasks, func(i, j int) bool {
+		if tasks[i].Kind != tasks[j].Kind {
+			return priority[tasks[i].Kind] < priority[tasks[j].Kind]
+		}
+		return tasks[i].Room.RoomName < tasks[j].Room.RoomName
+	})
+	return tasks
+}
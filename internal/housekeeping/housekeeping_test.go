@@ -0,0 +1,113 @@
+package housekeeping
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+)
+
+var checkTests = []struct {
+	from    string
+	to      string
+	allowed bool
+}{
+	{models.RoomDirty, models.RoomCleaning, true},
+	{models.RoomDirty, models.RoomClean, false},
+	{models.RoomCleaning, models.RoomClean, true},
+	{models.RoomCleaning, models.RoomDirty, true},
+	{models.RoomClean, models.RoomInspected, true},
+	{models.RoomClean, models.RoomCleaning, false},
+	{models.RoomInspected, models.RoomDirty, true},
+	{models.RoomInspected, models.RoomClean, false},
+	{"unknown", models.RoomDirty, false},
+}
+
+func TestCheck(t *testing.T) {
+	for _, e := range checkTests {
+		err := Check(e.from, e.to)
+		if e.allowed && err != nil {
+			t.Errorf("%s to %s should be allowed but got %s", e.from, e.to, err)
+		}
+		if !e.allowed && !errors.Is(err, ErrTransition) {
+			t.Errorf("%s to %s should not be allowed", e.from, e.to)
+		}
+	}
+}
+
+func TestNextIsChecked(t *testing.T) {
+	for _, from := range Statuses {
+		for _, to := range Next(from) {
+			if !Valid(to) {
+				t.Errorf("%s can change to unknown status %s", from, to)
+			}
+			if err := Check(from, to); err != nil {
+				t.Errorf("Next lists %s to %s but Check refuses it", from, to)
+			}
+		}
+	}
+}
+
+func TestLabel(t *testing.T) {
+	if l := Label(models.TaskStayOver); l != "Stay-over" {
+		t.Errorf("expected Stay-over but got %s", l)
+	}
+	if l := Label("unknown"); l != "unknown" {
+		t.Errorf("expected unknown status as is but got %s", l)
+	}
+}
+
+func TestTasks(t *testing.T) {
+	day := time.Date(2050, 11, 15, 0, 0, 0, 0, time.UTC)
+	stay := func(id, roomID int, name string, start, end int) models.Reservation {
+		return models.Reservation{
+			ID:        id,
+			RoomId:    roomID,
+			StartDate: day.AddDate(0, 0, start),
+			EndDate:   day.AddDate(0, 0, end),
+			Room:      models.Room{ID: roomID, RoomName: name},
+		}
+	}
+	stays := []models.Reservation{
+		stay(1, 1, "Snow Suite", -2, 2),
+		stay(2, 2, "Frost Suite", -3, 0),
+		stay(3, 2, "Frost Suite", 0, 4),
+		stay(4, 3, "Northern Lights", -1, 0),
+		stay(5, 4, "Aurora", 0, 1),
+		stay(6, 5, "Birch", -1, 3),
+		// imported from another channel, no reservation behind it
+		stay(0, 6, "Cloudberry", -2, 0),
+	}
+
+	tasks := Tasks(day, stays)
+	expected := []struct {
+		roomID int
+		kind   string
+	}{
+		{2, models.TaskTurnover},
+		{6, models.TaskDeparture},
+		{3, models.TaskDeparture},
+		{4, models.TaskArrival},
+		{5, models.TaskStayOver},
+		{1, models.TaskStayOver},
+	}
+	if len(tasks) != len(expected) {
+		t.Fatalf("expected %d tasks but got %d", len(expected), len(tasks))
+	}
+	for i, e := range expected {
+		if tasks[i].RoomID != e.roomID || tasks[i].Kind != e.kind {
+			t.Errorf("task %d: expected %s of room %d but got %s of room %d", i, e.kind, e.roomID, tasks[i].Kind, tasks[i].RoomID)
+		}
+	}
+	if tasks[0].Departing.ID != 2 || tasks[0].Arriving.ID != 3 {
+		t.Errorf("turnover should leave 2 and bring 3 but got %d and %d", tasks[0].Departing.ID, tasks[0].Arriving.ID)
+	}
+	if tasks[5].Staying.ID != 1 {
+		t.Errorf("stay-over should be reservation 1 but got %d", tasks[5].Staying.ID)
+	}
+
+	if tasks := Tasks(day, nil); len(tasks) != 0 {
+		t.Errorf("expected no tasks without stays but got %d", len(tasks))
+	}
+}
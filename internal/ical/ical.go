@@ -0,0 +1,85 @@
+//Package ical writes RFC 5545 iCalendar feeds of all-day events
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+//Event is an all-day calendar event, End is the day after the last day like in room restrictions
+type Event struct {
+	UID     string
+	Start   time.Time
+	End     time.Time
+	Summary string
+}
+
+const (
+	dateLayout  = "20060102"
+	stampLayout = "20060102T150405Z"
+	prodID      = "-//Black Lodge//bbbookingsystem//EN"
+	maxLine     = 75
+)
+
+//Write writes events as an iCalendar feed named name, stamp is the time the feed is generated
+func Write(w io.Writer, name string, events []Event, stamp time.Time) error {
+	bw := bufio.NewWriter(w)
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:" + prodID,
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + escape(name),
+	}
+	for _, e := range events {
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+escape(e.UID),
+			"DTSTAMP:"+stamp.UTC().Format(stampLayout),
+			"DTSTART;VALUE=DATE:"+e.Start.Format(dateLayout),
+			"DTEND;VALUE=DATE:"+e.End.Format(dateLayout),
+			"SUMMARY:"+escape(e.Summary),
+			"TRANSP:OPAQUE",
+			"END:VEVENT",
+		)
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, l := range lines {
+		_, err := bw.WriteString(fold(l))
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+//escape escapes text values
+func escape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+//fold splits a content line to lines of at most 75 octets ended by CRLF, continuation lines start with a space
+func fold(line string) string {
+	var b strings.Builder
+	limit := maxLine
+	for len(line) > limit {
+		cut := limit
+		// do not split a multi-byte character
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = maxLine - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
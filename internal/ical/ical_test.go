@@ -0,0 +1,63 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	events := []Event{
+		{
+			UID:     "rr-1@blacklodge.xyz",
+			Start:   time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+			End:     time.Date(2050, 1, 5, 0, 0, 0, 0, time.UTC),
+			Summary: "Reserved",
+		},
+	}
+	stamp := time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	err := Write(&buf, "Frost Suite", events, stamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"VERSION:2.0\r\n",
+		"UID:rr-1@blacklodge.xyz\r\n",
+		"DTSTAMP:20500101T120000Z\r\n",
+		"DTSTART;VALUE=DATE:20500103\r\n",
+		"DTEND;VALUE=DATE:20500105\r\n",
+		"SUMMARY:Reserved\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("feed is missing %q", want)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	got := escape("a,b;c\\d\ne")
+	if got != `a\,b\;c\\d\ne` {
+		t.Errorf("wrong escape: %s", got)
+	}
+}
+
+func TestFold(t *testing.T) {
+	line := "SUMMARY:" + strings.Repeat("ä", 60)
+	folded := fold(line)
+
+	for _, l := range strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n") {
+		if len(l) > maxLine {
+			t.Errorf("line is %d octets long", len(l))
+		}
+	}
+	if strings.ReplaceAll(strings.TrimSuffix(folded, "\r\n"), "\r\n ", "") != line {
+		t.Error("unfolded line does not match original")
+	}
+}
@@ -0,0 +1,207 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//maxFeedSize limits how much of a fetched feed is read
+const maxFeedSize = 5 << 20
+
+//ErrNotCalendar is returned when the data is not an iCalendar
+var ErrNotCalendar = errors.New("not an iCalendar file")
+
+var durationDays = regexp.MustCompile(`^P(?:(\d+)W)?(?:(\d+)D)?`)
+
+//Parse reads the events of an iCalendar as all-day events, cancelled events are skipped.
+//Timed events end on their end date like a checkout, events without end last one day.
+//Recurring events are expanded to their occurrences, see recur
+func Parse(r io.Reader) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, ErrNotCalendar
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var events, occurrences []Event
+	// occurrences changed by an event of their own, by UID of the recurring event and day
+	changed := make(map[string]bool)
+	var props map[string]string
+	for _, l := range lines {
+		name, value := property(l)
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			props = make(map[string]string)
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if props == nil {
+				continue
+			}
+			if rid := props["RECURRENCE-ID"]; len(rid) >= 8 {
+				changed[props["UID"]+"/"+rid[:8]] = true
+			}
+			e, ok, err := toEvent(props)
+			if err != nil {
+				return nil, err
+			}
+			rule, recurring := props["RRULE"]
+			switch {
+			case ok && recurring && props["RECURRENCE-ID"] == "":
+				expanded, err := recur(e, rule, props["EXDATE"], today)
+				if err != nil {
+					return nil, err
+				}
+				occurrences = append(occurrences, expanded...)
+			case ok:
+				events = append(events, e)
+			}
+			props = nil
+		case props != nil && name == "EXDATE":
+			// excluded days may be listed on several lines
+			props[name] += "," + value
+		case props != nil:
+			// first occurrence wins, nested components like VALARM come after the event's own properties
+			if _, found := props[name]; !found {
+				props[name] = value
+			}
+		}
+	}
+	for _, e := range occurrences {
+		if !changed[e.UID] {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+//Fetch downloads and parses an iCalendar feed
+func Fetch(client *http.Client, url string) ([]Event, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching calendar: %s", resp.Status)
+	}
+	return Parse(io.LimitReader(resp.Body, maxFeedSize))
+}
+
+//unfold reads content lines, joining folded continuation lines
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxFeedSize)
+	for scanner.Scan() {
+		l := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		if l == "" {
+			continue
+		}
+		lines = append(lines, l)
+	}
+	return lines, scanner.Err()
+}
+
+//property splits a content line to upper case name without parameters and value
+func property(line string) (string, string) {
+	inQuotes := false
+	for i, c := range line {
+		switch c {
+		case '"':
+			inQuotes = !inQuotes
+		case ':':
+			if !inQuotes {
+				name := line[:i]
+				if semi := strings.IndexByte(name, ';'); semi >= 0 {
+					name = name[:semi]
+				}
+				return strings.ToUpper(name), line[i+1:]
+			}
+		}
+	}
+	return strings.ToUpper(line), ""
+}
+
+//toEvent makes an all-day event of event properties, returns false for events to skip
+func toEvent(props map[string]string) (Event, bool, error) {
+	if strings.EqualFold(props["STATUS"], "CANCELLED") {
+		return Event{}, false, nil
+	}
+	value, ok := props["DTSTART"]
+	if !ok {
+		return Event{}, false, nil
+	}
+	start, err := parseDate(value)
+	if err != nil {
+		return Event{}, false, err
+	}
+
+	end := start.AddDate(0, 0, 1)
+	if value, ok := props["DTEND"]; ok {
+		end, err = parseDate(value)
+		if err != nil {
+			return Event{}, false, err
+		}
+	} else if value, ok := props["DURATION"]; ok {
+		if m := durationDays.FindStringSubmatch(value); m != nil {
+			weeks, _ := strconv.Atoi(m[1])
+			days, _ := strconv.Atoi(m[2])
+			if weeks*7+days > 0 {
+				end = start.AddDate(0, 0, weeks*7+days)
+			}
+		}
+	}
+	if !end.After(start) {
+		end = start.AddDate(0, 0, 1)
+	}
+
+	uid := props["UID"]
+	if uid == "" {
+		uid = start.Format(dateLayout) + "-" + end.Format(dateLayout)
+	}
+	// changed occurrences of a recurring event share its UID
+	if rid, ok := props["RECURRENCE-ID"]; ok {
+		uid += "/" + rid
+	}
+
+	return Event{
+		UID:     uid,
+		Start:   start,
+		End:     end,
+		Summary: unescape(props["SUMMARY"]),
+	}, true, nil
+}
+
+//parseDate returns the date of a DATE or DATE-TIME value as UTC midnight
+func parseDate(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	d, err := time.Parse(dateLayout, value[:8])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	return d, nil
+}
+
+//unescape reverts escape
+func unescape(s string) string {
+	r := strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+	return r.Replace(s)
+}
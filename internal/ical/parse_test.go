@@ -0,0 +1,120 @@
+package ical
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestFetch(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.Dir("./testdata")))
+	defer ts.Close()
+
+	var fetchTests = []struct {
+		name     string
+		file     string
+		expected []Event
+		wantErr  bool
+	}{
+		{"airbnb", "/airbnb.ics", []Event{
+			{UID: "1418fb94e984-a1b2c3@airbnb.com", Start: day(2050, 1, 3), End: day(2050, 1, 6), Summary: "Reserved"},
+			{UID: "1418fb94e984-d4e5f6@airbnb.com", Start: day(2050, 1, 20), End: day(2050, 1, 21), Summary: "Airbnb (Not available)"},
+		}, false},
+		{"timed, cancelled and duration", "/timed.ics", []Event{
+			{UID: "timed-1@example.com", Start: day(2050, 2, 10), End: day(2050, 2, 12), Summary: "Guest, two nights"},
+			{UID: "duration-1@example.com", Start: day(2050, 4, 1), End: day(2050, 4, 8), Summary: "Long stay"},
+		}, false},
+		{"recurring", "/recurring.ics", []Event{
+			{UID: "weekend@example.com/20500115", Start: day(2050, 1, 16), End: day(2050, 1, 18), Summary: "Weekend moved"},
+			{UID: "weekend@example.com/20500101", Start: day(2050, 1, 1), End: day(2050, 1, 3), Summary: "Weekend"},
+			{UID: "weekend@example.com/20500122", Start: day(2050, 1, 22), End: day(2050, 1, 24), Summary: "Weekend"},
+			{UID: "cleaning@example.com/20500104", Start: day(2050, 1, 4), End: day(2050, 1, 5), Summary: "Cleaning"},
+			{UID: "cleaning@example.com/20500106", Start: day(2050, 1, 6), End: day(2050, 1, 7), Summary: "Cleaning"},
+			{UID: "cleaning@example.com/20500118", Start: day(2050, 1, 18), End: day(2050, 1, 19), Summary: "Cleaning"},
+			{UID: "cleaning@example.com/20500120", Start: day(2050, 1, 20), End: day(2050, 1, 21), Summary: "Cleaning"},
+			{UID: "cleaning@example.com/20500201", Start: day(2050, 2, 1), End: day(2050, 2, 2), Summary: "Cleaning"},
+			{UID: "monthly@example.com/20500131", Start: day(2050, 1, 31), End: day(2050, 2, 1), Summary: "Month end"},
+			{UID: "monthly@example.com/20500331", Start: day(2050, 3, 31), End: day(2050, 4, 1), Summary: "Month end"},
+			{UID: "monthly@example.com/20500531", Start: day(2050, 5, 31), End: day(2050, 6, 1), Summary: "Month end"},
+		}, false},
+		{"not a calendar", "/notcalendar.ics", nil, true},
+		{"missing", "/missing.ics", nil, true},
+	}
+
+	for _, e := range fetchTests {
+		events, err := Fetch(ts.Client(), ts.URL+e.file)
+		if (err != nil) != e.wantErr {
+			t.Errorf("for %s got error %v", e.name, err)
+			continue
+		}
+		if len(events) != len(e.expected) {
+			t.Errorf("for %s expected %d events but got %d", e.name, len(e.expected), len(events))
+			continue
+		}
+		for i, ev := range events {
+			want := e.expected[i]
+			if ev.UID != want.UID || !ev.Start.Equal(want.Start) || !ev.End.Equal(want.End) || ev.Summary != want.Summary {
+				t.Errorf("for %s expected %v but got %v", e.name, want, ev)
+			}
+		}
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	events := []Event{
+		{UID: "rr-1@blacklodge.xyz", Start: day(2050, 5, 1), End: day(2050, 5, 3), Summary: "Blocked; owner"},
+	}
+	var b strings.Builder
+	err := Write(&b, "Frost Suite", events, day(2050, 1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := Parse(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 1 || parsed[0] != events[0] {
+		t.Errorf("expected %v but got %v", events, parsed)
+	}
+}
+
+func TestParseNotCalendar(t *testing.T) {
+	_, err := Parse(strings.NewReader(""))
+	if !errors.Is(err, ErrNotCalendar) {
+		t.Errorf("expected ErrNotCalendar but got %v", err)
+	}
+}
+
+func TestParseRecurringWithoutEnd(t *testing.T) {
+	feed := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:daily@example.com\r\nDTSTART;VALUE=DATE:20200101\r\n" +
+		"RRULE:FREQ=DAILY\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	events, err := Parse(strings.NewReader(feed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// past days are left out and the rest is expanded for recurYears
+	if n := len(events); n < 365*recurYears || n > 366*recurYears+1 {
+		t.Errorf("expected about %d years of days but got %d events", recurYears, n)
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if len(events) > 0 && !events[0].End.After(today) {
+		t.Errorf("expected occurrences still to come, first is %v", events[0])
+	}
+}
+
+func TestParseUnsupportedRule(t *testing.T) {
+	feed := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:last@example.com\r\nDTSTART;VALUE=DATE:20500101\r\n" +
+		"RRULE:FREQ=MONTHLY;BYDAY=MO;BYSETPOS=-1\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	_, err := Parse(strings.NewReader(feed))
+	if err == nil {
+		t.Error("expected an error for an unsupported recurrence rule")
+	}
+}
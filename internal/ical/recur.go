@@ -0,0 +1,192 @@
+package ical
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//recurYears limits how far ahead recurring events without COUNT or UNTIL are expanded
+const recurYears = 2
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+//rrule is a recurrence rule of the kind calendars use for repeating blocks
+type rrule struct {
+	freq     string
+	interval int
+	count    int
+	until    time.Time
+	byDay    []time.Weekday
+	wkst     time.Weekday
+}
+
+//parseRule parses an RRULE value, rules with parts other than FREQ, INTERVAL, COUNT, UNTIL, WKST and
+//plain weekdays in BYDAY of a weekly rule are not supported
+func parseRule(value string) (rrule, error) {
+	r := rrule{interval: 1, wkst: time.Monday}
+	for _, part := range strings.Split(value, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return r, fmt.Errorf("invalid recurrence rule %q", value)
+		}
+		k, v := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		var err error
+		switch k {
+		case "FREQ":
+			r.freq = v
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(v)
+			if err == nil && r.interval < 1 {
+				err = fmt.Errorf("invalid interval")
+			}
+		case "COUNT":
+			r.count, err = strconv.Atoi(v)
+		case "UNTIL":
+			r.until, err = parseDate(v)
+		case "WKST":
+			wd, ok := weekdays[v]
+			if !ok {
+				err = fmt.Errorf("invalid week start")
+			}
+			r.wkst = wd
+		case "BYDAY":
+			for _, d := range strings.Split(v, ",") {
+				wd, ok := weekdays[d]
+				if !ok {
+					return r, fmt.Errorf("unsupported recurrence rule %q", value)
+				}
+				r.byDay = append(r.byDay, wd)
+			}
+		default:
+			return r, fmt.Errorf("unsupported recurrence rule %q", value)
+		}
+		if err != nil {
+			return r, fmt.Errorf("invalid recurrence rule %q", value)
+		}
+	}
+	switch r.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return r, fmt.Errorf("unsupported recurrence rule %q", value)
+	}
+	if len(r.byDay) > 0 && r.freq != "WEEKLY" {
+		return r, fmt.Errorf("unsupported recurrence rule %q", value)
+	}
+	return r, nil
+}
+
+//on tells if the weekly rule repeats on weekday wd
+func (r rrule) on(wd time.Weekday) bool {
+	for _, d := range r.byDay {
+		if d == wd {
+			return true
+		}
+	}
+	return false
+}
+
+//starts returns the first days of the occurrences of an event starting on start, none after limit
+func (r rrule) starts(start, limit time.Time) []time.Time {
+	if !r.until.IsZero() && r.until.Before(limit) {
+		limit = r.until
+	}
+	var days []time.Time
+	add := func(d time.Time) bool {
+		if d.After(limit) || (r.count > 0 && len(days) == r.count) {
+			return false
+		}
+		days = append(days, d)
+		return true
+	}
+
+	for n := 0; ; n++ {
+		switch r.freq {
+		case "DAILY":
+			if !add(start.AddDate(0, 0, n*r.interval)) {
+				return days
+			}
+		case "WEEKLY":
+			if len(r.byDay) == 0 {
+				if !add(start.AddDate(0, 0, 7*n*r.interval)) {
+					return days
+				}
+				continue
+			}
+			weekStart := start.AddDate(0, 0, 7*n*r.interval-(int(start.Weekday())-int(r.wkst)+7)%7)
+			for i := 0; i < 7; i++ {
+				d := weekStart.AddDate(0, 0, i)
+				if d.Before(start) || !r.on(d.Weekday()) {
+					continue
+				}
+				if !add(d) {
+					return days
+				}
+			}
+		case "MONTHLY", "YEARLY":
+			d := start.AddDate(0, n*r.interval, 0)
+			if r.freq == "YEARLY" {
+				d = start.AddDate(n*r.interval, 0, 0)
+			}
+			// months without the day of the first occurrence are skipped, like 31st in April
+			if d.Day() != start.Day() {
+				continue
+			}
+			if !add(d) {
+				return days
+			}
+		}
+	}
+}
+
+//recur expands recurring event e by rule, leaving out days in exdates and occurrences over by today.
+//Occurrences get the UID of the event followed by their first day
+func recur(e Event, rule, exdates string, today time.Time) ([]Event, error) {
+	r, err := parseRule(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := make(map[time.Time]bool)
+	for _, value := range strings.Split(exdates, ",") {
+		if value == "" {
+			continue
+		}
+		d, err := parseDate(value)
+		if err != nil {
+			return nil, err
+		}
+		excluded[d] = true
+	}
+
+	limit := today
+	if e.Start.After(limit) {
+		limit = e.Start
+	}
+	limit = limit.AddDate(recurYears, 0, 0)
+
+	nights := int(e.End.Sub(e.Start).Hours()/24 + 0.5)
+	var events []Event
+	for _, d := range r.starts(e.Start, limit) {
+		end := d.AddDate(0, 0, nights)
+		if excluded[d] || !end.After(today) {
+			continue
+		}
+		events = append(events, Event{
+			UID:     e.UID + "/" + d.Format(dateLayout),
+			Start:   d,
+			End:     end,
+			Summary: e.Summary,
+		})
+	}
+	return events, nil
+}
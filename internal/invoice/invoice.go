@@ -0,0 +1,122 @@
+//Package invoice builds invoices of reservations with Finnish VAT
+package invoice
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/payments"
+	"github.com/t-Ikonen/bbbookingsystem/internal/pricing"
+)
+
+//VAT rates in Finland in percent, prices on invoices include VAT
+const (
+	VATAccommodation float32 = 14
+	VATFood          float32 = 14
+	VATGeneral       float32 = 25.5
+)
+
+//PaymentTerm is the number of days from issue date to due date
+const PaymentTerm = 14
+
+//VATRow is the VAT of all invoice lines with the same rate
+type VATRow struct {
+	Rate  float32
+	Net   float32
+	VAT   float32
+	Gross float32
+}
+
+//ForReservation returns a new unsaved invoice of reservation res issued on day issued, billing the nights of the stay
+func ForReservation(res models.Reservation, seller models.Seller, issued time.Time) models.Invoice {
+	day := time.Date(issued.Year(), issued.Month(), issued.Day(), 0, 0, 0, 0, time.UTC)
+	inv := models.Invoice{
+		ReservationID: res.ID,
+		IssueDate:     day,
+		DueDate:       day.AddDate(0, 0, PaymentTerm),
+		BuyerName:     res.FirstName + " " + res.LastName,
+		BuyerEmail:    res.Email,
+		Seller:        seller,
+	}
+	AddLine(&inv, NightsLine(res))
+	for _, x := range res.Extras {
+		AddLine(&inv, Line(x.Name, x.Quantity, x.UnitPrice, x.VATRate))
+	}
+	return inv
+}
+
+//SetPaid sets what is paid and what is left to pay of invoice inv from payments ledger of its reservation
+func SetPaid(inv *models.Invoice, ledger []models.Payment) {
+	inv.Paid, inv.Outstanding = payments.Balance(inv.Total, ledger)
+}
+
+//NightsLine returns the accommodation line of reservation res, charging its total price without extras.
+//The line is per night when the total splits evenly to nights, otherwise one line for the whole stay
+func NightsLine(res models.Reservation) models.InvoiceLine {
+	nights := pricing.Nights(res.StartDate, res.EndDate)
+	description := fmt.Sprintf("Accommodation, %s, %s - %s, %d nights", res.Room.RoomName,
+		res.StartDate.Format("02.01.2006"), res.EndDate.Format("02.01.2006"), nights)
+
+	total := round(res.TotalPrice - res.ExtrasTotal())
+	if nights > 0 {
+		unit := round(total / float32(nights))
+		if round(unit*float32(nights)) == total {
+			return Line(description, nights, unit, VATAccommodation)
+		}
+	}
+	return Line(description, 1, total, VATAccommodation)
+}
+
+//Line returns an invoice line of quantity times unit price with VAT rate
+func Line(description string, quantity int, unitPrice, rate float32) models.InvoiceLine {
+	return models.InvoiceLine{
+		Description: description,
+		Quantity:    quantity,
+		UnitPrice:   round(unitPrice),
+		VATRate:     rate,
+		Total:       round(unitPrice * float32(quantity)),
+	}
+}
+
+//AddLine adds line l to invoice inv and updates its total
+func AddLine(inv *models.Invoice, l models.InvoiceLine) {
+	inv.Lines = append(inv.Lines, l)
+	inv.Total = round(inv.Total + l.Total)
+}
+
+//Breakdown returns VAT of lines by rate, highest rate first
+func Breakdown(lines []models.InvoiceLine) []VATRow {
+	gross := make(map[float32]float32)
+	for _, l := range lines {
+		gross[l.VATRate] += l.Total
+	}
+
+	var rows []VATRow
+	for rate, g := range gross {
+		g = round(g)
+		net := round(g * 100 / (100 + rate))
+		rows = append(rows, VATRow{Rate: rate, Net: net, VAT: round(g - net), Gross: g})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Rate > rows[j].Rate })
+	return rows
+}
+
+//Reference returns the Finnish payment reference of invoice number, the number followed by a 7-3-1 check digit
+func Reference(number int) string {
+	base := strconv.Itoa(number)
+	weights := []int{7, 3, 1}
+	sum := 0
+	for i := 0; i < len(base); i++ {
+		digit := int(base[len(base)-1-i] - '0')
+		sum += digit * weights[i%3]
+	}
+	return base + strconv.Itoa((10-sum%10)%10)
+}
+
+func round(f float32) float32 {
+	return float32(math.Round(float64(f)*100) / 100)
+}
@@ -0,0 +1,179 @@
+package invoice
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+)
+
+var seller = models.Seller{
+	Name:       "Blacklodge B&B",
+	BusinessID: "1234567-8",
+	Address:    "Lodge Road 1, 99999 Twin Peaks",
+	Email:      "ed.glen@blacklodge.xyz",
+	IBAN:       "FI21 1234 5600 0007 85",
+}
+
+var nightsTests = []struct {
+	name             string
+	total            float32
+	expectedQuantity int
+	expectedUnit     float32
+}{
+	{"even", 300, 3, 100},
+	{"cents", 301.5, 3, 100.5},
+	{"uneven", 340, 1, 340},
+}
+
+func TestNightsLine(t *testing.T) {
+	for _, e := range nightsTests {
+		res := models.Reservation{
+			StartDate:  time.Date(2050, 11, 10, 0, 0, 0, 0, time.UTC),
+			EndDate:    time.Date(2050, 11, 13, 0, 0, 0, 0, time.UTC),
+			TotalPrice: e.total,
+		}
+		l := NightsLine(res)
+		if l.Quantity != e.expectedQuantity || l.UnitPrice != e.expectedUnit {
+			t.Errorf("for %s expected %d x %.2f but got %d x %.2f", e.name, e.expectedQuantity, e.expectedUnit, l.Quantity, l.UnitPrice)
+		}
+		if l.Total != e.total {
+			t.Errorf("for %s expected total %.2f but got %.2f", e.name, e.total, l.Total)
+		}
+		if l.VATRate != VATAccommodation {
+			t.Errorf("for %s expected VAT %g but got %g", e.name, VATAccommodation, l.VATRate)
+		}
+	}
+}
+
+func TestForReservation(t *testing.T) {
+	res := models.Reservation{
+		ID:         3,
+		FirstName:  "Dale",
+		LastName:   "Cooper",
+		Email:      "dale@fbi.gov",
+		StartDate:  time.Date(2050, 11, 7, 0, 0, 0, 0, time.UTC),
+		EndDate:    time.Date(2050, 11, 9, 0, 0, 0, 0, time.UTC),
+		TotalPrice: 200,
+	}
+	inv := ForReservation(res, seller, time.Date(2050, 11, 9, 15, 30, 0, 0, time.UTC))
+
+	if inv.ReservationID != 3 || inv.BuyerName != "Dale Cooper" || inv.BuyerEmail != "dale@fbi.gov" {
+		t.Errorf("wrong buyer %d %s %s", inv.ReservationID, inv.BuyerName, inv.BuyerEmail)
+	}
+	if !inv.IssueDate.Equal(time.Date(2050, 11, 9, 0, 0, 0, 0, time.UTC)) || !inv.DueDate.Equal(time.Date(2050, 11, 23, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("wrong dates %s %s", inv.IssueDate, inv.DueDate)
+	}
+	if len(inv.Lines) != 1 || inv.Total != 200 {
+		t.Errorf("expected one line of 200 but got %d lines of %.2f", len(inv.Lines), inv.Total)
+	}
+
+	AddLine(&inv, Line("Sauna", 2, 12.5, VATGeneral))
+	if inv.Total != 225 {
+		t.Errorf("expected total 225 after adding line but got %.2f", inv.Total)
+	}
+}
+
+func TestForReservationWithExtras(t *testing.T) {
+	res := models.Reservation{
+		StartDate:  time.Date(2050, 11, 7, 0, 0, 0, 0, time.UTC),
+		EndDate:    time.Date(2050, 11, 9, 0, 0, 0, 0, time.UTC),
+		TotalPrice: 265,
+		Extras: []models.ReservationExtra{
+			{Name: "Breakfast", Quantity: 2, UnitPrice: 12.5, Total: 25, VATRate: VATFood},
+			{Name: "Sauna evening", Quantity: 1, UnitPrice: 40, Total: 40, VATRate: VATGeneral},
+		},
+	}
+	inv := ForReservation(res, seller, time.Date(2050, 11, 9, 15, 30, 0, 0, time.UTC))
+
+	if len(inv.Lines) != 3 || inv.Total != 265 {
+		t.Fatalf("expected three lines of 265 but got %d lines of %.2f", len(inv.Lines), inv.Total)
+	}
+	if inv.Lines[0].Quantity != 2 || inv.Lines[0].UnitPrice != 100 {
+		t.Errorf("expected two nights of 100 but got %d of %.2f", inv.Lines[0].Quantity, inv.Lines[0].UnitPrice)
+	}
+	if inv.Lines[2].Description != "Sauna evening" || inv.Lines[2].VATRate != VATGeneral || inv.Lines[2].Total != 40 {
+		t.Errorf("wrong extra line %+v", inv.Lines[2])
+	}
+}
+
+func TestBreakdown(t *testing.T) {
+	lines := []models.InvoiceLine{
+		Line("Accommodation", 2, 100, VATAccommodation),
+		Line("Breakfast", 2, 14.25, VATFood),
+		Line("Sauna", 1, 25.5, VATGeneral),
+	}
+	rows := Breakdown(lines)
+	expected := []VATRow{
+		{Rate: 25.5, Net: 20.32, VAT: 5.18, Gross: 25.5},
+		{Rate: 14, Net: 200.44, VAT: 28.06, Gross: 228.5},
+	}
+	if len(rows) != len(expected) {
+		t.Fatalf("expected %d rows but got %d", len(expected), len(rows))
+	}
+	for i, e := range expected {
+		if rows[i] != e {
+			t.Errorf("row %d expected %+v but got %+v", i, e, rows[i])
+		}
+	}
+}
+
+var referenceTests = []struct {
+	number   int
+	expected string
+}{
+	{1001, "10016"},
+	{1234, "12344"},
+	{123456, "1234561"},
+}
+
+func TestReference(t *testing.T) {
+	for _, e := range referenceTests {
+		if ref := Reference(e.number); ref != e.expected {
+			t.Errorf("for %d expected %s but got %s", e.number, e.expected, ref)
+		}
+	}
+}
+
+func TestSetPaid(t *testing.T) {
+	inv := models.Invoice{Total: 200}
+	ledger := []models.Payment{
+		{Kind: models.PaymentKindPayment, Amount: 60, Provider: "fake", IntentID: "fake_pi_1"},
+		{Kind: models.PaymentKindPayment, Amount: 50, Provider: models.PaymentProviderVoucher, IntentID: "GIFT-1111"},
+		{Kind: models.PaymentKindRefund, Amount: 10, Provider: "fake", IntentID: "fake_pi_1"},
+	}
+	SetPaid(&inv, ledger)
+	if inv.Paid != 100 || inv.Outstanding != 100 {
+		t.Errorf("expected 100.00 paid and 100.00 outstanding but got %.2f and %.2f", inv.Paid, inv.Outstanding)
+	}
+	if toPay(inv) != 100 {
+		t.Errorf("expected 100.00 to pay but got %.2f", toPay(inv))
+	}
+
+	SetPaid(&inv, nil)
+	if toPay(inv) != 200 {
+		t.Errorf("expected total to pay without payments but got %.2f", toPay(inv))
+	}
+}
+
+func TestPDF(t *testing.T) {
+	res := models.Reservation{
+		FirstName:  "Dale",
+		LastName:   "Cooper",
+		StartDate:  time.Date(2050, 11, 7, 0, 0, 0, 0, time.UTC),
+		EndDate:    time.Date(2050, 11, 9, 0, 0, 0, 0, time.UTC),
+		TotalPrice: 200,
+	}
+	inv := ForReservation(res, seller, time.Date(2050, 11, 9, 0, 0, 0, 0, time.UTC))
+	inv.Number = 1001
+
+	var buf bytes.Buffer
+	err := PDF(&buf, inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")) {
+		t.Error("output is not a PDF document")
+	}
+}
@@ -0,0 +1,105 @@
+package invoice
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+)
+
+//PDF writes invoice inv to w as an A4 PDF document
+func PDF(w io.Writer, inv models.Invoice) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	// core fonts are cp1252, the translator maps € and Finnish letters to it
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetTitle(fmt.Sprintf("Invoice %d", inv.Number), true)
+	pdf.SetAuthor(inv.Seller.Name, true)
+	pdf.SetMargins(20, 20, 20)
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(110, 8, tr(inv.Seller.Name), "", 0, "L", false, 0, "")
+	pdf.CellFormat(0, 8, "INVOICE", "", 1, "R", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.MultiCell(110, 5, tr(fmt.Sprintf("%s\nBusiness ID %s\n%s", inv.Seller.Address, inv.Seller.BusinessID, inv.Seller.Email)), "", "L", false)
+	pdf.Ln(6)
+
+	details := [][2]string{
+		{"Invoice number", fmt.Sprintf("%d", inv.Number)},
+		{"Invoice date", inv.IssueDate.Format("02.01.2006")},
+		{"Due date", inv.DueDate.Format("02.01.2006")},
+		{"Reference", Reference(inv.Number)},
+		{"IBAN", inv.Seller.IBAN},
+	}
+	top := pdf.GetY()
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(110, 5, "Bill to", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.MultiCell(110, 5, tr(inv.BuyerName+"\n"+inv.BuyerEmail), "", "L", false)
+	pdf.SetY(top)
+	for _, d := range details {
+		pdf.SetX(130)
+		pdf.CellFormat(30, 5, d[0], "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 5, tr(d[1]), "", 1, "R", false, 0, "")
+	}
+	pdf.Ln(10)
+
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(90, 7, "Description", "B", 0, "L", false, 0, "")
+	pdf.CellFormat(15, 7, "Qty", "B", 0, "R", false, 0, "")
+	pdf.CellFormat(25, 7, "Unit price", "B", 0, "R", false, 0, "")
+	pdf.CellFormat(15, 7, "VAT", "B", 0, "R", false, 0, "")
+	pdf.CellFormat(0, 7, "Total", "B", 1, "R", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	for _, l := range inv.Lines {
+		pdf.CellFormat(90, 7, tr(l.Description), "", 0, "L", false, 0, "")
+		pdf.CellFormat(15, 7, fmt.Sprintf("%d", l.Quantity), "", 0, "R", false, 0, "")
+		pdf.CellFormat(25, 7, tr(money(l.UnitPrice)), "", 0, "R", false, 0, "")
+		pdf.CellFormat(15, 7, fmt.Sprintf("%g %%", l.VATRate), "", 0, "R", false, 0, "")
+		pdf.CellFormat(0, 7, tr(money(l.Total)), "", 1, "R", false, 0, "")
+	}
+	pdf.Ln(6)
+
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.SetX(90)
+	pdf.CellFormat(20, 7, "VAT", "B", 0, "R", false, 0, "")
+	pdf.CellFormat(25, 7, "Net", "B", 0, "R", false, 0, "")
+	pdf.CellFormat(20, 7, "Tax", "B", 0, "R", false, 0, "")
+	pdf.CellFormat(0, 7, "Gross", "B", 1, "R", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	for _, v := range Breakdown(inv.Lines) {
+		pdf.SetX(90)
+		pdf.CellFormat(20, 7, fmt.Sprintf("%g %%", v.Rate), "", 0, "R", false, 0, "")
+		pdf.CellFormat(25, 7, tr(money(v.Net)), "", 0, "R", false, 0, "")
+		pdf.CellFormat(20, 7, tr(money(v.VAT)), "", 0, "R", false, 0, "")
+		pdf.CellFormat(0, 7, tr(money(v.Gross)), "", 1, "R", false, 0, "")
+	}
+	if inv.Paid > 0 {
+		pdf.SetX(90)
+		pdf.CellFormat(65, 7, "Total", "T", 0, "R", false, 0, "")
+		pdf.CellFormat(0, 7, tr(money(inv.Total)), "T", 1, "R", false, 0, "")
+		pdf.SetX(90)
+		pdf.CellFormat(65, 7, "Paid", "", 0, "R", false, 0, "")
+		pdf.CellFormat(0, 7, tr(money(-inv.Paid)), "", 1, "R", false, 0, "")
+	}
+	pdf.SetFont("Helvetica", "B", 12)
+	pdf.SetX(90)
+	pdf.CellFormat(65, 9, "Total to pay", "T", 0, "R", false, 0, "")
+	pdf.CellFormat(0, 9, tr(money(toPay(inv))), "T", 1, "R", false, 0, "")
+
+	return pdf.Output(w)
+}
+
+//toPay returns what is left to pay of invoice inv, all of it when nothing is paid
+func toPay(inv models.Invoice) float32 {
+	if inv.Paid > 0 {
+		return inv.Outstanding
+	}
+	return inv.Total
+}
+
+func money(f float32) string {
+	return fmt.Sprintf("%.2f €", f)
+}
@@ -0,0 +1,72 @@
+//Package lifecycle holds the reservation states and the allowed changes between them
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+)
+
+//ErrTransition is returned for status changes the lifecycle does not allow
+var ErrTransition = errors.New("reservation status change is not allowed")
+
+//Statuses lists all reservation states in lifecycle order
+var Statuses = []string{
+	models.StatusPending,
+	models.StatusConfirmed,
+	models.StatusCheckedIn,
+	models.StatusCheckedOut,
+	models.StatusCancelled,
+	models.StatusNoShow,
+}
+
+//transitions maps a status to the statuses it can change to, cancelled, checked-out and no-show are final
+var transitions = map[string][]string{
+	models.StatusPending:   {models.StatusConfirmed, models.StatusCancelled},
+	models.StatusConfirmed: {models.StatusCheckedIn, models.StatusNoShow, models.StatusCancelled},
+	models.StatusCheckedIn: {models.StatusCheckedOut},
+}
+
+var labels = map[string]string{
+	models.StatusPending:    "Pending",
+	models.StatusConfirmed:  "Confirmed",
+	models.StatusCheckedIn:  "Checked in",
+	models.StatusCheckedOut: "Checked out",
+	models.StatusCancelled:  "Cancelled",
+	models.StatusNoShow:     "No-show",
+}
+
+//Valid tells if status is a known reservation status
+func Valid(status string) bool {
+	_, ok := labels[status]
+	return ok
+}
+
+//Label returns status in human readable form
+func Label(status string) string {
+	if l, ok := labels[status]; ok {
+		return l
+	}
+	return status
+}
+
+//Open tells if a reservation in status is still upcoming, so its dates can change and it can be cancelled
+func Open(status string) bool {
+	return status == models.StatusPending || status == models.StatusConfirmed
+}
+
+//Next returns the statuses a reservation in status from can change to
+func Next(from string) []string {
+	return transitions[from]
+}
+
+//Check returns ErrTransition if a reservation cannot change from status from to status to
+func Check(from, to string) error {
+	for _, s := range transitions[from] {
+		if s == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s to %s", ErrTransition, Label(from), Label(to))
+}
@@ -0,0 +1,73 @@
+package lifecycle
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+)
+
+var checkTests = []struct {
+	from    string
+	to      string
+	allowed bool
+}{
+	{models.StatusPending, models.StatusConfirmed, true},
+	{models.StatusPending, models.StatusCancelled, true},
+	{models.StatusPending, models.StatusCheckedIn, false},
+	{models.StatusConfirmed, models.StatusCheckedIn, true},
+	{models.StatusConfirmed, models.StatusNoShow, true},
+	{models.StatusConfirmed, models.StatusCancelled, true},
+	{models.StatusConfirmed, models.StatusPending, false},
+	{models.StatusCheckedIn, models.StatusCheckedOut, true},
+	{models.StatusCheckedIn, models.StatusCancelled, false},
+	{models.StatusCheckedOut, models.StatusCheckedIn, false},
+	{models.StatusCancelled, models.StatusConfirmed, false},
+	{models.StatusNoShow, models.StatusCheckedIn, false},
+	{"unknown", models.StatusConfirmed, false},
+}
+
+func TestCheck(t *testing.T) {
+	for _, e := range checkTests {
+		err := Check(e.from, e.to)
+		if e.allowed && err != nil {
+			t.Errorf("%s to %s should be allowed but got %s", e.from, e.to, err)
+		}
+		if !e.allowed && !errors.Is(err, ErrTransition) {
+			t.Errorf("%s to %s should not be allowed", e.from, e.to)
+		}
+	}
+}
+
+func TestNextIsChecked(t *testing.T) {
+	for _, from := range Statuses {
+		for _, to := range Next(from) {
+			if !Valid(to) {
+				t.Errorf("%s changes to unknown status %s", from, to)
+			}
+			if err := Check(from, to); err != nil {
+				t.Errorf("Next gives %s to %s but Check says %s", from, to, err)
+			}
+		}
+	}
+	if len(Next(models.StatusCancelled)) != 0 {
+		t.Error("cancelled should be a final status")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	for _, s := range Statuses {
+		if Open(s) != (Check(s, models.StatusCancelled) == nil) {
+			t.Errorf("%s should be open only if it can be cancelled", s)
+		}
+	}
+}
+
+func TestLabel(t *testing.T) {
+	if Label(models.StatusCheckedIn) != "Checked in" {
+		t.Errorf("unexpected label %s", Label(models.StatusCheckedIn))
+	}
+	if Label("unknown") != "unknown" {
+		t.Errorf("unknown status should be its own label")
+	}
+}
@@ -24,17 +24,40 @@ type User struct {
 	ModifiedAt  time.Time
 }
 
-//Room hold room model
-type Room struct {
+//Access levels of users, owners have the default AccessAdmin and housekeeping users get cleaning tasks
+const (
+	AccessAdmin        = 1
+	AccessHousekeeping = 2
+)
+
+//APIToken is a user's API token, only the hash of the token is stored
+type APIToken struct {
 	ID         int
-	RoomName   string
-	Minibar    bool
-	Shower     bool
-	PricingId  int
+	UserID     int
+	Name       string
+	TokenHash  string
+	LastUsedAt time.Time
 	CreatedAt  time.Time
 	ModifiedAt time.Time
 }
 
+//Room hold room model, ICalToken is the secret of the room calendar feed URL
+type Room struct {
+	ID           int
+	RoomName     string
+	Minibar      bool
+	Shower       bool
+	PricingId    int
+	Description  string
+	Active       bool
+	MaxOccupancy int
+	ICalToken    string
+	//CancellationPolicyID is 0 when the room has no policy
+	CancellationPolicyID int
+	CreatedAt            time.Time
+	ModifiedAt           time.Time
+}
+
 //Restriction is restriction model
 type Restriction struct {
 	ID              int
@@ -55,11 +78,74 @@ type Reservation struct {
 	RoomId     int
 	CreatedAt  time.Time
 	ModifiedAt time.Time
-	Processed  int
-	Room       Room
+	Status     string
+	TotalPrice float32
+	Adults     int
+	Children   int
+	//time of each status change, zero until the reservation gets to that status
+	ConfirmedAt  time.Time
+	CheckedInAt  time.Time
+	CheckedOutAt time.Time
+	NoShowAt     time.Time
+	CancelledAt  time.Time
+	RefundAmount float32
+	//PromoCodeID is 0 when no promo code was used, DiscountAmount is already taken off TotalPrice
+	PromoCodeID    int
+	PromoCode      string
+	DiscountAmount float32
+	//VoucherID and VoucherAmount are set while booking with a gift voucher, VoucherAmount is paid from its balance
+	VoucherID     int
+	VoucherCode   string
+	VoucherAmount float32
+	//Extras are the extras booked with the reservation, their total is included in TotalPrice
+	Extras []ReservationExtra
+	//PaymentDueAt is set while the reservation waits for its deposit, unpaid it is cancelled after that
+	PaymentDueAt time.Time
+	Room         Room
 }
 
-//RoomRestrictions is RoomRestrictions model
+//Guests returns number of people staying
+func (r Reservation) Guests() int {
+	return r.Adults + r.Children
+}
+
+//Cancelled tells if the reservation is cancelled
+func (r Reservation) Cancelled() bool {
+	return r.Status == StatusCancelled
+}
+
+//ExtrasTotal returns the price of the extras booked with the reservation
+func (r Reservation) ExtrasTotal() float32 {
+	var total float32
+	for _, x := range r.Extras {
+		total += x.Total
+	}
+	return total
+}
+
+//Reservation statuses, allowed changes between them are in package lifecycle
+const (
+	StatusPending    = "pending"
+	StatusConfirmed  = "confirmed"
+	StatusCheckedIn  = "checked-in"
+	StatusCheckedOut = "checked-out"
+	StatusCancelled  = "cancelled"
+	StatusNoShow     = "no-show"
+)
+
+//Restriction types in restrictions table
+const (
+	RestrictionReservation       = 1
+	RestrictionOwnerBlock        = 2
+	RestrictionMinNights         = 3
+	RestrictionMaxNights         = 4
+	RestrictionClosedToArrival   = 5
+	RestrictionClosedToDeparture = 6
+	RestrictionHold              = 7
+)
+
+//RoomRestrictions is RoomRestrictions model, RuleValue is nights for minimum and maximum stay rules,
+//ImportID and ExternalUID identify owner blocks mirrored from an external calendar
 type RoomRestriction struct {
 	ID            int
 	StartDate     time.Time
@@ -69,16 +155,332 @@ type RoomRestriction struct {
 	CreatedAt     time.Time
 	ModifiedAt    time.Time
 	RestrictionId int
+	RuleValue     int
+	ImportID      int
+	ExternalUID   string
 	Room          Room
 	Reservation   Reservation
 	Restriction   Restriction
 }
 
+//ICalImport is an external calendar mirrored as owner blocks of a room, read from URL or from uploaded Data
+type ICalImport struct {
+	ID           int
+	RoomID       int
+	Name         string
+	URL          string
+	Data         string
+	LastSyncedAt time.Time
+	LastError    string
+	CreatedAt    time.Time
+	ModifiedAt   time.Time
+	Room         Room
+}
+
+//CancellationPolicy is cancellation policy model, Tiers tell the refund for cancelling some days before arrival
+type CancellationPolicy struct {
+	ID         int
+	Name       string
+	Tiers      []CancellationTier
+	CreatedAt  time.Time
+	ModifiedAt time.Time
+}
+
+//CancellationTier refunds RefundPercent of the total when cancelled at least DaysBefore days before arrival
+type CancellationTier struct {
+	ID            int
+	PolicyID      int
+	DaysBefore    int
+	RefundPercent int
+	CreatedAt     time.Time
+	ModifiedAt    time.Time
+}
+
+//AuditEntry is audit_log model, Before and After are the entity as JSON, empty when there is none
+type AuditEntry struct {
+	ID         int
+	UserID     int
+	Action     string
+	Entity     string
+	EntityID   int
+	Before     string
+	After      string
+	CreatedAt  time.Time
+	ModifiedAt time.Time
+	User       User
+}
+
+//AuditFilter selects audit entries, zero fields match all entries
+type AuditFilter struct {
+	UserID   int
+	Action   string
+	Entity   string
+	EntityID int
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+//Pricing is pricing model, price is the base rate for one night
+type Pricing struct {
+	ID            int
+	RoomName      string
+	Price         float32
+	WeekendUplift float32
+	//CancellationPolicyID is used for rooms of the rate plan without own policy, 0 when none
+	CancellationPolicyID int
+	Seasons              []SeasonalPrice
+	CreatedAt            time.Time
+	ModifiedAt           time.Time
+}
+
+//SeasonalPrice is seasonal_pricing model, overrides base rate between dates
+type SeasonalPrice struct {
+	ID         int
+	PricingId  int
+	StartDate  time.Time
+	EndDate    time.Time
+	Price      float32
+	CreatedAt  time.Time
+	ModifiedAt time.Time
+}
+
+//WaitlistEntry is waitlist model, guest waiting for a room for the dates
+type WaitlistEntry struct {
+	ID         int
+	FirstName  string
+	LastName   string
+	Email      string
+	Phone      string
+	StartDate  time.Time
+	EndDate    time.Time
+	Adults     int
+	Children   int
+	NotifiedAt time.Time
+	CreatedAt  time.Time
+	ModifiedAt time.Time
+}
+
+//AlternativeStay is a free window of the searched length in a room, shifted from the searched dates
+type AlternativeStay struct {
+	RoomID    int
+	RoomName  string
+	StartDate time.Time
+	EndDate   time.Time
+	Shift     int
+}
+
+//Seller is the business details printed on invoices
+type Seller struct {
+	Name       string
+	BusinessID string
+	Address    string
+	Email      string
+	IBAN       string
+}
+
+//Invoice is invoices model, Seller is copied on the invoice when it is created
+type Invoice struct {
+	ID            int
+	Number        int
+	ReservationID int
+	IssueDate     time.Time
+	DueDate       time.Time
+	BuyerName     string
+	BuyerEmail    string
+	Seller        Seller
+	Total         float32
+	Lines         []InvoiceLine
+	//Paid is paid of the reservation so far, deposits and gift vouchers included, and Outstanding the rest of Total.
+	//Both come from the payments ledger when the invoice is shown and are not stored
+	Paid        float32
+	Outstanding float32
+	CreatedAt   time.Time
+	ModifiedAt  time.Time
+}
+
+//InvoiceLine is invoice_lines model, prices include VAT of VATRate percent
+type InvoiceLine struct {
+	ID          int
+	InvoiceID   int
+	Description string
+	Quantity    int
+	UnitPrice   float32
+	VATRate     float32
+	Total       float32
+	CreatedAt   time.Time
+	ModifiedAt  time.Time
+}
+
+//PromoCode is promo_codes model. Value is percent or euros by Kind, UsageLimit 0 means no limit
+//and a code without RoomIDs is valid for all rooms. TimesUsed counts bookings made with the code,
+//Bookings and TotalDiscount are of the bookings that are not cancelled
+type PromoCode struct {
+	ID            int
+	Code          string
+	Kind          string
+	Value         float32
+	ValidFrom     time.Time
+	ValidTo       time.Time
+	MinNights     int
+	UsageLimit    int
+	TimesUsed     int
+	RoomIDs       []int
+	Bookings      int
+	TotalDiscount float32
+	CreatedAt     time.Time
+	ModifiedAt    time.Time
+}
+
+//Promo code kinds
+const (
+	PromoPercent = "percent"
+	PromoFixed   = "fixed"
+)
+
+//Extra is extras model, an add-on guests can book with a room. Price is per Unit and
+//an extra without RoomIDs is available for all rooms
+type Extra struct {
+	ID          int
+	Name        string
+	Description string
+	Price       float32
+	Unit        string
+	VATRate     float32
+	RoomIDs     []int
+	CreatedAt   time.Time
+	ModifiedAt  time.Time
+}
+
+//Extra units, the price is per night of the stay, per guest or once for the stay
+const (
+	ExtraPerNight  = "night"
+	ExtraPerPerson = "person"
+	ExtraPerStay   = "stay"
+)
+
+//ReservationExtra is reservation_extras model, an extra booked with a reservation.
+//Name, Unit, UnitPrice and VATRate are copied from the extra when booked, ExtraID is 0 when the extra is deleted
+type ReservationExtra struct {
+	ID            int
+	ReservationID int
+	ExtraID       int
+	Name          string
+	Unit          string
+	Quantity      int
+	UnitPrice     float32
+	Total         float32
+	VATRate       float32
+	CreatedAt     time.Time
+	ModifiedAt    time.Time
+}
+
+//Voucher is vouchers model, a gift voucher worth Amount of which Balance is left to spend.
+//Vouchers bought by guests have the payment intent in PaymentRef
+type Voucher struct {
+	ID            int
+	Code          string
+	Amount        float32
+	Balance       float32
+	ExpiresAt     time.Time
+	BuyerName     string
+	BuyerEmail    string
+	RecipientName string
+	Message       string
+	PaymentRef    string
+	Redemptions   []VoucherRedemption
+	CreatedAt     time.Time
+	ModifiedAt    time.Time
+}
+
+//VoucherRedemption is voucher_redemptions model, Amount of a voucher spent on a reservation
+type VoucherRedemption struct {
+	ID            int
+	VoucherID     int
+	ReservationID int
+	Amount        float32
+	CreatedAt     time.Time
+	ModifiedAt    time.Time
+}
+
+//Payment is payments model, a row in the ledger of money moved for a reservation.
+//ProviderRef is the provider's id of the payment or refund, IntentID the payment intent it belongs to
+type Payment struct {
+	ID            int
+	ReservationID int
+	Kind          string
+	Amount        float32
+	Provider      string
+	ProviderRef   string
+	IntentID      string
+	CreatedAt     time.Time
+	ModifiedAt    time.Time
+}
+
+//Payment kinds in payments ledger
+const (
+	PaymentKindPayment = "payment"
+	PaymentKindRefund  = "refund"
+)
+
+//PaymentProviderVoucher is the provider of payments made with gift vouchers, their IntentID is the voucher code
+const PaymentProviderVoucher = "voucher"
+
+//Housekeeping statuses of a room, allowed changes between them are in package housekeeping
+const (
+	RoomDirty     = "dirty"
+	RoomCleaning  = "cleaning"
+	RoomClean     = "clean"
+	RoomInspected = "inspected"
+)
+
+//Housekeeping task kinds, a turnover is a departure and an arrival in the same room on the same day
+const (
+	TaskTurnover  = "turnover"
+	TaskDeparture = "departure"
+	TaskArrival   = "arrival"
+	TaskStayOver  = "stay-over"
+)
+
+//RoomStatus is room_statuses model, housekeeping status of a room and the user who changed it last
+type RoomStatus struct {
+	RoomID     int
+	Status     string
+	UserID     int
+	CreatedAt  time.Time
+	ModifiedAt time.Time
+	Room       Room
+}
+
+//HousekeepingTask is a room to clean on Date, derived from the stays of the room.
+//Departing, Arriving and Staying are the reservations behind the task, zero when there is none.
+//Stays imported from other channels have a room and dates but no reservation ID or guest details.
+//AssignedTo is 0 when no housekeeping user has the task
+type HousekeepingTask struct {
+	Date       time.Time
+	RoomID     int
+	Kind       string
+	Status     string
+	AssignedTo int
+	Departing  Reservation
+	Arriving   Reservation
+	Staying    Reservation
+	Room       Room
+}
+
 //maildata hold email data struct
 type MailData struct {
-	To       string
-	From     string
-	Subject  string
-	Message  string
-	Template string
+	To          string
+	From        string
+	Subject     string
+	Message     string
+	Template    string
+	Attachments []MailAttachment
+}
+
+//MailAttachment is a file attached to an email
+type MailAttachment struct {
+	Name     string
+	MimeType string
+	Data     []byte
 }
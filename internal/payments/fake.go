@@ -0,0 +1,134 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+//Test payment methods of the fake provider, any other method succeeds too
+const (
+	FakeCardOK       = "tok_visa"
+	FakeCardDeclined = "tok_declined"
+)
+
+//FakeSignatureHeader carries the signature of fake provider webhook calls
+const FakeSignatureHeader = "X-Fake-Signature"
+
+//Fake is a payment provider kept in memory for development and tests, no money moves
+type Fake struct {
+	mu      sync.Mutex
+	secret  []byte
+	next    int
+	intents map[string]*fakeIntent
+}
+
+type fakeIntent struct {
+	Intent
+	refunded float32
+}
+
+//NewFake returns a fake provider signing its webhook calls with secret
+func NewFake(secret []byte) *Fake {
+	return &Fake{
+		secret:  secret,
+		intents: make(map[string]*fakeIntent),
+	}
+}
+
+//Name identifies the provider in the payments ledger
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+//Live tells if the provider moves real money, the fake never does
+func (f *Fake) Live() bool {
+	return false
+}
+
+//CreateIntent starts a payment of amount for reference
+func (f *Fake) CreateIntent(amount float32, reference string) (Intent, error) {
+	if amount <= 0 {
+		return Intent{}, errors.New("payment amount must be positive")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.next++
+	in := Intent{
+		ID:        fmt.Sprintf("fake_pi_%d", f.next),
+		Amount:    round(amount),
+		Reference: reference,
+		Status:    IntentRequiresPayment,
+	}
+	f.intents[in.ID] = &fakeIntent{Intent: in}
+	return in, nil
+}
+
+//Capture charges an intent, FakeCardDeclined is declined. Capturing a captured intent again does nothing
+func (f *Fake) Capture(intentID, paymentMethod string) (Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	in, ok := f.intents[intentID]
+	if !ok {
+		return Intent{}, ErrUnknownIntent
+	}
+	if in.Status == IntentSucceeded {
+		return in.Intent, nil
+	}
+	if paymentMethod == FakeCardDeclined {
+		return in.Intent, ErrDeclined
+	}
+	in.Status = IntentSucceeded
+	return in.Intent, nil
+}
+
+//Refund returns amount of a captured intent, refunds together cannot exceed the captured amount
+func (f *Fake) Refund(intentID string, amount float32) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	in, ok := f.intents[intentID]
+	if !ok {
+		return "", ErrUnknownIntent
+	}
+	if in.Status != IntentSucceeded {
+		return "", errors.New("payment is not captured")
+	}
+	if amount <= 0 || round(in.refunded+amount) > in.Amount {
+		return "", errors.New("refund exceeds the payment")
+	}
+	in.refunded = round(in.refunded + amount)
+	f.next++
+	return fmt.Sprintf("fake_re_%d", f.next), nil
+}
+
+//VerifyWebhook checks the payload is signed with the secret of the provider
+func (f *Fake) VerifyWebhook(payload []byte, header http.Header) (Event, error) {
+	var e Event
+	// without a secret anyone could sign, so nothing is accepted
+	if len(f.secret) == 0 {
+		return e, ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(header.Get(FakeSignatureHeader)), []byte(f.Sign(payload))) {
+		return e, ErrInvalidSignature
+	}
+	err := json.Unmarshal(payload, &e)
+	if err != nil {
+		return e, err
+	}
+	return e, nil
+}
+
+//Sign returns the signature of a webhook payload, used to send webhook calls in development and tests
+func (f *Fake) Sign(payload []byte) string {
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
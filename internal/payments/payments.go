@@ -0,0 +1,108 @@
+//Package payments takes guest payments through a payment provider
+package payments
+
+import (
+	"errors"
+	"math"
+	"net/http"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+)
+
+var (
+	//ErrDeclined is returned when the provider declines the payment method
+	ErrDeclined = errors.New("payment was declined")
+	//ErrUnknownIntent is returned for payment intents the provider does not know
+	ErrUnknownIntent = errors.New("unknown payment intent")
+	//ErrInvalidSignature is returned for webhook calls not signed by the provider
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+//Payment intent statuses
+const (
+	IntentRequiresPayment = "requires_payment"
+	IntentSucceeded       = "succeeded"
+)
+
+//Webhook event types
+const (
+	EventPaymentSucceeded = "payment.succeeded"
+	EventRefunded         = "payment.refunded"
+)
+
+//Intent is a payment of Amount started with the provider, Reference is our reservation id
+type Intent struct {
+	ID        string
+	Amount    float32
+	Reference string
+	Status    string
+}
+
+//Event is a verified webhook call from the provider, RefundID is set for refunds
+type Event struct {
+	Type      string  `json:"type"`
+	IntentID  string  `json:"intent_id"`
+	RefundID  string  `json:"refund_id,omitempty"`
+	Reference string  `json:"reference"`
+	Amount    float32 `json:"amount"`
+}
+
+//Provider is a payment service provider
+type Provider interface {
+	//Name identifies the provider in the payments ledger
+	Name() string
+	//Live tells if the provider moves real money, providers that do not cannot be used in production
+	Live() bool
+	//CreateIntent starts a payment of amount for reference
+	CreateIntent(amount float32, reference string) (Intent, error)
+	//Capture charges an intent with the payment method the guest gave to the provider
+	Capture(intentID, paymentMethod string) (Intent, error)
+	//Refund returns amount of a captured intent to the guest and returns the provider's refund id
+	Refund(intentID string, amount float32) (string, error)
+	//VerifyWebhook checks a webhook call was sent by the provider and returns its event
+	VerifyWebhook(payload []byte, header http.Header) (Event, error)
+}
+
+//Deposit returns percent of total, rounded to cents
+func Deposit(total float32, percent int) float32 {
+	return round(total * float32(percent) / 100)
+}
+
+//Balance returns the amount paid in ledger, refunds taken off, and what is outstanding of total
+func Balance(total float32, ledger []models.Payment) (paid, outstanding float32) {
+	for _, p := range ledger {
+		switch p.Kind {
+		case models.PaymentKindPayment:
+			paid += p.Amount
+		case models.PaymentKindRefund:
+			paid -= p.Amount
+		}
+	}
+	paid = round(paid)
+	outstanding = round(total - paid)
+	if outstanding < 0 {
+		outstanding = 0
+	}
+	return paid, outstanding
+}
+
+//Refundable returns how much of each captured intent in ledger is not refunded yet, by intent id
+func Refundable(ledger []models.Payment) map[string]float32 {
+	left := make(map[string]float32)
+	for _, p := range ledger {
+		switch p.Kind {
+		case models.PaymentKindPayment:
+			left[p.IntentID] += p.Amount
+		case models.PaymentKindRefund:
+			left[p.IntentID] -= p.Amount
+		}
+	}
+	for id, amount := range left {
+		left[id] = round(amount)
+	}
+	return left
+}
+
+func round(f float32) float32 {
+	return float32(math.Round(float64(f)*100) / 100)
+}
@@ -0,0 +1,126 @@
+package payments
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+)
+
+var depositTests = []struct {
+	name     string
+	total    float32
+	percent  int
+	expected float32
+}{
+	{"thirty percent", 200, 30, 60},
+	{"cents", 333.33, 30, 100},
+	{"no deposit", 200, 0, 0},
+	{"full", 200, 100, 200},
+}
+
+func TestDeposit(t *testing.T) {
+	for _, e := range depositTests {
+		if d := Deposit(e.total, e.percent); d != e.expected {
+			t.Errorf("for %s expected %.2f but got %.2f", e.name, e.expected, d)
+		}
+	}
+}
+
+func TestBalance(t *testing.T) {
+	ledger := []models.Payment{
+		{Kind: models.PaymentKindPayment, Amount: 60, IntentID: "pi_1"},
+		{Kind: models.PaymentKindPayment, Amount: 140, IntentID: "pi_2"},
+		{Kind: models.PaymentKindRefund, Amount: 20.5, IntentID: "pi_2"},
+	}
+	paid, outstanding := Balance(200, ledger)
+	if paid != 179.5 || outstanding != 20.5 {
+		t.Errorf("expected paid 179.50 and outstanding 20.50 but got %.2f and %.2f", paid, outstanding)
+	}
+
+	paid, outstanding = Balance(100, ledger[:2])
+	if paid != 200 || outstanding != 0 {
+		t.Errorf("expected overpaid balance 200.00 and 0.00 but got %.2f and %.2f", paid, outstanding)
+	}
+
+	left := Refundable(ledger)
+	if left["pi_1"] != 60 || left["pi_2"] != 119.5 {
+		t.Errorf("wrong refundable amounts %v", left)
+	}
+}
+
+func TestFake(t *testing.T) {
+	f := NewFake([]byte("secret"))
+
+	_, err := f.CreateIntent(0, "1")
+	if err == nil {
+		t.Error("intent of zero amount was created")
+	}
+
+	in, err := f.CreateIntent(60, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in.Status != IntentRequiresPayment || in.Reference != "1" {
+		t.Errorf("wrong new intent %+v", in)
+	}
+
+	_, err = f.Refund(in.ID, 10)
+	if err == nil {
+		t.Error("refunded a payment not captured")
+	}
+	_, err = f.Capture(in.ID, FakeCardDeclined)
+	if !errors.Is(err, ErrDeclined) {
+		t.Errorf("expected declined payment but got %v", err)
+	}
+	_, err = f.Capture("fake_pi_x", FakeCardOK)
+	if !errors.Is(err, ErrUnknownIntent) {
+		t.Errorf("expected unknown intent but got %v", err)
+	}
+	in, err = f.Capture(in.ID, FakeCardOK)
+	if err != nil || in.Status != IntentSucceeded {
+		t.Errorf("expected captured intent but got %+v, %v", in, err)
+	}
+
+	_, err = f.Refund(in.ID, 50)
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = f.Refund(in.ID, 10.01)
+	if err == nil {
+		t.Error("refunded more than was paid")
+	}
+	_, err = f.Refund(in.ID, 10)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFakeWebhook(t *testing.T) {
+	f := NewFake([]byte("secret"))
+	payload := []byte(`{"type":"payment.succeeded","intent_id":"fake_pi_1","reference":"3","amount":60}`)
+
+	header := http.Header{}
+	header.Set(FakeSignatureHeader, f.Sign(payload))
+	e, err := f.VerifyWebhook(payload, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != EventPaymentSucceeded || e.IntentID != "fake_pi_1" || e.Reference != "3" || e.Amount != 60 {
+		t.Errorf("wrong event %+v", e)
+	}
+
+	header.Set(FakeSignatureHeader, NewFake([]byte("other")).Sign(payload))
+	_, err = f.VerifyWebhook(payload, header)
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected invalid signature but got %v", err)
+	}
+
+	unsigned := NewFake(nil)
+	header.Set(FakeSignatureHeader, unsigned.Sign(payload))
+	_, err = unsigned.VerifyWebhook(payload, header)
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected provider without secret to refuse webhook but got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+//Package pricing calculates the cost of a stay from room pricing
+package pricing
+
+import (
+	"math"
+	"time"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+)
+
+//NightlyRate returns the price of the night starting on day d
+func NightlyRate(p models.Pricing, d time.Time) float32 {
+	rate := p.Price
+	day := dateOnly(d)
+	for _, s := range p.Seasons {
+		if !day.Before(dateOnly(s.StartDate)) && !day.After(dateOnly(s.EndDate)) {
+			rate = s.Price
+			break
+		}
+	}
+
+	// friday and saturday nights are weekend nights
+	if wd := day.Weekday(); wd == time.Friday || wd == time.Saturday {
+		rate += rate * p.WeekendUplift / 100
+	}
+	return round(rate)
+}
+
+//Total returns the price of a stay from start to end, departure day is not charged
+func Total(p models.Pricing, start, end time.Time) float32 {
+	var total float32
+	for d := dateOnly(start); d.Before(dateOnly(end)); d = d.AddDate(0, 0, 1) {
+		total += NightlyRate(p, d)
+	}
+	return round(total)
+}
+
+//Nights returns number of nights between start and end
+func Nights(start, end time.Time) int {
+	n := 0
+	for d := dateOnly(start); d.Before(dateOnly(end)); d = d.AddDate(0, 0, 1) {
+		n++
+	}
+	return n
+}
+
+func dateOnly(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func round(f float32) float32 {
+	return float32(math.Round(float64(f)*100) / 100)
+}
@@ -0,0 +1,50 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+)
+
+var testPricing = models.Pricing{
+	Price:         100,
+	WeekendUplift: 20,
+	Seasons: []models.SeasonalPrice{
+		{
+			StartDate: time.Date(2050, 12, 20, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2051, 1, 6, 0, 0, 0, 0, time.UTC),
+			Price:     200,
+		},
+	},
+}
+
+var totalTests = []struct {
+	name     string
+	start    time.Time
+	end      time.Time
+	expected float32
+}{
+	// 2050-11-07 is a monday
+	{"weekdays", time.Date(2050, 11, 7, 0, 0, 0, 0, time.UTC), time.Date(2050, 11, 10, 0, 0, 0, 0, time.UTC), 300},
+	{"weekend", time.Date(2050, 11, 10, 0, 0, 0, 0, time.UTC), time.Date(2050, 11, 13, 0, 0, 0, 0, time.UTC), 340},
+	{"season", time.Date(2050, 12, 19, 0, 0, 0, 0, time.UTC), time.Date(2050, 12, 21, 0, 0, 0, 0, time.UTC), 300},
+	{"season weekend", time.Date(2050, 12, 23, 0, 0, 0, 0, time.UTC), time.Date(2050, 12, 24, 0, 0, 0, 0, time.UTC), 240},
+	{"same day", time.Date(2050, 11, 7, 0, 0, 0, 0, time.UTC), time.Date(2050, 11, 7, 0, 0, 0, 0, time.UTC), 0},
+}
+
+func TestTotal(t *testing.T) {
+	for _, e := range totalTests {
+		total := Total(testPricing, e.start, e.end)
+		if total != e.expected {
+			t.Errorf("for %s expected %.2f but got %.2f", e.name, e.expected, total)
+		}
+	}
+}
+
+func TestNights(t *testing.T) {
+	n := Nights(time.Date(2050, 11, 7, 0, 0, 0, 0, time.UTC), time.Date(2050, 11, 10, 0, 0, 0, 0, time.UTC))
+	if n != 3 {
+		t.Errorf("expected 3 nights but got %d", n)
+	}
+}
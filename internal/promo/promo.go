@@ -0,0 +1,74 @@
+//Package promo checks promo codes and calculates their discounts
+package promo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+)
+
+var (
+	//ErrNotValid is returned when booking outside the dates the code is valid
+	ErrNotValid = errors.New("promo code is not valid at this time")
+	//ErrTooShort is returned for stays shorter than the code requires
+	ErrTooShort = errors.New("stay is too short for this promo code")
+	//ErrRoom is returned for rooms the code is not valid for
+	ErrRoom = errors.New("promo code is not valid for this room")
+	//ErrUsedUp is returned when the code has been used as many times as allowed
+	ErrUsedUp = errors.New("promo code has been used up")
+)
+
+//Normalize returns code the way codes are stored, without spaces and in upper case
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+//Check returns why promo code p cannot be used for booking room for nights nights on day now, nil when it can.
+//The code is valid when booking on the days from ValidFrom to ValidTo
+func Check(p models.PromoCode, roomID, nights int, now time.Time) error {
+	today := now.Format("2006-01-02")
+	if today < p.ValidFrom.Format("2006-01-02") || today > p.ValidTo.Format("2006-01-02") {
+		return ErrNotValid
+	}
+	if nights < p.MinNights {
+		return fmt.Errorf("%w, it needs at least %d nights", ErrTooShort, p.MinNights)
+	}
+	if len(p.RoomIDs) > 0 {
+		found := false
+		for _, id := range p.RoomIDs {
+			if id == roomID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ErrRoom
+		}
+	}
+	if p.UsageLimit > 0 && p.TimesUsed >= p.UsageLimit {
+		return ErrUsedUp
+	}
+	return nil
+}
+
+//Discount returns the discount of p off total rounded to cents, never more than total
+func Discount(p models.PromoCode, total float32) float32 {
+	var d float32
+	switch p.Kind {
+	case models.PromoPercent:
+		d = total * p.Value / 100
+	case models.PromoFixed:
+		d = p.Value
+	}
+	if d > total {
+		d = total
+	}
+	if d < 0 {
+		d = 0
+	}
+	return float32(math.Round(float64(d)*100) / 100)
+}
@@ -0,0 +1,87 @@
+package promo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+)
+
+var code = models.PromoCode{
+	Code:       "WINTER",
+	Kind:       models.PromoPercent,
+	Value:      15,
+	ValidFrom:  time.Date(2050, 11, 1, 0, 0, 0, 0, time.UTC),
+	ValidTo:    time.Date(2050, 11, 30, 0, 0, 0, 0, time.UTC),
+	MinNights:  2,
+	UsageLimit: 10,
+	TimesUsed:  9,
+	RoomIDs:    []int{1, 3},
+}
+
+var checkTests = []struct {
+	name     string
+	roomID   int
+	nights   int
+	now      time.Time
+	used     int
+	expected error
+}{
+	{"valid", 1, 2, time.Date(2050, 11, 15, 12, 0, 0, 0, time.UTC), 9, nil},
+	{"first day", 3, 2, time.Date(2050, 11, 1, 0, 0, 0, 0, time.UTC), 9, nil},
+	{"last day", 3, 2, time.Date(2050, 11, 30, 23, 0, 0, 0, time.UTC), 9, nil},
+	{"too early", 1, 2, time.Date(2050, 10, 31, 23, 0, 0, 0, time.UTC), 9, ErrNotValid},
+	{"too late", 1, 2, time.Date(2050, 12, 1, 0, 0, 0, 0, time.UTC), 9, ErrNotValid},
+	{"too short", 1, 1, time.Date(2050, 11, 15, 0, 0, 0, 0, time.UTC), 9, ErrTooShort},
+	{"other room", 2, 2, time.Date(2050, 11, 15, 0, 0, 0, 0, time.UTC), 9, ErrRoom},
+	{"used up", 1, 2, time.Date(2050, 11, 15, 0, 0, 0, 0, time.UTC), 10, ErrUsedUp},
+}
+
+func TestCheck(t *testing.T) {
+	for _, e := range checkTests {
+		p := code
+		p.TimesUsed = e.used
+		err := Check(p, e.roomID, e.nights, e.now)
+		if !errors.Is(err, e.expected) {
+			t.Errorf("for %s expected %v but got %v", e.name, e.expected, err)
+		}
+	}
+
+	p := code
+	p.RoomIDs = nil
+	p.UsageLimit = 0
+	p.TimesUsed = 500
+	if err := Check(p, 2, 2, time.Date(2050, 11, 15, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Errorf("code for all rooms without limit failed: %v", err)
+	}
+}
+
+var discountTests = []struct {
+	name     string
+	kind     string
+	value    float32
+	total    float32
+	expected float32
+}{
+	{"percent", models.PromoPercent, 15, 200, 30},
+	{"percent cents", models.PromoPercent, 15, 333.33, 50},
+	{"fixed", models.PromoFixed, 25, 200, 25},
+	{"fixed over total", models.PromoFixed, 250, 200, 200},
+	{"unknown kind", "gift", 25, 200, 0},
+}
+
+func TestDiscount(t *testing.T) {
+	for _, e := range discountTests {
+		p := models.PromoCode{Kind: e.kind, Value: e.value}
+		if d := Discount(p, e.total); d != e.expected {
+			t.Errorf("for %s expected %.2f but got %.2f", e.name, e.expected, d)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if c := Normalize("  winter50 "); c != "WINTER50" {
+		t.Errorf("expected WINTER50 but got %s", c)
+	}
+}
@@ -11,14 +11,22 @@ import (
 
 	"github.com/justinas/nosurf"
 	"github.com/t-Ikonen/bbbookingsystem/internal/config"
+	"github.com/t-Ikonen/bbbookingsystem/internal/extras"
+	"github.com/t-Ikonen/bbbookingsystem/internal/housekeeping"
+	"github.com/t-Ikonen/bbbookingsystem/internal/lifecycle"
 	"github.com/t-Ikonen/bbbookingsystem/internal/models"
 )
 
 var functions = template.FuncMap{
-	"shortDate":  ShortDate,
-	"formatDate": FormatDate,
-	"iterate":    Iterate,
-	"add":        Add,
+	"shortDate":         ShortDate,
+	"formatDate":        FormatDate,
+	"iterate":           Iterate,
+	"add":               Add,
+	"price":             Price,
+	"statusLabel":       lifecycle.Label,
+	"unitLabel":         extras.Label,
+	"housekeepingLabel": housekeeping.Label,
+	"nextRoomStatuses":  housekeeping.Next,
 }
 
 var appConfig *config.AppConfig
@@ -45,6 +53,11 @@ func Add(a, b int) int {
 	return a + b
 }
 
+//Price formats a price in euros
+func Price(p float32) string {
+	return fmt.Sprintf("%.2f €", p)
+}
+
 //NewRender sets the package for the template package
 func NewRenderer(a *config.AppConfig) {
 	appConfig = a
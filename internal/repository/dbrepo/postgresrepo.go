@@ -2,13 +2,20 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
+	"github.com/jackc/pgconn"
 	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// pgExclusionViolation is the postgres error code raised by room_restrictions_no_overlap
+const pgExclusionViolation = "23P01"
+
 func (m *postgresDBRepo) AllUsers() bool {
 	return true
 }
@@ -20,9 +27,10 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	stmt := `INSERT INTO 
-				reservations (first_name, last_name, email, phone, start_date, end_date, room_id, created_at, updated_at)
+				reservations (first_name, last_name, email, phone, start_date, end_date, room_id, total_price,
+					adults, children, created_at, updated_at)
 			VALUES
-				 ($1,$2,$3,$4,$5,$6,$7,$8,$9) 
+				 ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12) 
 			RETURNING id`
 
 	err := m.DB.QueryRowContext(ctx, stmt,
@@ -33,6 +41,9 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 		res.StartDate,
 		res.EndDate,
 		res.RoomId,
+		res.TotalPrice,
+		res.Adults,
+		res.Children,
 		time.Now(),
 		time.Now(),
 	).Scan(&newId)
@@ -67,6 +78,264 @@ func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
 	return nil
 }
 
+//lockRoomForBooking locks the room row so concurrent bookings of the same room are serialized,
+//removes expired holds and returns ErrRoomNotAvailable if the dates overlap a blocking restriction other than ignoreID
+func lockRoomForBooking(ctx context.Context, tx *sql.Tx, roomID int, start, end time.Time, ignoreID int) error {
+	_, err := tx.ExecContext(ctx, "SELECT id FROM rooms WHERE id = $1 FOR UPDATE", roomID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM
+			room_restrictions
+		WHERE
+			room_id = $1 AND restriction_id = 7 AND expires_at <= $2`,
+		roomID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var numRows int
+	stmt := `
+		SELECT
+			COUNT(id)
+		FROM
+			room_restrictions
+		WHERE
+			$1 < end_date AND
+			$2 > start_date AND
+			room_id = $3 AND
+			id <> $4 AND
+			restriction_id IN (1, 2, 7)`
+
+	err = tx.QueryRowContext(ctx, stmt, start, end, roomID, ignoreID).Scan(&numRows)
+	if err != nil {
+		return err
+	}
+	if numRows > 0 {
+		return repository.ErrRoomNotAvailable
+	}
+	return nil
+}
+
+//notAvailableOnOverlap turns an exclusion constraint violation into ErrRoomNotAvailable
+func notAvailableOnOverlap(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgExclusionViolation {
+		return repository.ErrRoomNotAvailable
+	}
+	return err
+}
+
+//InsertReservationWithRestriction re-checks availability and inserts reservation and its room restriction in one transaction,
+//a hold with holdID is converted into the reservation restriction
+func (m *postgresDBRepo) InsertReservationWithRestriction(res models.Reservation, holdID int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = lockRoomForBooking(ctx, tx, res.RoomId, res.StartDate, res.EndDate, holdID)
+	if err != nil {
+		return 0, err
+	}
+
+	// the promo code is counted in the same transaction so that its usage limit holds for simultaneous bookings
+	if res.PromoCodeID != 0 {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE
+				promo_codes
+			SET
+				times_used = times_used + 1, updated_at = $1
+			WHERE
+				id = $2 AND (usage_limit = 0 OR times_used < usage_limit)`,
+			time.Now(),
+			res.PromoCodeID,
+		)
+		if err != nil {
+			return 0, err
+		}
+		counted, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if counted == 0 {
+			return 0, repository.ErrPromoUsedUp
+		}
+	}
+
+	var newId int
+	stmt := `INSERT INTO 
+				reservations (first_name, last_name, email, phone, start_date, end_date, room_id, total_price,
+					adults, children, promo_code_id, discount_amount, payment_due_at, created_at, updated_at)
+			VALUES
+				 ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,nullif($11, 0),$12,$13,$14,$15) 
+			RETURNING id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		res.FirstName,
+		res.LastName,
+		res.Email,
+		res.Phone,
+		res.StartDate,
+		res.EndDate,
+		res.RoomId,
+		res.TotalPrice,
+		res.Adults,
+		res.Children,
+		res.PromoCodeID,
+		res.DiscountAmount,
+		sql.NullTime{Time: res.PaymentDueAt, Valid: !res.PaymentDueAt.IsZero()},
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	// convert the hold if it is still there, otherwise insert a new restriction
+	var converted int64
+	if holdID > 0 {
+		stmt = `
+			UPDATE
+				room_restrictions
+			SET
+				restriction_id = 1, reservation_id = $1, start_date = $2, end_date = $3, expires_at = NULL, updated_at = $4
+			WHERE
+				id = $5 AND restriction_id = 7 AND room_id = $6`
+
+		result, err := tx.ExecContext(ctx, stmt, newId, res.StartDate, res.EndDate, time.Now(), holdID, res.RoomId)
+		if err != nil {
+			return 0, notAvailableOnOverlap(err)
+		}
+		converted, err = result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if converted == 0 {
+		stmt = `INSERT INTO 
+					room_restrictions (start_date, end_date, room_id, reservation_id,  restriction_id, created_at, updated_at)
+				VALUES ($1,$2,$3,$4,$5,$6,$7)`
+
+		_, err = tx.ExecContext(ctx, stmt,
+			res.StartDate,
+			res.EndDate,
+			res.RoomId,
+			newId,
+			1,
+			time.Now(),
+			time.Now(),
+		)
+		if err != nil {
+			return 0, notAvailableOnOverlap(err)
+		}
+	}
+
+	err = insertReservationExtras(ctx, tx, newId, res.Extras)
+	if err != nil {
+		return 0, err
+	}
+
+	// the voucher is charged in the same transaction so that its balance cannot be spent twice
+	if res.VoucherID != 0 && res.VoucherAmount > 0 {
+		err = redeemVoucher(ctx, tx, res.VoucherID, newId, res.VoucherAmount)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return newId, nil
+}
+
+//InsertHold holds a room for a guest in checkout until expiresAt, returns the hold ID
+func (m *postgresDBRepo) InsertHold(roomID int, start, end, expiresAt time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = lockRoomForBooking(ctx, tx, roomID, start, end, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	var newId int
+	stmt := `
+		INSERT INTO
+			room_restrictions (start_date, end_date, room_id, restriction_id, expires_at, created_at, updated_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		start,
+		end,
+		roomID,
+		7,
+		expiresAt,
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, notAvailableOnOverlap(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return newId, nil
+}
+
+//DeleteHold releases a hold by room restriction ID
+func (m *postgresDBRepo) DeleteHold(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM
+			room_restrictions
+		WHERE
+			id = $1 AND restriction_id = 7
+	`
+	_, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//DeleteExpiredHolds releases all expired holds, returns number of released holds
+func (m *postgresDBRepo) DeleteExpiredHolds() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM
+			room_restrictions
+		WHERE
+			restriction_id = 7 AND expires_at <= $1
+	`
+	result, err := m.DB.ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 //SearchAvailabilityByDatesByRoomId return false if given room has no availability, return true if availability
 func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomId(start, end time.Time, roomID int) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -79,7 +348,9 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomId(start, end time.Time,
 		WHERE
 			$1 < end_date AND
 			$2 > start_date AND
-			room_id = $3`
+			room_id = $3 AND
+			restriction_id IN (1, 2, 7) AND
+			(restriction_id <> 7 OR expires_at > now())`
 
 	var numRows int
 
@@ -94,25 +365,26 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomId(start, end time.Time,
 	return false, nil
 }
 
-//SearchAvailabilityForAllRooms returns a slice of available rooms if any for given date range
-func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+//SearchAvailabilityForAllRooms returns a slice of available rooms if any for given date range and number of guests
+func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time, guests int) ([]models.Room, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	var rooms []models.Room
 
 	query := `
 		SELECT
-			r.id, r.room_name 
+			r.id, r.room_name, r.max_occupancy
 		FROM
 			rooms r 
-		WHERE r.id NOT IN
+		WHERE r.active = true AND r.max_occupancy >= $3 AND r.id NOT IN
 			(SELECT 
 				rr.room_id
 			FROM
 				room_restrictions as rr
-			WHERE $1 < rr.end_date AND $2 > rr.start_date)`
+			WHERE $1 < rr.end_date AND $2 > rr.start_date AND rr.restriction_id IN (1, 2, 7)
+				AND (rr.restriction_id <> 7 OR rr.expires_at > now()))`
 
-	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	rows, err := m.DB.QueryContext(ctx, query, start, end, guests)
 	if err != nil {
 		return rooms, err
 	}
@@ -123,6 +395,7 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 		err := rows.Scan(
 			&room.ID,
 			&room.RoomName,
+			&room.MaxOccupancy,
 		)
 		if err != nil {
 			return rooms, err
@@ -137,6 +410,61 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 	return rooms, nil
 }
 
+//SearchAlternativeDates returns free windows of the searched length shifted at most days from the searched dates,
+//nearest first for each room
+func (m *postgresDBRepo) SearchAlternativeDates(start, end time.Time, guests, days int) ([]models.AlternativeStay, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var stays []models.AlternativeStay
+
+	query := `
+		SELECT
+			r.id, r.room_name, $1::date + s.shift, $2::date + s.shift, s.shift
+		FROM
+			rooms r
+		CROSS JOIN
+			generate_series(-$4::int, $4::int) AS s(shift)
+		WHERE r.active = true AND r.max_occupancy >= $3 AND s.shift <> 0
+			AND $1::date + s.shift >= current_date
+			AND NOT EXISTS
+			(SELECT
+				1
+			FROM
+				room_restrictions rr
+			WHERE rr.room_id = r.id AND rr.restriction_id IN (1, 2, 7)
+				AND (rr.restriction_id <> 7 OR rr.expires_at > now())
+				AND rr.start_date < $2::date + s.shift AND rr.end_date > $1::date + s.shift)
+		ORDER BY
+			r.id, abs(s.shift), s.shift`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end, guests, days)
+	if err != nil {
+		return stays, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var stay models.AlternativeStay
+		err := rows.Scan(
+			&stay.RoomID,
+			&stay.RoomName,
+			&stay.StartDate,
+			&stay.EndDate,
+			&stay.Shift,
+		)
+		if err != nil {
+			return stays, err
+		}
+		stays = append(stays, stay)
+	}
+
+	if err = rows.Err(); err != nil {
+		return stays, err
+	}
+
+	return stays, nil
+}
+
 // GetRoomNameById gets room by ID
 func (m *postgresDBRepo) GetRoomNameById(id int) (models.Room, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -146,7 +474,8 @@ func (m *postgresDBRepo) GetRoomNameById(id int) (models.Room, error) {
 
 	query := `
 		SELECT
-			r.id, r.room_name, r.shower, r.minibar, r.pricing_id
+			r.id, r.room_name, r.shower, r.minibar, r.pricing_id, r.description, r.active, r.max_occupancy, r.ical_token,
+			coalesce(r.cancellation_policy_id, 0)
 		FROM
 			rooms AS r
 		WHERE 
@@ -159,6 +488,37 @@ func (m *postgresDBRepo) GetRoomNameById(id int) (models.Room, error) {
 		&room.Shower,
 		&room.Minibar,
 		&room.PricingId,
+		&room.Description,
+		&room.Active,
+		&room.MaxOccupancy,
+		&room.ICalToken,
+		&room.CancellationPolicyID,
+	)
+	if err != nil {
+		return room, err
+	}
+	return room, nil
+}
+
+//GetRoomByICalToken returns the room of a calendar feed token
+func (m *postgresDBRepo) GetRoomByICalToken(token string) (models.Room, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var room models.Room
+
+	query := `
+		SELECT
+			r.id, r.room_name, r.ical_token
+		FROM
+			rooms AS r
+		WHERE
+			r.ical_token = $1`
+
+	err := m.DB.QueryRowContext(ctx, query, token).Scan(
+		&room.ID,
+		&room.RoomName,
+		&room.ICalToken,
 	)
 	if err != nil {
 		return room, err
@@ -166,6 +526,26 @@ func (m *postgresDBRepo) GetRoomNameById(id int) (models.Room, error) {
 	return room, nil
 }
 
+//UpdateRoomICalToken gives a room a new calendar feed token, the old feed URL stops working
+func (m *postgresDBRepo) UpdateRoomICalToken(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE
+			rooms
+		SET
+			ical_token = replace(gen_random_uuid()::text, '-', ''), updated_at = $1
+		WHERE
+			id = $2`
+
+	_, err := m.DB.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 //GetUsedById returns a user
 func (m *postgresDBRepo) GetUsedById(id int) (models.User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -243,8 +623,8 @@ func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string,
 	return id, hashedPassword, nil
 }
 
-//AllReservations gets a slice  of  all the reservations for admin use
-func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
+//AllReservations gets a slice of reservations in status for admin use, all reservations when status is empty
+func (m *postgresDBRepo) AllReservations(status string) ([]models.Reservation, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -252,18 +632,21 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 
 	query := ` 
 		SELECT 
-			r.id, r.first_name, r.last_name, r.phone, r.email, r.start_date, r.end_date, r.room_id,
-			r.created_at, r.updated_at, r.processed,  rm.id, rm.room_name
+			r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id,
+			r.created_at, r.updated_at, r.status, coalesce(r.cancelled_at, '0001-01-01'), r.refund_amount,
+			rm.id, rm.room_name
 		FROM
 			reservations as r
 		LEFT JOIN
 			rooms as rm 
 		ON 
 			(r.room_id = rm.id) 
+		WHERE
+			$1 = '' OR r.status = $1
 		ORDER BY
 			r.start_date
 	`
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.DB.QueryContext(ctx, query, status)
 	if err != nil {
 		return reservation, err
 	}
@@ -281,7 +664,9 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 			&i.RoomId,
 			&i.CreatedAt,
 			&i.ModifiedAt,
-			&i.Processed,
+			&i.Status,
+			&i.CancelledAt,
+			&i.RefundAmount,
 			&i.Room.ID,
 			&i.Room.RoomName,
 		)
@@ -296,31 +681,47 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 	return reservation, nil
 }
 
-//AllNewReservations gets a slice  of  all the unprocessed reservations for admin use
-func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
+//ArrivalsOn returns reservations arriving on given day, cancelled and no-show ones left out
+func (m *postgresDBRepo) ArrivalsOn(day time.Time) ([]models.Reservation, error) {
+	return m.frontDeskReservations("r.start_date = $1 AND r.status NOT IN ('cancelled', 'no-show')", day)
+}
+
+//DeparturesOn returns reservations departing on given day, cancelled and no-show ones left out
+func (m *postgresDBRepo) DeparturesOn(day time.Time) ([]models.Reservation, error) {
+	return m.frontDeskReservations("r.end_date = $1 AND r.status NOT IN ('cancelled', 'no-show')", day)
+}
+
+//InHouseReservations returns reservations whose guests are checked in
+func (m *postgresDBRepo) InHouseReservations() ([]models.Reservation, error) {
+	return m.frontDeskReservations("r.status = 'checked-in'")
+}
+
+//frontDeskReservations returns reservations with their rooms matching where condition, ordered by room
+func (m *postgresDBRepo) frontDeskReservations(where string, args ...interface{}) ([]models.Reservation, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var reservation []models.Reservation
+	var reservations []models.Reservation
 
-	query := ` 
-		SELECT 
-			r.id, r.first_name, r.last_name, r.phone, r.email, r.start_date, r.end_date, r.room_id,
-			r.created_at, r.updated_at, rm.id, rm.room_name
+	query := `
+		SELECT
+			r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id,
+			r.status, coalesce(r.checked_in_at, '0001-01-01'), coalesce(r.checked_out_at, '0001-01-01'),
+			rm.id, rm.room_name
 		FROM
 			reservations as r
 		LEFT JOIN
-			rooms as rm 
-		ON 
-			(r.room_id = rm.id) 
+			rooms as rm
+		ON
+			(r.room_id = rm.id)
 		WHERE
-			r.processed=0
+			` + where + `
 		ORDER BY
-			r.start_date
+			rm.room_name, r.start_date
 	`
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return reservation, err
+		return reservations, err
 	}
 	defer rows.Close()
 	for rows.Next() {
@@ -334,37 +735,46 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 			&i.StartDate,
 			&i.EndDate,
 			&i.RoomId,
-			&i.CreatedAt,
-			&i.ModifiedAt,
+			&i.Status,
+			&i.CheckedInAt,
+			&i.CheckedOutAt,
 			&i.Room.ID,
 			&i.Room.RoomName,
 		)
 		if err != nil {
-			return reservation, err
+			return reservations, err
 		}
-		reservation = append(reservation, i)
+		reservations = append(reservations, i)
 	}
 	if err = rows.Err(); err != nil {
-		return reservation, err
+		return reservations, err
 	}
-	return reservation, nil
+	return reservations, nil
 }
 
-//GetReservationById get one unprocessed reservation by reservation ID
+//GetReservationById get one reservation by reservation ID
 func (m *postgresDBRepo) GetReservationById(id int) (models.Reservation, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	var res models.Reservation
 	query := `
 		SELECT 
-			r.id, r.first_name, r.last_name, r.phone, r.email, r.start_date, r.end_date, r.room_id,
-			r.created_at, r.updated_at, r.processed, rm.id, rm.room_name
+			r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id,
+			r.created_at, r.updated_at, r.status, r.total_price, r.adults, r.children,
+			coalesce(r.confirmed_at, '0001-01-01'), coalesce(r.checked_in_at, '0001-01-01'),
+			coalesce(r.checked_out_at, '0001-01-01'), coalesce(r.no_show_at, '0001-01-01'),
+			coalesce(r.cancelled_at, '0001-01-01'), r.refund_amount,
+			coalesce(r.promo_code_id, 0), coalesce(pc.code, ''), r.discount_amount, rm.id, rm.room_name
 		FROM
 			reservations as r
 		LEFT JOIN
 			rooms as rm 
 		ON 
 			(r.room_id = rm.id) 
+		LEFT JOIN
+			promo_codes as pc
+		ON
+			(r.promo_code_id = pc.id)
 		WHERE
 			r.id = $1
 
@@ -382,13 +792,64 @@ func (m *postgresDBRepo) GetReservationById(id int) (models.Reservation, error)
 		&res.RoomId,
 		&res.CreatedAt,
 		&res.ModifiedAt,
-		&res.Processed,
+		&res.Status,
+		&res.TotalPrice,
+		&res.Adults,
+		&res.Children,
+		&res.ConfirmedAt,
+		&res.CheckedInAt,
+		&res.CheckedOutAt,
+		&res.NoShowAt,
+		&res.CancelledAt,
+		&res.RefundAmount,
+		&res.PromoCodeID,
+		&res.PromoCode,
+		&res.DiscountAmount,
 		&res.Room.ID,
 		&res.Room.RoomName,
 	)
 	if err != nil {
 		return res, err
 	}
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT
+			id, reservation_id, coalesce(extra_id, 0), name, unit, quantity, unit_price, total, vat_rate,
+			created_at, updated_at
+		FROM
+			reservation_extras
+		WHERE
+			reservation_id = $1
+		ORDER BY
+			id`, res.ID)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var x models.ReservationExtra
+		err := rows.Scan(
+			&x.ID,
+			&x.ReservationID,
+			&x.ExtraID,
+			&x.Name,
+			&x.Unit,
+			&x.Quantity,
+			&x.UnitPrice,
+			&x.Total,
+			&x.VATRate,
+			&x.CreatedAt,
+			&x.ModifiedAt,
+		)
+		if err != nil {
+			return res, err
+		}
+		res.Extras = append(res.Extras, x)
+	}
+	if err = rows.Err(); err != nil {
+		return res, err
+	}
 	return res, nil
 }
 
@@ -439,23 +900,45 @@ func (m *postgresDBRepo) DeleteReservation(id int) error {
 	return nil
 }
 
-//updates one reservation by ID to be processed
-func (m *postgresDBRepo) UpdatePrcessed(id, processed int) error {
+//statusTimes maps a reservation status to the column holding the time of getting to it
+var statusTimes = map[string]string{
+	models.StatusConfirmed:  "confirmed_at",
+	models.StatusCheckedIn:  "checked_in_at",
+	models.StatusCheckedOut: "checked_out_at",
+	models.StatusNoShow:     "no_show_at",
+	models.StatusCancelled:  "cancelled_at",
+}
+
+//UpdateReservationStatus changes status of a reservation from status from to status to and records the time.
+//Returns repository.ErrStatusChanged if the reservation is no longer in status from
+func (m *postgresDBRepo) UpdateReservationStatus(id int, from, to string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `
-		UPDATE 
+	column, ok := statusTimes[to]
+	if !ok {
+		return fmt.Errorf("unknown reservation status %s", to)
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE
 			reservations
 		SET
-			processed= $1
+			status = $1, %s = $2, updated_at = $2
 		WHERE
-			id=$2
-	`
-	_, err := m.DB.ExecContext(ctx, query, processed, id)
+			id = $3 AND status = $4
+	`, column)
+	result, err := m.DB.ExecContext(ctx, query, to, time.Now(), id, from)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if updated == 0 {
+		return repository.ErrStatusChanged
+	}
 	return nil
 }
 
@@ -467,7 +950,9 @@ func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
 	var rooms []models.Room
 
 	query := `
-		SELECT * FROM
+		SELECT
+			id, room_name, shower, minibar, pricing_id, description, active, max_occupancy, created_at, updated_at
+		FROM
 			rooms
 		ORDER BY
 			room_name
@@ -488,6 +973,9 @@ func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
 			&rm.Shower,
 			&rm.Minibar,
 			&rm.PricingId,
+			&rm.Description,
+			&rm.Active,
+			&rm.MaxOccupancy,
 			&rm.CreatedAt,
 			&rm.ModifiedAt,
 		)
@@ -509,7 +997,7 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end tim
 
 	query := `
 		SELECT 
-			id, coalesce (reservation_id, 0), restriction_id, room_id, start_date, end_date
+			id, coalesce (reservation_id, 0), restriction_id, room_id, start_date, end_date, coalesce (import_id, 0)
 		FROM
 			room_restrictions
 		WHERE
@@ -518,6 +1006,10 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end tim
 			$2 >= start_date
 		AND
 			room_id = $3
+		AND
+			restriction_id IN (1, 2, 7)
+		AND
+			(restriction_id <> 7 OR expires_at > now())
 	`
 	rows, err := m.DB.QueryContext(ctx, query, start, end, roomID)
 	if err != nil {
@@ -534,6 +1026,7 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end tim
 			&r.RoomId,
 			&r.StartDate,
 			&r.EndDate,
+			&r.ImportID,
 		)
 		if err != nil {
 			return nil, err
@@ -546,3 +1039,2711 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end tim
 	}
 	return restrictions, nil
 }
+
+//InsertBlockForRoom inserts an owner block for one day of a room
+func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO
+			room_restrictions (start_date, end_date, room_id, restriction_id, created_at, updated_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6)
+	`
+	_, err := m.DB.ExecContext(ctx, query,
+		startDate,
+		startDate.AddDate(0, 0, 1),
+		id,
+		2,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//DeleteBlockByID deletes an owner block by room restriction ID
+func (m *postgresDBRepo) DeleteBlockByID(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM
+			room_restrictions
+		WHERE
+			id = $1 AND restriction_id = 2
+	`
+	_, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//GetPricingForRoom returns pricing of a room with its seasonal prices
+func (m *postgresDBRepo) GetPricingForRoom(roomID int) (models.Pricing, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var p models.Pricing
+
+	query := `
+		SELECT
+			p.id, p.room_name, p.price, p.weekend_uplift, p.created_at, p.updated_at
+		FROM
+			pricing AS p
+		JOIN
+			rooms AS r
+		ON
+			(r.pricing_id = p.id)
+		WHERE
+			r.id = $1
+	`
+	row := m.DB.QueryRowContext(ctx, query, roomID)
+	err := row.Scan(
+		&p.ID,
+		&p.RoomName,
+		&p.Price,
+		&p.WeekendUplift,
+		&p.CreatedAt,
+		&p.ModifiedAt,
+	)
+	if err != nil {
+		return p, err
+	}
+
+	query = `
+		SELECT
+			id, pricing_id, start_date, end_date, price, created_at, updated_at
+		FROM
+			seasonal_pricing
+		WHERE
+			pricing_id = $1
+		ORDER BY
+			start_date
+	`
+	rows, err := m.DB.QueryContext(ctx, query, p.ID)
+	if err != nil {
+		return p, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.SeasonalPrice
+		err := rows.Scan(
+			&s.ID,
+			&s.PricingId,
+			&s.StartDate,
+			&s.EndDate,
+			&s.Price,
+			&s.CreatedAt,
+			&s.ModifiedAt,
+		)
+		if err != nil {
+			return p, err
+		}
+		p.Seasons = append(p.Seasons, s)
+	}
+	if err = rows.Err(); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+//AllPricing returns all pricing rows for choosing room pricing
+func (m *postgresDBRepo) AllPricing() ([]models.Pricing, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var prices []models.Pricing
+
+	query := `
+		SELECT
+			id, room_name, price, weekend_uplift, coalesce(cancellation_policy_id, 0), created_at, updated_at
+		FROM
+			pricing
+		ORDER BY
+			room_name
+	`
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return prices, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.Pricing
+		err := rows.Scan(
+			&p.ID,
+			&p.RoomName,
+			&p.Price,
+			&p.WeekendUplift,
+			&p.CancellationPolicyID,
+			&p.CreatedAt,
+			&p.ModifiedAt,
+		)
+		if err != nil {
+			return prices, err
+		}
+		prices = append(prices, p)
+	}
+	if err = rows.Err(); err != nil {
+		return prices, err
+	}
+	return prices, nil
+}
+
+//InsertRoom inserts a new room, returns its ID
+func (m *postgresDBRepo) InsertRoom(rm models.Room) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newId int
+	stmt := `
+		INSERT INTO
+			rooms (room_name, shower, minibar, pricing_id, description, active, max_occupancy,
+			cancellation_policy_id, created_at, updated_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7, nullif($8, 0), $9, $10)
+		RETURNING id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		rm.RoomName,
+		rm.Shower,
+		rm.Minibar,
+		rm.PricingId,
+		rm.Description,
+		rm.Active,
+		rm.MaxOccupancy,
+		rm.CancellationPolicyID,
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+	return newId, nil
+}
+
+//UpdateRoom updates room data
+func (m *postgresDBRepo) UpdateRoom(rm models.Room) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE
+			rooms
+		SET
+			room_name = $1, shower = $2, minibar = $3, pricing_id = $4, description = $5, active = $6,
+			max_occupancy = $7, cancellation_policy_id = nullif($8, 0), updated_at = $9
+		WHERE
+			id = $10
+	`
+	_, err := m.DB.ExecContext(ctx, query,
+		rm.RoomName,
+		rm.Shower,
+		rm.Minibar,
+		rm.PricingId,
+		rm.Description,
+		rm.Active,
+		rm.MaxOccupancy,
+		rm.CancellationPolicyID,
+		time.Now(),
+		rm.ID,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//UpdateRoomActive activates or deactivates a room, inactive rooms are not bookable
+func (m *postgresDBRepo) UpdateRoomActive(id int, active bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE
+			rooms
+		SET
+			active = $1, updated_at = $2
+		WHERE
+			id = $3
+	`
+	_, err := m.DB.ExecContext(ctx, query, active, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//DeleteRoom deletes a room without reservations, returns ErrRoomHasReservations if it has any
+func (m *postgresDBRepo) DeleteRoom(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// reservations, their payments and invoices would cascade with the room
+	query := `
+		DELETE FROM
+			rooms
+		WHERE
+			id = $1 AND NOT EXISTS (SELECT 1 FROM reservations WHERE room_id = $1)
+	`
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		var hasReservations bool
+		err = m.DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM reservations WHERE room_id = $1)", id).Scan(&hasReservations)
+		if err != nil {
+			return err
+		}
+		if hasReservations {
+			return repository.ErrRoomHasReservations
+		}
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+//GetRulesForRoomByDate returns stay rules of a room overlapping the date range, rule dates are inclusive
+func (m *postgresDBRepo) GetRulesForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rules []models.RoomRestriction
+
+	query := `
+		SELECT
+			rr.id, rr.restriction_id, rr.room_id, rr.start_date, rr.end_date, rr.rule_value, r.restriction_name
+		FROM
+			room_restrictions AS rr
+		LEFT JOIN
+			restrictions AS r
+		ON
+			(rr.restriction_id = r.id)
+		WHERE
+			rr.start_date <= $2
+		AND
+			rr.end_date >= $1
+		AND
+			rr.room_id = $3
+		AND
+			rr.restriction_id IN (3, 4, 5, 6)
+	`
+	rows, err := m.DB.QueryContext(ctx, query, start, end, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rr models.RoomRestriction
+		err := rows.Scan(
+			&rr.ID,
+			&rr.RestrictionId,
+			&rr.RoomId,
+			&rr.StartDate,
+			&rr.EndDate,
+			&rr.RuleValue,
+			&rr.Restriction.RestrictionName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rr)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+//AllRoomRules returns all stay rules with room names for admin use
+func (m *postgresDBRepo) AllRoomRules() ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rules []models.RoomRestriction
+
+	query := `
+		SELECT
+			rr.id, rr.restriction_id, rr.room_id, rr.start_date, rr.end_date, rr.rule_value,
+			r.restriction_name, rm.room_name
+		FROM
+			room_restrictions AS rr
+		LEFT JOIN
+			restrictions AS r
+		ON
+			(rr.restriction_id = r.id)
+		LEFT JOIN
+			rooms AS rm
+		ON
+			(rr.room_id = rm.id)
+		WHERE
+			rr.restriction_id IN (3, 4, 5, 6)
+		ORDER BY
+			rr.start_date
+	`
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rr models.RoomRestriction
+		err := rows.Scan(
+			&rr.ID,
+			&rr.RestrictionId,
+			&rr.RoomId,
+			&rr.StartDate,
+			&rr.EndDate,
+			&rr.RuleValue,
+			&rr.Restriction.RestrictionName,
+			&rr.Room.RoomName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rr)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+//InsertRoomRule inserts a stay rule for a room and date range
+func (m *postgresDBRepo) InsertRoomRule(rr models.RoomRestriction) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO
+			room_restrictions (start_date, end_date, room_id, restriction_id, rule_value, created_at, updated_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := m.DB.ExecContext(ctx, stmt,
+		rr.StartDate,
+		rr.EndDate,
+		rr.RoomId,
+		rr.RestrictionId,
+		rr.RuleValue,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//DeleteRoomRule deletes a stay rule by room restriction ID
+func (m *postgresDBRepo) DeleteRoomRule(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM
+			room_restrictions
+		WHERE
+			id = $1 AND restriction_id IN (3, 4, 5, 6)
+	`
+	_, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//InsertWaitlistEntry puts a guest on the waitlist, returns entry ID
+func (m *postgresDBRepo) InsertWaitlistEntry(e models.WaitlistEntry) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newId int
+	stmt := `
+		INSERT INTO
+			waitlist (first_name, last_name, email, phone, start_date, end_date, adults, children, created_at, updated_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		e.FirstName,
+		e.LastName,
+		e.Email,
+		e.Phone,
+		e.StartDate,
+		e.EndDate,
+		e.Adults,
+		e.Children,
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+	return newId, nil
+}
+
+//PendingWaitlistEntries returns waitlist entries not yet notified whose stay has not started
+func (m *postgresDBRepo) PendingWaitlistEntries() ([]models.WaitlistEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var entries []models.WaitlistEntry
+
+	query := `
+		SELECT
+			id, first_name, last_name, email, phone, start_date, end_date, adults, children, created_at, updated_at
+		FROM
+			waitlist
+		WHERE
+			notified_at IS NULL AND start_date >= current_date
+		ORDER BY
+			created_at
+	`
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.WaitlistEntry
+		err := rows.Scan(
+			&e.ID,
+			&e.FirstName,
+			&e.LastName,
+			&e.Email,
+			&e.Phone,
+			&e.StartDate,
+			&e.EndDate,
+			&e.Adults,
+			&e.Children,
+			&e.CreatedAt,
+			&e.ModifiedAt,
+		)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+	if err = rows.Err(); err != nil {
+		return entries, err
+	}
+	return entries, nil
+}
+
+//UpdateWaitlistNotified marks a waitlist entry as notified
+func (m *postgresDBRepo) UpdateWaitlistNotified(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE
+			waitlist
+		SET
+			notified_at = $1, updated_at = $1
+		WHERE
+			id = $2
+	`
+	_, err := m.DB.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//InsertAPIToken stores a new API token, returns token ID
+func (m *postgresDBRepo) InsertAPIToken(t models.APIToken) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newID int
+	query := `
+		INSERT INTO
+			api_tokens (user_id, name, token_hash, created_at, updated_at)
+		VALUES
+			($1, $2, $3, $4, $5)
+		RETURNING id
+	`
+	err := m.DB.QueryRowContext(ctx, query,
+		t.UserID,
+		t.Name,
+		t.TokenHash,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+//AllAPITokensForUser returns API tokens of a user
+func (m *postgresDBRepo) AllAPITokensForUser(userID int) ([]models.APIToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var tokens []models.APIToken
+	query := `
+		SELECT
+			id, user_id, name, coalesce(last_used_at, '0001-01-01'), created_at, updated_at
+		FROM
+			api_tokens
+		WHERE
+			user_id = $1
+		ORDER BY
+			created_at
+	`
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return tokens, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.APIToken
+		err := rows.Scan(
+			&t.ID,
+			&t.UserID,
+			&t.Name,
+			&t.LastUsedAt,
+			&t.CreatedAt,
+			&t.ModifiedAt,
+		)
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, t)
+	}
+	if err = rows.Err(); err != nil {
+		return tokens, err
+	}
+	return tokens, nil
+}
+
+//DeleteAPIToken deletes API token of a user
+func (m *postgresDBRepo) DeleteAPIToken(id, userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM
+			api_tokens
+		WHERE
+			id = $1 AND user_id = $2
+	`
+	_, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//GetUserIDByAPIToken returns user ID for a token hash and marks the token used
+func (m *postgresDBRepo) GetUserIDByAPIToken(tokenHash string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var userID int
+	query := `
+		UPDATE
+			api_tokens
+		SET
+			last_used_at = $1
+		WHERE
+			token_hash = $2
+		RETURNING user_id
+	`
+	err := m.DB.QueryRowContext(ctx, query, time.Now(), tokenHash).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+//AllICalImports returns all external calendars mirrored to rooms
+func (m *postgresDBRepo) AllICalImports() ([]models.ICalImport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var imports []models.ICalImport
+	query := `
+		SELECT
+			i.id, i.room_id, i.name, i.url, i.data, coalesce(i.last_synced_at, '0001-01-01'), i.last_error,
+			i.created_at, i.updated_at, r.room_name
+		FROM
+			ical_imports i
+		LEFT JOIN rooms r ON (r.id = i.room_id)
+		ORDER BY
+			i.room_id, i.name
+	`
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return imports, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.ICalImport
+		err := rows.Scan(
+			&i.ID,
+			&i.RoomID,
+			&i.Name,
+			&i.URL,
+			&i.Data,
+			&i.LastSyncedAt,
+			&i.LastError,
+			&i.CreatedAt,
+			&i.ModifiedAt,
+			&i.Room.RoomName,
+		)
+		if err != nil {
+			return imports, err
+		}
+		i.Room.ID = i.RoomID
+		imports = append(imports, i)
+	}
+	if err = rows.Err(); err != nil {
+		return imports, err
+	}
+	return imports, nil
+}
+
+//GetICalImportByID returns one external calendar
+func (m *postgresDBRepo) GetICalImportByID(id int) (models.ICalImport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var i models.ICalImport
+	query := `
+		SELECT
+			id, room_id, name, url, data, coalesce(last_synced_at, '0001-01-01'), last_error, created_at, updated_at
+		FROM
+			ical_imports
+		WHERE
+			id = $1
+	`
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&i.ID,
+		&i.RoomID,
+		&i.Name,
+		&i.URL,
+		&i.Data,
+		&i.LastSyncedAt,
+		&i.LastError,
+		&i.CreatedAt,
+		&i.ModifiedAt,
+	)
+	if err != nil {
+		return i, err
+	}
+	return i, nil
+}
+
+//InsertICalImport adds an external calendar to a room, returns its ID
+func (m *postgresDBRepo) InsertICalImport(imp models.ICalImport) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newID int
+	query := `
+		INSERT INTO
+			ical_imports (room_id, name, url, data, created_at, updated_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+	err := m.DB.QueryRowContext(ctx, query,
+		imp.RoomID,
+		imp.Name,
+		imp.URL,
+		imp.Data,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+//DeleteICalImport removes an external calendar, its blocks are removed with it
+func (m *postgresDBRepo) DeleteICalImport(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM
+			ical_imports
+		WHERE
+			id = $1
+	`
+	_, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//UpdateICalImportStatus records the time and error, empty if none, of the latest sync
+func (m *postgresDBRepo) UpdateICalImportStatus(id int, syncError string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE
+			ical_imports
+		SET
+			last_synced_at = $1, last_error = $2, updated_at = $1
+		WHERE
+			id = $3
+	`
+	_, err := m.DB.ExecContext(ctx, query, time.Now(), syncError, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//SyncImportedBlocks mirrors blocks of an external calendar as owner blocks of a room in one transaction.
+//Blocks are matched by ExternalUID so unchanged events keep their ID, blocks of removed events are deleted.
+//Blocks overlapping other bookings are skipped, returns the number of skipped blocks
+func (m *postgresDBRepo) SyncImportedBlocks(importID, roomID int, blocks []models.RoomRestriction) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT
+			id, external_uid, start_date, end_date
+		FROM
+			room_restrictions
+		WHERE
+			import_id = $1`, importID)
+	if err != nil {
+		return 0, err
+	}
+	existing := make(map[string]models.RoomRestriction)
+	for rows.Next() {
+		var rr models.RoomRestriction
+		err := rows.Scan(&rr.ID, &rr.ExternalUID, &rr.StartDate, &rr.EndDate)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		existing[rr.ExternalUID] = rr
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	wanted := make(map[string]bool)
+	for _, b := range blocks {
+		wanted[b.ExternalUID] = true
+	}
+	for uid, rr := range existing {
+		if wanted[uid] {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM room_restrictions WHERE id = $1", rr.ID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	skipped := 0
+	seen := make(map[string]bool)
+	for _, b := range blocks {
+		if seen[b.ExternalUID] {
+			continue
+		}
+		seen[b.ExternalUID] = true
+
+		if old, ok := existing[b.ExternalUID]; ok {
+			if old.StartDate.Equal(b.StartDate) && old.EndDate.Equal(b.EndDate) {
+				continue
+			}
+			// a moved event keeps its old dates if the new ones are taken
+			_, err := tx.ExecContext(ctx, "SAVEPOINT move_block")
+			if err != nil {
+				return 0, err
+			}
+			_, err = tx.ExecContext(ctx, `
+				UPDATE
+					room_restrictions
+				SET
+					start_date = $1, end_date = $2, updated_at = $3
+				WHERE
+					id = $4`,
+				b.StartDate, b.EndDate, time.Now(), old.ID)
+			if errors.Is(notAvailableOnOverlap(err), repository.ErrRoomNotAvailable) {
+				_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT move_block")
+				if err != nil {
+					return 0, err
+				}
+				skipped++
+				continue
+			}
+			if err != nil {
+				return 0, err
+			}
+			_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT move_block")
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO
+				room_restrictions (start_date, end_date, room_id, restriction_id, import_id, external_uid, created_at, updated_at)
+			VALUES
+				($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT DO NOTHING`,
+			b.StartDate,
+			b.EndDate,
+			roomID,
+			models.RestrictionOwnerBlock,
+			importID,
+			b.ExternalUID,
+			time.Now(),
+			time.Now(),
+		)
+		if err != nil {
+			return 0, err
+		}
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if inserted == 0 {
+			skipped++
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return skipped, nil
+}
+
+//AllCancellationPolicies returns all cancellation policies with their tiers
+func (m *postgresDBRepo) AllCancellationPolicies() ([]models.CancellationPolicy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var policies []models.CancellationPolicy
+
+	query := `
+		SELECT
+			p.id, p.name, p.created_at, p.updated_at,
+			coalesce(t.id, 0), coalesce(t.days_before, 0), coalesce(t.refund_percent, 0)
+		FROM
+			cancellation_policies AS p
+		LEFT JOIN
+			cancellation_policy_tiers AS t
+		ON
+			(t.policy_id = p.id)
+		ORDER BY
+			p.name, p.id, t.days_before DESC
+	`
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return policies, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.CancellationPolicy
+		var t models.CancellationTier
+		err := rows.Scan(
+			&p.ID,
+			&p.Name,
+			&p.CreatedAt,
+			&p.ModifiedAt,
+			&t.ID,
+			&t.DaysBefore,
+			&t.RefundPercent,
+		)
+		if err != nil {
+			return policies, err
+		}
+		if len(policies) == 0 || policies[len(policies)-1].ID != p.ID {
+			policies = append(policies, p)
+		}
+		if t.ID != 0 {
+			t.PolicyID = p.ID
+			last := &policies[len(policies)-1]
+			last.Tiers = append(last.Tiers, t)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return policies, err
+	}
+	return policies, nil
+}
+
+//GetCancellationPolicyForRoom returns cancellation policy of a room, or of its rate plan if the room has none.
+//Returns an empty policy when neither has a policy
+func (m *postgresDBRepo) GetCancellationPolicyForRoom(roomID int) (models.CancellationPolicy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var p models.CancellationPolicy
+
+	query := `
+		SELECT
+			coalesce(r.cancellation_policy_id, pr.cancellation_policy_id, 0)
+		FROM
+			rooms AS r
+		LEFT JOIN
+			pricing AS pr
+		ON
+			(r.pricing_id = pr.id)
+		WHERE
+			r.id = $1
+	`
+	err := m.DB.QueryRowContext(ctx, query, roomID).Scan(&p.ID)
+	if err != nil || p.ID == 0 {
+		return p, err
+	}
+
+	err = m.DB.QueryRowContext(ctx, `
+		SELECT
+			name, created_at, updated_at
+		FROM
+			cancellation_policies
+		WHERE
+			id = $1`, p.ID).Scan(&p.Name, &p.CreatedAt, &p.ModifiedAt)
+	if err != nil {
+		return p, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT
+			id, days_before, refund_percent, created_at, updated_at
+		FROM
+			cancellation_policy_tiers
+		WHERE
+			policy_id = $1
+		ORDER BY
+			days_before DESC`, p.ID)
+	if err != nil {
+		return p, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t := models.CancellationTier{PolicyID: p.ID}
+		err := rows.Scan(&t.ID, &t.DaysBefore, &t.RefundPercent, &t.CreatedAt, &t.ModifiedAt)
+		if err != nil {
+			return p, err
+		}
+		p.Tiers = append(p.Tiers, t)
+	}
+	if err = rows.Err(); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+//InsertCancellationPolicy inserts a cancellation policy with its tiers, returns its ID
+func (m *postgresDBRepo) InsertCancellationPolicy(p models.CancellationPolicy) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var newID int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO
+			cancellation_policies (name, created_at, updated_at)
+		VALUES
+			($1, $2, $3)
+		RETURNING id`,
+		p.Name,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, t := range p.Tiers {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO
+				cancellation_policy_tiers (policy_id, days_before, refund_percent, created_at, updated_at)
+			VALUES
+				($1, $2, $3, $4, $5)`,
+			newID,
+			t.DaysBefore,
+			t.RefundPercent,
+			time.Now(),
+			time.Now(),
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+//DeleteCancellationPolicy deletes a cancellation policy, rooms and rate plans using it are left without policy
+func (m *postgresDBRepo) DeleteCancellationPolicy(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM
+			cancellation_policies
+		WHERE
+			id = $1
+	`
+	_, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//UpdatePricingCancellationPolicy sets cancellation policy of a rate plan, policyID 0 removes it
+func (m *postgresDBRepo) UpdatePricingCancellationPolicy(pricingID, policyID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE
+			pricing
+		SET
+			cancellation_policy_id = nullif($1, 0), updated_at = $2
+		WHERE
+			id = $3
+	`
+	_, err := m.DB.ExecContext(ctx, query, policyID, time.Now(), pricingID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//CancelReservation marks a reservation cancelled with the refunded amount and frees its dates in one transaction.
+//Returns repository.ErrAlreadyCancelled if the reservation was cancelled before
+func (m *postgresDBRepo) CancelReservation(id int, refund float32) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE
+			reservations
+		SET
+			status = $1, cancelled_at = $2, refund_amount = $3, updated_at = $2
+		WHERE
+			id = $4 AND status <> $1`,
+		models.StatusCancelled, time.Now(), refund, id)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return repository.ErrAlreadyCancelled
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM room_restrictions WHERE reservation_id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//MoveReservation changes dates, room and total price of a reservation and moves its room restriction in one transaction.
+//Returns ErrRoomNotAvailable if the new dates overlap other bookings of the room
+func (m *postgresDBRepo) MoveReservation(res models.Reservation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var restrictionID int
+	err = tx.QueryRowContext(ctx, `
+		SELECT
+			coalesce(max(id), 0)
+		FROM
+			room_restrictions
+		WHERE
+			reservation_id = $1 AND restriction_id = 1`, res.ID).Scan(&restrictionID)
+	if err != nil {
+		return err
+	}
+
+	err = lockRoomForBooking(ctx, tx, res.RoomId, res.StartDate, res.EndDate, restrictionID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE
+			reservations
+		SET
+			start_date = $1, end_date = $2, room_id = $3, total_price = $4, discount_amount = $5, updated_at = $6
+		WHERE
+			id = $7`,
+		res.StartDate,
+		res.EndDate,
+		res.RoomId,
+		res.TotalPrice,
+		res.DiscountAmount,
+		time.Now(),
+		res.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, x := range res.Extras {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE
+				reservation_extras
+			SET
+				quantity = $1, total = $2, updated_at = $3
+			WHERE
+				id = $4 AND reservation_id = $5`,
+			x.Quantity, x.Total, time.Now(), x.ID, res.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if restrictionID > 0 {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE
+				room_restrictions
+			SET
+				start_date = $1, end_date = $2, room_id = $3, updated_at = $4
+			WHERE
+				id = $5`,
+			res.StartDate, res.EndDate, res.RoomId, time.Now(), restrictionID)
+	} else {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO
+				room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at)
+			VALUES
+				($1, $2, $3, $4, $5, $6, $7)`,
+			res.StartDate, res.EndDate, res.RoomId, res.ID, models.RestrictionReservation, time.Now(), time.Now())
+	}
+	if err != nil {
+		return notAvailableOnOverlap(err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//InsertAuditEntry records an admin action
+func (m *postgresDBRepo) InsertAuditEntry(e models.AuditEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO
+			audit_log (user_id, action, entity, entity_id, before, after, created_at, updated_at)
+		VALUES
+			($1, $2, $3, $4, nullif($5, ''), nullif($6, ''), $7, $8)
+	`
+	_, err := m.DB.ExecContext(ctx, query,
+		e.UserID,
+		e.Action,
+		e.Entity,
+		e.EntityID,
+		e.Before,
+		e.After,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//AuditEntries returns audit entries matching the filter, newest first
+func (m *postgresDBRepo) AuditEntries(f models.AuditFilter) ([]models.AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var entries []models.AuditEntry
+
+	if f.Limit == 0 {
+		f.Limit = 200
+	}
+	query := `
+		SELECT
+			a.id, a.user_id, a.action, a.entity, a.entity_id, coalesce(a.before, ''), coalesce(a.after, ''),
+			a.created_at, a.updated_at, coalesce(u.first_name, ''), coalesce(u.last_name, ''), coalesce(u.email, '')
+		FROM
+			audit_log AS a
+		LEFT JOIN
+			users AS u
+		ON
+			(a.user_id = u.id)
+		WHERE
+			($1 = 0 OR a.user_id = $1) AND
+			($2 = '' OR a.action = $2) AND
+			($3 = '' OR a.entity = $3) AND
+			($4 = 0 OR a.entity_id = $4) AND
+			($5::timestamp = '0001-01-01' OR a.created_at >= $5::timestamp) AND
+			($6::timestamp = '0001-01-01' OR a.created_at < $6::timestamp)
+		ORDER BY
+			a.created_at DESC, a.id DESC
+		LIMIT $7
+	`
+	rows, err := m.DB.QueryContext(ctx, query, f.UserID, f.Action, f.Entity, f.EntityID, f.From, f.To, f.Limit)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.AuditEntry
+		err := rows.Scan(
+			&e.ID,
+			&e.UserID,
+			&e.Action,
+			&e.Entity,
+			&e.EntityID,
+			&e.Before,
+			&e.After,
+			&e.CreatedAt,
+			&e.ModifiedAt,
+			&e.User.FirstName,
+			&e.User.LastName,
+			&e.User.Email,
+		)
+		if err != nil {
+			return entries, err
+		}
+		e.User.ID = e.UserID
+		entries = append(entries, e)
+	}
+	if err = rows.Err(); err != nil {
+		return entries, err
+	}
+	return entries, nil
+}
+
+//InsertInvoice saves invoice with its lines and gives it the next invoice number.
+//Numbers run without gaps, the table is locked so that two invoices cannot get the same number
+func (m *postgresDBRepo) InsertInvoice(inv models.Invoice) (models.Invoice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return inv, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `LOCK TABLE invoices IN EXCLUSIVE MODE`)
+	if err != nil {
+		return inv, err
+	}
+
+	var number int
+	err = tx.QueryRowContext(ctx, `SELECT coalesce(max(invoice_number), 1000) + 1 FROM invoices`).Scan(&number)
+	if err != nil {
+		return inv, err
+	}
+
+	var newID int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO
+			invoices (invoice_number, reservation_id, issue_date, due_date, buyer_name, buyer_email,
+				seller_name, seller_business_id, seller_address, seller_email, seller_iban, total,
+				created_at, updated_at)
+		VALUES
+			($1, nullif($2, 0), $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING id`,
+		number,
+		inv.ReservationID,
+		inv.IssueDate,
+		inv.DueDate,
+		inv.BuyerName,
+		inv.BuyerEmail,
+		inv.Seller.Name,
+		inv.Seller.BusinessID,
+		inv.Seller.Address,
+		inv.Seller.Email,
+		inv.Seller.IBAN,
+		inv.Total,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return inv, err
+	}
+
+	for i, l := range inv.Lines {
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO
+				invoice_lines (invoice_id, description, quantity, unit_price, vat_rate, total, created_at, updated_at)
+			VALUES
+				($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id`,
+			newID,
+			l.Description,
+			l.Quantity,
+			l.UnitPrice,
+			l.VATRate,
+			l.Total,
+			time.Now(),
+			time.Now(),
+		).Scan(&inv.Lines[i].ID)
+		if err != nil {
+			return inv, err
+		}
+		inv.Lines[i].InvoiceID = newID
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return inv, err
+	}
+	inv.ID = newID
+	inv.Number = number
+	return inv, nil
+}
+
+//GetInvoiceById returns one invoice with its lines
+func (m *postgresDBRepo) GetInvoiceById(id int) (models.Invoice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var inv models.Invoice
+
+	query := `
+		SELECT
+			id, invoice_number, coalesce(reservation_id, 0), issue_date, due_date, buyer_name, buyer_email,
+			seller_name, seller_business_id, seller_address, seller_email, seller_iban, total,
+			created_at, updated_at
+		FROM
+			invoices
+		WHERE
+			id = $1
+	`
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&inv.ID,
+		&inv.Number,
+		&inv.ReservationID,
+		&inv.IssueDate,
+		&inv.DueDate,
+		&inv.BuyerName,
+		&inv.BuyerEmail,
+		&inv.Seller.Name,
+		&inv.Seller.BusinessID,
+		&inv.Seller.Address,
+		&inv.Seller.Email,
+		&inv.Seller.IBAN,
+		&inv.Total,
+		&inv.CreatedAt,
+		&inv.ModifiedAt,
+	)
+	if err != nil {
+		return inv, err
+	}
+
+	query = `
+		SELECT
+			id, invoice_id, description, quantity, unit_price, vat_rate, total, created_at, updated_at
+		FROM
+			invoice_lines
+		WHERE
+			invoice_id = $1
+		ORDER BY
+			id
+	`
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return inv, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l models.InvoiceLine
+		err := rows.Scan(
+			&l.ID,
+			&l.InvoiceID,
+			&l.Description,
+			&l.Quantity,
+			&l.UnitPrice,
+			&l.VATRate,
+			&l.Total,
+			&l.CreatedAt,
+			&l.ModifiedAt,
+		)
+		if err != nil {
+			return inv, err
+		}
+		inv.Lines = append(inv.Lines, l)
+	}
+	if err = rows.Err(); err != nil {
+		return inv, err
+	}
+	return inv, nil
+}
+
+//InvoicesForReservation returns invoices of a reservation without their lines, oldest first
+func (m *postgresDBRepo) InvoicesForReservation(reservationID int) ([]models.Invoice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var invoices []models.Invoice
+
+	query := `
+		SELECT
+			id, invoice_number, reservation_id, issue_date, due_date, buyer_name, buyer_email, total,
+			created_at, updated_at
+		FROM
+			invoices
+		WHERE
+			reservation_id = $1
+		ORDER BY
+			invoice_number
+	`
+	rows, err := m.DB.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return invoices, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var inv models.Invoice
+		err := rows.Scan(
+			&inv.ID,
+			&inv.Number,
+			&inv.ReservationID,
+			&inv.IssueDate,
+			&inv.DueDate,
+			&inv.BuyerName,
+			&inv.BuyerEmail,
+			&inv.Total,
+			&inv.CreatedAt,
+			&inv.ModifiedAt,
+		)
+		if err != nil {
+			return invoices, err
+		}
+		invoices = append(invoices, inv)
+	}
+	if err = rows.Err(); err != nil {
+		return invoices, err
+	}
+	return invoices, nil
+}
+
+//InsertPayment adds a payment or refund to the payments ledger. A provider reference already in the ledger
+//is not added again and 0 is returned as id, so repeated webhook calls are harmless
+func (m *postgresDBRepo) InsertPayment(p models.Payment) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newID int
+	stmt := `
+		INSERT INTO
+			payments (reservation_id, kind, amount, provider, provider_ref, intent_id, created_at, updated_at)
+		VALUES
+			(nullif($1, 0), $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (provider, provider_ref) DO NOTHING
+		RETURNING id
+	`
+	err := m.DB.QueryRowContext(ctx, stmt,
+		p.ReservationID,
+		p.Kind,
+		p.Amount,
+		p.Provider,
+		p.ProviderRef,
+		p.IntentID,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+//PaymentsForReservation returns the payments ledger of a reservation, oldest first
+func (m *postgresDBRepo) PaymentsForReservation(reservationID int) ([]models.Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var ledger []models.Payment
+
+	query := `
+		SELECT
+			id, reservation_id, kind, amount, provider, provider_ref, intent_id, created_at, updated_at
+		FROM
+			payments
+		WHERE
+			reservation_id = $1
+		ORDER BY
+			created_at, id
+	`
+	rows, err := m.DB.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return ledger, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.Payment
+		err := rows.Scan(
+			&p.ID,
+			&p.ReservationID,
+			&p.Kind,
+			&p.Amount,
+			&p.Provider,
+			&p.ProviderRef,
+			&p.IntentID,
+			&p.CreatedAt,
+			&p.ModifiedAt,
+		)
+		if err != nil {
+			return ledger, err
+		}
+		ledger = append(ledger, p)
+	}
+	if err = rows.Err(); err != nil {
+		return ledger, err
+	}
+	return ledger, nil
+}
+
+//AllPromoCodes returns all promo codes with their rooms and booking statistics, newest first
+func (m *postgresDBRepo) AllPromoCodes() ([]models.PromoCode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var codes []models.PromoCode
+
+	query := `
+		SELECT
+			p.id, p.code, p.kind, p.value, p.valid_from, p.valid_to, p.min_nights, p.usage_limit, p.times_used,
+			p.created_at, p.updated_at, coalesce(pr.room_id, 0),
+			(SELECT count(*) FROM reservations r WHERE r.promo_code_id = p.id AND r.status <> 'cancelled'),
+			(SELECT coalesce(sum(r.discount_amount), 0) FROM reservations r WHERE r.promo_code_id = p.id AND r.status <> 'cancelled')
+		FROM
+			promo_codes AS p
+		LEFT JOIN
+			promo_code_rooms AS pr
+		ON
+			(pr.promo_code_id = p.id)
+		ORDER BY
+			p.created_at DESC, p.id, pr.room_id
+	`
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return codes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.PromoCode
+		var roomID int
+		err := rows.Scan(
+			&p.ID,
+			&p.Code,
+			&p.Kind,
+			&p.Value,
+			&p.ValidFrom,
+			&p.ValidTo,
+			&p.MinNights,
+			&p.UsageLimit,
+			&p.TimesUsed,
+			&p.CreatedAt,
+			&p.ModifiedAt,
+			&roomID,
+			&p.Bookings,
+			&p.TotalDiscount,
+		)
+		if err != nil {
+			return codes, err
+		}
+		if len(codes) == 0 || codes[len(codes)-1].ID != p.ID {
+			codes = append(codes, p)
+		}
+		if roomID != 0 {
+			last := &codes[len(codes)-1]
+			last.RoomIDs = append(last.RoomIDs, roomID)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return codes, err
+	}
+	return codes, nil
+}
+
+//GetPromoCodeByCode returns a promo code with its rooms by the code guests enter
+func (m *postgresDBRepo) GetPromoCodeByCode(code string) (models.PromoCode, error) {
+	return m.getPromoCode("p.code = $1", code)
+}
+
+//GetPromoCodeById returns a promo code with its rooms by ID
+func (m *postgresDBRepo) GetPromoCodeById(id int) (models.PromoCode, error) {
+	return m.getPromoCode("p.id = $1", id)
+}
+
+//getPromoCode returns the promo code matching where condition with its rooms
+func (m *postgresDBRepo) getPromoCode(where string, arg interface{}) (models.PromoCode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var p models.PromoCode
+
+	query := `
+		SELECT
+			p.id, p.code, p.kind, p.value, p.valid_from, p.valid_to, p.min_nights, p.usage_limit, p.times_used,
+			p.created_at, p.updated_at
+		FROM
+			promo_codes AS p
+		WHERE
+			` + where
+	err := m.DB.QueryRowContext(ctx, query, arg).Scan(
+		&p.ID,
+		&p.Code,
+		&p.Kind,
+		&p.Value,
+		&p.ValidFrom,
+		&p.ValidTo,
+		&p.MinNights,
+		&p.UsageLimit,
+		&p.TimesUsed,
+		&p.CreatedAt,
+		&p.ModifiedAt,
+	)
+	if err != nil {
+		return p, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT room_id FROM promo_code_rooms WHERE promo_code_id = $1 ORDER BY room_id`, p.ID)
+	if err != nil {
+		return p, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var roomID int
+		err := rows.Scan(&roomID)
+		if err != nil {
+			return p, err
+		}
+		p.RoomIDs = append(p.RoomIDs, roomID)
+	}
+	if err = rows.Err(); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+//InsertPromoCode saves a new promo code with its rooms
+func (m *postgresDBRepo) InsertPromoCode(p models.PromoCode) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var newID int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO
+			promo_codes (code, kind, value, valid_from, valid_to, min_nights, usage_limit, created_at, updated_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id`,
+		p.Code,
+		p.Kind,
+		p.Value,
+		p.ValidFrom,
+		p.ValidTo,
+		p.MinNights,
+		p.UsageLimit,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, roomID := range p.RoomIDs {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO
+				promo_code_rooms (promo_code_id, room_id, created_at, updated_at)
+			VALUES
+				($1, $2, $3, $4)`,
+			newID,
+			roomID,
+			time.Now(),
+			time.Now(),
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+//DeletePromoCode deletes a promo code, reservations made with it keep their discount
+func (m *postgresDBRepo) DeletePromoCode(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM promo_codes WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//AllVouchers returns all gift vouchers, newest first
+func (m *postgresDBRepo) AllVouchers() ([]models.Voucher, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var vouchers []models.Voucher
+
+	query := `
+		SELECT
+			id, code, amount, balance, expires_at, buyer_name, buyer_email, recipient_name, message, payment_ref,
+			created_at, updated_at
+		FROM
+			vouchers
+		ORDER BY
+			created_at DESC, id DESC
+	`
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return vouchers, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v models.Voucher
+		err := rows.Scan(
+			&v.ID,
+			&v.Code,
+			&v.Amount,
+			&v.Balance,
+			&v.ExpiresAt,
+			&v.BuyerName,
+			&v.BuyerEmail,
+			&v.RecipientName,
+			&v.Message,
+			&v.PaymentRef,
+			&v.CreatedAt,
+			&v.ModifiedAt,
+		)
+		if err != nil {
+			return vouchers, err
+		}
+		vouchers = append(vouchers, v)
+	}
+	if err = rows.Err(); err != nil {
+		return vouchers, err
+	}
+	return vouchers, nil
+}
+
+//GetVoucherByCode returns a gift voucher with its redemptions by the code guests enter
+func (m *postgresDBRepo) GetVoucherByCode(code string) (models.Voucher, error) {
+	return m.getVoucher("code = $1", code)
+}
+
+//GetVoucherById returns a gift voucher with its redemptions by ID
+func (m *postgresDBRepo) GetVoucherById(id int) (models.Voucher, error) {
+	return m.getVoucher("id = $1", id)
+}
+
+//getVoucher returns the voucher matching where condition with its redemptions
+func (m *postgresDBRepo) getVoucher(where string, arg interface{}) (models.Voucher, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var v models.Voucher
+
+	query := `
+		SELECT
+			id, code, amount, balance, expires_at, buyer_name, buyer_email, recipient_name, message, payment_ref,
+			created_at, updated_at
+		FROM
+			vouchers
+		WHERE
+			` + where
+	err := m.DB.QueryRowContext(ctx, query, arg).Scan(
+		&v.ID,
+		&v.Code,
+		&v.Amount,
+		&v.Balance,
+		&v.ExpiresAt,
+		&v.BuyerName,
+		&v.BuyerEmail,
+		&v.RecipientName,
+		&v.Message,
+		&v.PaymentRef,
+		&v.CreatedAt,
+		&v.ModifiedAt,
+	)
+	if err != nil {
+		return v, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT
+			id, voucher_id, coalesce(reservation_id, 0), amount, created_at, updated_at
+		FROM
+			voucher_redemptions
+		WHERE
+			voucher_id = $1
+		ORDER BY
+			created_at, id`, v.ID)
+	if err != nil {
+		return v, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var x models.VoucherRedemption
+		err := rows.Scan(
+			&x.ID,
+			&x.VoucherID,
+			&x.ReservationID,
+			&x.Amount,
+			&x.CreatedAt,
+			&x.ModifiedAt,
+		)
+		if err != nil {
+			return v, err
+		}
+		v.Redemptions = append(v.Redemptions, x)
+	}
+	if err = rows.Err(); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+//InsertVoucher saves a new gift voucher with its whole amount as balance
+func (m *postgresDBRepo) InsertVoucher(v models.Voucher) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newID int
+	err := m.DB.QueryRowContext(ctx, `
+		INSERT INTO
+			vouchers (code, amount, balance, expires_at, buyer_name, buyer_email, recipient_name, message, payment_ref,
+				created_at, updated_at)
+		VALUES
+			($1, round($2::numeric, 2), round($2::numeric, 2), $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id`,
+		v.Code,
+		v.Amount,
+		v.ExpiresAt,
+		v.BuyerName,
+		v.BuyerEmail,
+		v.RecipientName,
+		v.Message,
+		v.PaymentRef,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+//redeemVoucher spends amount of voucher id on reservation resID in transaction tx and records it in the payments ledger.
+//Returns repository.ErrVoucherSpent when the voucher has expired or its balance is not enough
+func redeemVoucher(ctx context.Context, tx *sql.Tx, id, resID int, amount float32) error {
+	// amounts are rounded to cents in the database, float32 cents are not exact
+	var code string
+	err := tx.QueryRowContext(ctx, `
+		UPDATE
+			vouchers
+		SET
+			balance = balance - round($1::numeric, 2), updated_at = $2
+		WHERE
+			id = $3 AND balance >= round($1::numeric, 2) AND expires_at >= current_date
+		RETURNING code`,
+		amount,
+		time.Now(),
+		id,
+	).Scan(&code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.ErrVoucherSpent
+	}
+	if err != nil {
+		return err
+	}
+
+	var redemptionID int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO
+			voucher_redemptions (voucher_id, reservation_id, amount, created_at, updated_at)
+		VALUES
+			($1, $2, round($3::numeric, 2), $4, $5)
+		RETURNING id`,
+		id,
+		resID,
+		amount,
+		time.Now(),
+		time.Now(),
+	).Scan(&redemptionID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO
+			payments (reservation_id, kind, amount, provider, provider_ref, intent_id, created_at, updated_at)
+		VALUES
+			($1, $2, round($3::numeric, 2), $4, $5, $6, $7, $8)`,
+		resID,
+		models.PaymentKindPayment,
+		amount,
+		models.PaymentProviderVoucher,
+		fmt.Sprintf("redemption-%d", redemptionID),
+		code,
+		time.Now(),
+		time.Now(),
+	)
+	return err
+}
+
+//RefundToVoucher returns amount of voucher payment p back to the balance of the voucher and records the refund
+//in the payments ledger. The refund is a redemption with negative amount
+func (m *postgresDBRepo) RefundToVoucher(p models.Payment, amount float32) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var voucherID int
+	err = tx.QueryRowContext(ctx, `
+		UPDATE
+			vouchers
+		SET
+			balance = balance + round($1::numeric, 2), updated_at = $2
+		WHERE
+			code = $3
+		RETURNING id`,
+		amount,
+		time.Now(),
+		p.IntentID,
+	).Scan(&voucherID)
+	if err != nil {
+		return err
+	}
+
+	var redemptionID int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO
+			voucher_redemptions (voucher_id, reservation_id, amount, created_at, updated_at)
+		VALUES
+			($1, nullif($2, 0), -round($3::numeric, 2), $4, $5)
+		RETURNING id`,
+		voucherID,
+		p.ReservationID,
+		amount,
+		time.Now(),
+		time.Now(),
+	).Scan(&redemptionID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO
+			payments (reservation_id, kind, amount, provider, provider_ref, intent_id, created_at, updated_at)
+		VALUES
+			(nullif($1, 0), $2, round($3::numeric, 2), $4, $5, $6, $7, $8)`,
+		p.ReservationID,
+		models.PaymentKindRefund,
+		amount,
+		models.PaymentProviderVoucher,
+		fmt.Sprintf("redemption-%d", redemptionID),
+		p.IntentID,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//insertReservationExtras saves extras booked with reservation resID in transaction tx
+func insertReservationExtras(ctx context.Context, tx *sql.Tx, resID int, extras []models.ReservationExtra) error {
+	for _, x := range extras {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO
+				reservation_extras (reservation_id, extra_id, name, unit, quantity, unit_price, total, vat_rate,
+					created_at, updated_at)
+			VALUES
+				($1, nullif($2, 0), $3, $4, $5, $6, $7, $8, $9, $10)`,
+			resID,
+			x.ExtraID,
+			x.Name,
+			x.Unit,
+			x.Quantity,
+			x.UnitPrice,
+			x.Total,
+			x.VATRate,
+			time.Now(),
+			time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//AllExtras returns the extras catalogue with the rooms of each extra
+func (m *postgresDBRepo) AllExtras() ([]models.Extra, error) {
+	return m.extras(`
+		SELECT
+			e.id, e.name, e.description, e.price, e.unit, e.vat_rate, e.created_at, e.updated_at, coalesce(er.room_id, 0)
+		FROM
+			extras AS e
+		LEFT JOIN
+			extra_rooms AS er
+		ON
+			(er.extra_id = e.id)
+		ORDER BY
+			e.name, e.id, er.room_id`)
+}
+
+//ExtrasForRoom returns the extras guests can book with room roomID
+func (m *postgresDBRepo) ExtrasForRoom(roomID int) ([]models.Extra, error) {
+	return m.extras(`
+		SELECT
+			e.id, e.name, e.description, e.price, e.unit, e.vat_rate, e.created_at, e.updated_at, 0
+		FROM
+			extras AS e
+		WHERE
+			NOT EXISTS (SELECT 1 FROM extra_rooms er WHERE er.extra_id = e.id)
+			OR EXISTS (SELECT 1 FROM extra_rooms er WHERE er.extra_id = e.id AND er.room_id = $1)
+		ORDER BY
+			e.name, e.id`, roomID)
+}
+
+//extras returns the extras of query, each row has the extra and one of its rooms or 0
+func (m *postgresDBRepo) extras(query string, args ...interface{}) ([]models.Extra, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var extras []models.Extra
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return extras, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.Extra
+		var roomID int
+		err := rows.Scan(
+			&e.ID,
+			&e.Name,
+			&e.Description,
+			&e.Price,
+			&e.Unit,
+			&e.VATRate,
+			&e.CreatedAt,
+			&e.ModifiedAt,
+			&roomID,
+		)
+		if err != nil {
+			return extras, err
+		}
+		if len(extras) == 0 || extras[len(extras)-1].ID != e.ID {
+			extras = append(extras, e)
+		}
+		if roomID != 0 {
+			last := &extras[len(extras)-1]
+			last.RoomIDs = append(last.RoomIDs, roomID)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return extras, err
+	}
+	return extras, nil
+}
+
+//GetExtraById returns an extra with its rooms by ID
+func (m *postgresDBRepo) GetExtraById(id int) (models.Extra, error) {
+	extras, err := m.extras(`
+		SELECT
+			e.id, e.name, e.description, e.price, e.unit, e.vat_rate, e.created_at, e.updated_at, coalesce(er.room_id, 0)
+		FROM
+			extras AS e
+		LEFT JOIN
+			extra_rooms AS er
+		ON
+			(er.extra_id = e.id)
+		WHERE
+			e.id = $1
+		ORDER BY
+			er.room_id`, id)
+	if err != nil {
+		return models.Extra{}, err
+	}
+	if len(extras) == 0 {
+		return models.Extra{}, sql.ErrNoRows
+	}
+	return extras[0], nil
+}
+
+//InsertExtra saves a new extra with its rooms
+func (m *postgresDBRepo) InsertExtra(e models.Extra) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var newID int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO
+			extras (name, description, price, unit, vat_rate, created_at, updated_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`,
+		e.Name,
+		e.Description,
+		e.Price,
+		e.Unit,
+		e.VATRate,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertExtraRooms(ctx, tx, newID, e.RoomIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+//UpdateExtra updates an extra and replaces its rooms, extras already booked keep their price
+func (m *postgresDBRepo) UpdateExtra(e models.Extra) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE
+			extras
+		SET
+			name = $1, description = $2, price = $3, unit = $4, vat_rate = $5, updated_at = $6
+		WHERE
+			id = $7`,
+		e.Name,
+		e.Description,
+		e.Price,
+		e.Unit,
+		e.VATRate,
+		time.Now(),
+		e.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM extra_rooms WHERE extra_id = $1`, e.ID)
+	if err != nil {
+		return err
+	}
+	err = insertExtraRooms(ctx, tx, e.ID, e.RoomIDs)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//insertExtraRooms saves the rooms extra id is available for in transaction tx
+func insertExtraRooms(ctx context.Context, tx *sql.Tx, id int, roomIDs []int) error {
+	for _, roomID := range roomIDs {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO
+				extra_rooms (extra_id, room_id, created_at, updated_at)
+			VALUES
+				($1, $2, $3, $4)`,
+			id,
+			roomID,
+			time.Now(),
+			time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//DeleteExtra deletes an extra from the catalogue, reservations keep the extras booked
+func (m *postgresDBRepo) DeleteExtra(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM extras WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//StaysOn returns reservations with their rooms whose dates in room_restrictions include day, from arrival to departure.
+//Cancelled and no-show ones are left out. Stays imported from other channels come without reservation ID and guest details
+func (m *postgresDBRepo) StaysOn(day time.Time) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var stays []models.Reservation
+
+	query := `
+		SELECT
+			coalesce(r.id, 0), coalesce(r.first_name, ''), coalesce(r.last_name, ''),
+			rr.start_date, rr.end_date, rr.room_id, coalesce(r.status, ''),
+			coalesce(r.adults, 0), coalesce(r.children, 0), rm.id, rm.room_name
+		FROM
+			room_restrictions AS rr
+		LEFT JOIN
+			reservations AS r ON (rr.reservation_id = r.id)
+		LEFT JOIN
+			rooms AS rm ON (rr.room_id = rm.id)
+		WHERE
+			rr.start_date <= $2 AND rr.end_date >= $2
+			AND (
+				(rr.restriction_id = $1 AND r.status NOT IN ('cancelled', 'no-show'))
+				OR (rr.restriction_id = $3 AND rr.import_id IS NOT NULL)
+			)
+		ORDER BY
+			rm.room_name, rr.start_date
+	`
+	rows, err := m.DB.QueryContext(ctx, query, models.RestrictionReservation, day, models.RestrictionOwnerBlock)
+	if err != nil {
+		return stays, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var i models.Reservation
+		err = rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomId,
+			&i.Status,
+			&i.Adults,
+			&i.Children,
+			&i.Room.ID,
+			&i.Room.RoomName,
+		)
+		if err != nil {
+			return stays, err
+		}
+		stays = append(stays, i)
+	}
+	if err = rows.Err(); err != nil {
+		return stays, err
+	}
+	return stays, nil
+}
+
+//RoomStatuses returns the housekeeping status of every active room, a room never cleaned through housekeeping is clean
+func (m *postgresDBRepo) RoomStatuses() ([]models.RoomStatus, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var statuses []models.RoomStatus
+
+	query := `
+		SELECT
+			rm.id, coalesce(rs.status, 'clean'), coalesce(rs.user_id, 0), coalesce(rs.updated_at, rm.updated_at), rm.room_name
+		FROM
+			rooms AS rm
+		LEFT JOIN
+			room_statuses AS rs ON (rs.room_id = rm.id)
+		WHERE
+			rm.active
+		ORDER BY
+			rm.room_name
+	`
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return statuses, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s models.RoomStatus
+		err = rows.Scan(&s.RoomID, &s.Status, &s.UserID, &s.ModifiedAt, &s.Room.RoomName)
+		if err != nil {
+			return statuses, err
+		}
+		s.Room.ID = s.RoomID
+		statuses = append(statuses, s)
+	}
+	if err = rows.Err(); err != nil {
+		return statuses, err
+	}
+	return statuses, nil
+}
+
+//GetRoomStatus returns the housekeeping status of a room by room ID
+func (m *postgresDBRepo) GetRoomStatus(roomID int) (models.RoomStatus, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var s models.RoomStatus
+	query := `
+		SELECT
+			rm.id, coalesce(rs.status, 'clean'), coalesce(rs.user_id, 0), coalesce(rs.updated_at, rm.updated_at), rm.room_name
+		FROM
+			rooms AS rm
+		LEFT JOIN
+			room_statuses AS rs ON (rs.room_id = rm.id)
+		WHERE
+			rm.id = $1
+	`
+	err := m.DB.QueryRowContext(ctx, query, roomID).Scan(&s.RoomID, &s.Status, &s.UserID, &s.ModifiedAt, &s.Room.RoomName)
+	if err != nil {
+		return s, err
+	}
+	s.Room.ID = s.RoomID
+	return s, nil
+}
+
+//UpdateRoomStatus changes housekeeping status of a room from status from to status to, userID is who made the change.
+//Returns ErrRoomStatusChanged if the room is no longer in status from
+func (m *postgresDBRepo) UpdateRoomStatus(roomID int, from, to string, userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO
+			room_statuses (room_id, status, user_id, created_at, updated_at)
+		VALUES
+			($1, $2, nullif($3, 0), $4, $4)
+		ON CONFLICT (room_id) DO UPDATE SET
+			status = excluded.status, user_id = excluded.user_id, updated_at = excluded.updated_at
+		WHERE
+			room_statuses.status = $5
+	`
+	result, err := m.DB.ExecContext(ctx, query, roomID, to, userID, time.Now(), from)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return repository.ErrRoomStatusChanged
+	}
+	return nil
+}
+
+//HousekeepingUsers returns users who get housekeeping tasks
+func (m *postgresDBRepo) HousekeepingUsers() ([]models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var users []models.User
+
+	query := `
+		SELECT
+			id, first_name, last_name, email, access_level
+		FROM
+			users
+		WHERE
+			access_level = $1
+		ORDER BY
+			first_name, last_name
+	`
+	rows, err := m.DB.QueryContext(ctx, query, fmt.Sprint(models.AccessHousekeeping))
+	if err != nil {
+		return users, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var u models.User
+		err = rows.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.AccessLevel)
+		if err != nil {
+			return users, err
+		}
+		users = append(users, u)
+	}
+	if err = rows.Err(); err != nil {
+		return users, err
+	}
+	return users, nil
+}
+
+//HousekeepingAssignments returns the housekeeping users assigned to rooms on day, mapped by room ID
+func (m *postgresDBRepo) HousekeepingAssignments(day time.Time) (map[int]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	assigned := make(map[int]int)
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT room_id, user_id FROM housekeeping_assignments WHERE task_date = $1`, day)
+	if err != nil {
+		return assigned, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var roomID, userID int
+		err = rows.Scan(&roomID, &userID)
+		if err != nil {
+			return assigned, err
+		}
+		assigned[roomID] = userID
+	}
+	if err = rows.Err(); err != nil {
+		return assigned, err
+	}
+	return assigned, nil
+}
+
+//AssignHousekeeping gives the task of room on day to user userID, userID 0 leaves the task unassigned
+func (m *postgresDBRepo) AssignHousekeeping(day time.Time, roomID, userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if userID == 0 {
+		_, err := m.DB.ExecContext(ctx, `DELETE FROM housekeeping_assignments WHERE task_date = $1 AND room_id = $2`, day, roomID)
+		return err
+	}
+
+	query := `
+		INSERT INTO
+			housekeeping_assignments (task_date, room_id, user_id, created_at, updated_at)
+		VALUES
+			($1, $2, $3, $4, $4)
+		ON CONFLICT (task_date, room_id) DO UPDATE SET
+			user_id = excluded.user_id, updated_at = excluded.updated_at
+	`
+	_, err := m.DB.ExecContext(ctx, query, day, roomID, userID, time.Now())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+//UnpaidReservations returns pending reservations whose deposit was due before given time and is not paid.
+//Payments with gift vouchers do not count, they are returned when the reservation is cancelled
+func (m *postgresDBRepo) UnpaidReservations(before time.Time) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `
+		SELECT
+			r.id, r.first_name, r.last_name, r.email, r.start_date, r.end_date, r.room_id,
+			r.status, r.total_price, r.payment_due_at
+		FROM
+			reservations AS r
+		WHERE
+			r.status = $1 AND r.payment_due_at < $2
+			AND NOT EXISTS (
+				SELECT 1 FROM payments AS p
+				WHERE p.reservation_id = r.id AND p.kind = $3 AND p.provider <> $4
+			)
+		ORDER BY
+			r.payment_due_at
+	`
+	rows, err := m.DB.QueryContext(ctx, query,
+		models.StatusPending, before, models.PaymentKindPayment, models.PaymentProviderVoucher)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var i models.Reservation
+		err = rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomId,
+			&i.Status,
+			&i.TotalPrice,
+			&i.PaymentDueAt,
+		)
+		if err != nil {
+			return reservations, err
+		}
+		reservations = append(reservations, i)
+	}
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+	return reservations, nil
+}
+
+//ExpireReservation cancels a pending reservation whose deposit was not paid, frees its dates and gives back its promo code use.
+//Returns ErrStatusChanged if the reservation is no longer pending or the deposit was paid meanwhile
+func (m *postgresDBRepo) ExpireReservation(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var promoCodeID int
+	err = tx.QueryRowContext(ctx, `
+		UPDATE
+			reservations AS r
+		SET
+			status = $1, cancelled_at = $2, updated_at = $2
+		WHERE
+			r.id = $3 AND r.status = $4 AND r.payment_due_at IS NOT NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM payments AS p
+				WHERE p.reservation_id = r.id AND p.kind = $5 AND p.provider <> $6
+			)
+		RETURNING
+			coalesce(r.promo_code_id, 0)`,
+		models.StatusCancelled, time.Now(), id, models.StatusPending, models.PaymentKindPayment, models.PaymentProviderVoucher,
+	).Scan(&promoCodeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.ErrStatusChanged
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM room_restrictions WHERE reservation_id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	if promoCodeID != 0 {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE
+				promo_codes
+			SET
+				times_used = times_used - 1, updated_at = $1
+			WHERE
+				id = $2 AND times_used > 0`,
+			time.Now(), promoCodeID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package dbrepo
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+//TestReservationColumnOrder checks queries select guest email and phone in the order they are scanned
+func TestReservationColumnOrder(t *testing.T) {
+	src, err := ioutil.ReadFile("postgresrepo.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range strings.Split(string(src), "\nfunc ")[1:] {
+		selected := strings.Index(fn, "r.email") < strings.Index(fn, "r.phone")
+		scanned := strings.Index(fn, ".Email,") < strings.Index(fn, ".Phone,")
+		if strings.Contains(fn, "r.email") && strings.Contains(fn, ".Phone,") && selected != scanned {
+			t.Errorf("%s scans email and phone in other order than it selects them", strings.TrimSuffix(strings.SplitN(fn, "\n", 2)[0], " {"))
+		}
+	}
+}
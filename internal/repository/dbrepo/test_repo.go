@@ -1,10 +1,12 @@
 package dbrepo
 
 import (
+	"database/sql"
 	"errors"
 	"time"
 
 	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+	"github.com/t-Ikonen/bbbookingsystem/internal/repository"
 )
 
 func (m *testDBRepo) AllUsers() bool {
@@ -23,19 +25,86 @@ func (m *testDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
 	return nil
 }
 
+//InsertReservationWithRestriction re-checks availability and inserts reservation and its room restriction in one transaction,
+//a hold with holdID is converted into the reservation restriction
+func (m *testDBRepo) InsertReservationWithRestriction(res models.Reservation, holdID int) (int, error) {
+	// room 2 is always taken, rooms over 3 do not exist
+	if res.RoomId == 2 {
+		return 0, repository.ErrRoomNotAvailable
+	}
+	if res.RoomId > 3 {
+		return 0, errors.New("some error")
+	}
+	// promo code 99 is used up by another guest meanwhile
+	if res.PromoCodeID == 99 {
+		return 0, repository.ErrPromoUsedUp
+	}
+	// voucher 99 is spent by another guest meanwhile
+	if res.VoucherID == 99 {
+		return 0, repository.ErrVoucherSpent
+	}
+	return 1, nil
+}
+
+//InsertHold holds a room for a guest in checkout until expiresAt, returns the hold ID
+func (m *testDBRepo) InsertHold(roomID int, start, end, expiresAt time.Time) (int, error) {
+	// room 2 is always taken, rooms over 3 do not exist
+	if roomID == 2 {
+		return 0, repository.ErrRoomNotAvailable
+	}
+	if roomID > 3 {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+//DeleteHold releases a hold by room restriction ID
+func (m *testDBRepo) DeleteHold(id int) error {
+	return nil
+}
+
+//DeleteExpiredHolds releases all expired holds, returns number of released holds
+func (m *testDBRepo) DeleteExpiredHolds() (int64, error) {
+	return 0, nil
+}
+
 //SearchAvailabilityByDatesByRoomId return false if given room has no availability, return true if availability
 func (m *testDBRepo) SearchAvailabilityByDatesByRoomId(start, end time.Time, roomID int) (bool, error) {
-
-	return false, nil
+	// start after 2060-01-01 fails the query, start after 2049-12-31 has no availability
+	if !start.Before(time.Date(2060, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		return false, errors.New("some error")
+	}
+	if start.After(time.Date(2049, 12, 31, 0, 0, 0, 0, time.UTC)) {
+		return false, nil
+	}
+	return true, nil
 }
 
-//SearchAvailabilityForAllRooms returns a slice of available rooms if any for given date range
-func (m *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+//SearchAvailabilityForAllRooms returns a slice of available rooms if any for given date range and number of guests
+func (m *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time, guests int) ([]models.Room, error) {
 
 	var rooms []models.Room
 	return rooms, nil
 }
 
+//SearchAlternativeDates returns free windows of the searched length shifted at most days from the searched dates
+func (m *testDBRepo) SearchAlternativeDates(start, end time.Time, guests, days int) ([]models.AlternativeStay, error) {
+	var stays []models.AlternativeStay
+	if guests > 2 {
+		return stays, nil
+	}
+	for _, shift := range []int{-2, 3} {
+		stays = append(stays, models.AlternativeStay{
+			RoomID:    1,
+			RoomName:  "Frost Suite",
+			StartDate: start.AddDate(0, 0, shift),
+			EndDate:   end.AddDate(0, 0, shift),
+			Shift:     shift,
+		})
+	}
+	return stays, nil
+}
+
 // GetRoomNameById gets room by ID
 func (m *testDBRepo) GetRoomNameById(id int) (models.Room, error) {
 	var room models.Room
@@ -43,9 +112,33 @@ func (m *testDBRepo) GetRoomNameById(id int) (models.Room, error) {
 	if id > 3 {
 		return room, errors.New("some error")
 	}
+	// room 3 is deactivated
+	room.ID = id
+	room.MaxOccupancy = 2
+	room.Active = id != 3
+	return room, nil
+}
+
+//GetRoomByICalToken returns the room of a calendar feed token
+func (m *testDBRepo) GetRoomByICalToken(token string) (models.Room, error) {
+	var room models.Room
+	if token == "unknown" {
+		return room, sql.ErrNoRows
+	}
+	room.ID = 2
+	room.RoomName = "Snow Suite"
+	room.ICalToken = token
 	return room, nil
 }
 
+//UpdateRoomICalToken gives a room a new calendar feed token
+func (m *testDBRepo) UpdateRoomICalToken(id int) error {
+	if id > 3 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
 // GetUsedById(id int) (models.User, error)
 // UpdateUser(user models.User) error
 // Authenticate(email, testPassword string) (int, string, error)
@@ -63,21 +156,60 @@ func (m *testDBRepo) Authenticate(email, testPassword string) (int, string, erro
 	return 1, "", nil
 }
 
-//AllReservations gets a slice  of  all the reservations for admin use
-func (m *testDBRepo) AllReservations() ([]models.Reservation, error) {
+//AllReservations gets a slice of reservations in status for admin use, all reservations when status is empty
+func (m *testDBRepo) AllReservations(status string) ([]models.Reservation, error) {
 	var reservation []models.Reservation
 	return reservation, nil
 }
 
-//AllNewReservations gets a slice  of  all the unprocessed reservations for admin use
-func (m *testDBRepo) AllNewReservations() ([]models.Reservation, error) {
-	var reservation []models.Reservation
-	return reservation, nil
+//ArrivalsOn returns reservations arriving on given day, cancelled and no-show ones left out
+func (m *testDBRepo) ArrivalsOn(day time.Time) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	reservations = append(reservations, models.Reservation{ID: 8, RoomId: 1, StartDate: day, EndDate: day.AddDate(0, 0, 2), Status: models.StatusConfirmed})
+	return reservations, nil
+}
+
+//DeparturesOn returns reservations departing on given day, cancelled and no-show ones left out
+func (m *testDBRepo) DeparturesOn(day time.Time) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	return reservations, nil
+}
+
+//InHouseReservations returns reservations whose guests are checked in
+func (m *testDBRepo) InHouseReservations() ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	reservations = append(reservations, models.Reservation{ID: 7, RoomId: 1, StartDate: time.Now().AddDate(0, 0, -1), EndDate: time.Now().AddDate(0, 0, 1), Status: models.StatusCheckedIn})
+	return reservations, nil
 }
 
-//GetReservationById get one unprocessed reservation by reservation ID
+//GetReservationById get one reservation by reservation ID
 func (m *testDBRepo) GetReservationById(id int) (models.Reservation, error) {
 	var res models.Reservation
+	if id > 100 {
+		return res, sql.ErrNoRows
+	}
+	res.ID = id
+	res.RoomId = 1
+	res.StartDate = time.Now().AddDate(0, 0, 30)
+	res.EndDate = time.Now().AddDate(0, 0, 32)
+	res.TotalPrice = 200
+	res.Status = models.StatusConfirmed
+	// reservation 5 is cancelled, reservation 7 is checked in,
+	// reservations 8 (confirmed) and 9 (pending) arrive today
+	switch id {
+	case 5:
+		res.Status = models.StatusCancelled
+		res.CancelledAt = time.Now().AddDate(0, 0, -1)
+	case 7:
+		res.Status = models.StatusCheckedIn
+		res.CheckedInAt = time.Now().AddDate(0, 0, -1)
+	case 8, 9:
+		res.StartDate = time.Now()
+		res.EndDate = time.Now().AddDate(0, 0, 2)
+		if id == 9 {
+			res.Status = models.StatusPending
+		}
+	}
 	return res, nil
 
 }
@@ -92,20 +224,669 @@ func (m *testDBRepo) UpdateReservation(u models.Reservation) error {
 func (m *testDBRepo) DeleteReservation(id int) error {
 	return nil
 }
-func (m *testDBRepo) UpdatePrcessed(id, processed int) error {
 
+//UpdateReservationStatus changes status of a reservation from status from to status to and records the time
+func (m *testDBRepo) UpdateReservationStatus(id int, from, to string) error {
+	// reservation 6 is changed by someone else meanwhile
+	if id == 6 {
+		return repository.ErrStatusChanged
+	}
 	return nil
 }
 
 //return all rooms
 func (m *testDBRepo) AllRooms() ([]models.Room, error) {
 	var rooms []models.Room
+	rooms = append(rooms, models.Room{ID: 1, RoomName: "Frost Suite", MaxOccupancy: 2, Active: true})
 	return rooms, nil
 }
 
 //return restriction for a room by ID
 func (m *testDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
 	var restrictions []models.RoomRestriction
-
+	if roomID > 3 {
+		return restrictions, errors.New("some error")
+	}
+	// room 2 has a reservation on nights 3-4, an owner block on day 10 and a block imported from another calendar
+	// on day 12 of the period
+	if roomID == 2 {
+		restrictions = append(restrictions, models.RoomRestriction{
+			ID:            1,
+			StartDate:     start.AddDate(0, 0, 2),
+			EndDate:       start.AddDate(0, 0, 4),
+			RoomId:        roomID,
+			ReservationId: 1,
+			RestrictionId: models.RestrictionReservation,
+		}, models.RoomRestriction{
+			ID:            2,
+			StartDate:     start.AddDate(0, 0, 9),
+			EndDate:       start.AddDate(0, 0, 10),
+			RoomId:        roomID,
+			RestrictionId: models.RestrictionOwnerBlock,
+		}, models.RoomRestriction{
+			ID:            3,
+			StartDate:     start.AddDate(0, 0, 11),
+			EndDate:       start.AddDate(0, 0, 12),
+			RoomId:        roomID,
+			RestrictionId: models.RestrictionOwnerBlock,
+			ImportID:      1,
+		})
+	}
 	return restrictions, nil
 }
+
+//InsertBlockForRoom inserts an owner block for one day of a room
+func (m *testDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
+	return nil
+}
+
+//DeleteBlockByID deletes an owner block by room restriction ID
+func (m *testDBRepo) DeleteBlockByID(id int) error {
+	return nil
+}
+
+//GetPricingForRoom returns pricing of a room with its seasonal prices
+func (m *testDBRepo) GetPricingForRoom(roomID int) (models.Pricing, error) {
+	var p models.Pricing
+	if roomID > 3 {
+		return p, errors.New("some error")
+	}
+	p.Price = 100
+	return p, nil
+}
+
+//AllPricing returns all pricing rows for choosing room pricing
+func (m *testDBRepo) AllPricing() ([]models.Pricing, error) {
+	var prices []models.Pricing
+	return prices, nil
+}
+
+//InsertRoom inserts a new room, returns its ID
+func (m *testDBRepo) InsertRoom(rm models.Room) (int, error) {
+	if rm.RoomName == "fail" {
+		return 0, errors.New("some error")
+	}
+	return 4, nil
+}
+
+//UpdateRoom updates room data
+func (m *testDBRepo) UpdateRoom(rm models.Room) error {
+	if rm.ID > 3 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+//UpdateRoomActive activates or deactivates a room, inactive rooms are not bookable
+func (m *testDBRepo) UpdateRoomActive(id int, active bool) error {
+	return nil
+}
+
+//DeleteRoom deletes a room without reservations
+func (m *testDBRepo) DeleteRoom(id int) error {
+	// room 1 has reservations, rooms over 3 do not exist
+	if id == 1 {
+		return repository.ErrRoomHasReservations
+	}
+	if id > 3 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+//GetRulesForRoomByDate returns stay rules of a room overlapping the date range, rule dates are inclusive
+func (m *testDBRepo) GetRulesForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	var rules []models.RoomRestriction
+	// room 3 requires at least 3 nights
+	if roomID == 3 {
+		rules = append(rules, models.RoomRestriction{
+			RoomId:        3,
+			StartDate:     start,
+			EndDate:       end,
+			RestrictionId: models.RestrictionMinNights,
+			RuleValue:     3,
+		})
+	}
+	// room 2 allows at most 14 nights
+	if roomID == 2 {
+		rules = append(rules, models.RoomRestriction{
+			RoomId:        2,
+			StartDate:     start,
+			EndDate:       end,
+			RestrictionId: models.RestrictionMaxNights,
+			RuleValue:     14,
+		})
+	}
+	return rules, nil
+}
+
+//AllRoomRules returns all stay rules with room names for admin use
+func (m *testDBRepo) AllRoomRules() ([]models.RoomRestriction, error) {
+	var rules []models.RoomRestriction
+	return rules, nil
+}
+
+//InsertRoomRule inserts a stay rule for a room and date range
+func (m *testDBRepo) InsertRoomRule(rr models.RoomRestriction) error {
+	return nil
+}
+
+//DeleteRoomRule deletes a stay rule by room restriction ID
+func (m *testDBRepo) DeleteRoomRule(id int) error {
+	return nil
+}
+
+//InsertWaitlistEntry puts a guest on the waitlist, returns entry ID
+func (m *testDBRepo) InsertWaitlistEntry(e models.WaitlistEntry) (int, error) {
+	if e.Email == "fail@here.com" {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+//PendingWaitlistEntries returns waitlist entries not yet notified whose stay has not started
+func (m *testDBRepo) PendingWaitlistEntries() ([]models.WaitlistEntry, error) {
+	var entries []models.WaitlistEntry
+	return entries, nil
+}
+
+//UpdateWaitlistNotified marks a waitlist entry as notified
+func (m *testDBRepo) UpdateWaitlistNotified(id int) error {
+	return nil
+}
+
+//InsertAPIToken stores a new API token, returns token ID
+func (m *testDBRepo) InsertAPIToken(t models.APIToken) (int, error) {
+	return 1, nil
+}
+
+//AllAPITokensForUser returns API tokens of a user
+func (m *testDBRepo) AllAPITokensForUser(userID int) ([]models.APIToken, error) {
+	var tokens []models.APIToken
+	return tokens, nil
+}
+
+//DeleteAPIToken deletes API token of a user
+func (m *testDBRepo) DeleteAPIToken(id, userID int) error {
+	return nil
+}
+
+//GetUserIDByAPIToken returns user ID for a token hash
+func (m *testDBRepo) GetUserIDByAPIToken(tokenHash string) (int, error) {
+	if tokenHash == "" {
+		return 0, errors.New("no such token")
+	}
+	return 1, nil
+}
+
+//AllICalImports returns all external calendars mirrored to rooms
+func (m *testDBRepo) AllICalImports() ([]models.ICalImport, error) {
+	var imports []models.ICalImport
+	return imports, nil
+}
+
+//GetICalImportByID returns one external calendar
+func (m *testDBRepo) GetICalImportByID(id int) (models.ICalImport, error) {
+	var i models.ICalImport
+	if id > 3 {
+		return i, sql.ErrNoRows
+	}
+	i.ID = id
+	i.RoomID = 1
+	return i, nil
+}
+
+//InsertICalImport adds an external calendar to a room, returns its ID
+func (m *testDBRepo) InsertICalImport(imp models.ICalImport) (int, error) {
+	if imp.RoomID > 3 {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+//DeleteICalImport removes an external calendar
+func (m *testDBRepo) DeleteICalImport(id int) error {
+	return nil
+}
+
+//UpdateICalImportStatus records the latest sync
+func (m *testDBRepo) UpdateICalImportStatus(id int, syncError string) error {
+	return nil
+}
+
+//SyncImportedBlocks mirrors blocks of an external calendar, blocks of room 2 overlap bookings and are skipped
+func (m *testDBRepo) SyncImportedBlocks(importID, roomID int, blocks []models.RoomRestriction) (int, error) {
+	if roomID > 3 {
+		return 0, errors.New("some error")
+	}
+	if roomID == 2 {
+		return len(blocks), nil
+	}
+	return 0, nil
+}
+
+//AllCancellationPolicies returns all cancellation policies with their tiers
+func (m *testDBRepo) AllCancellationPolicies() ([]models.CancellationPolicy, error) {
+	var policies []models.CancellationPolicy
+	return policies, nil
+}
+
+//GetCancellationPolicyForRoom returns cancellation policy of a room, or of its rate plan if the room has none
+func (m *testDBRepo) GetCancellationPolicyForRoom(roomID int) (models.CancellationPolicy, error) {
+	var p models.CancellationPolicy
+	if roomID > 3 {
+		return p, errors.New("some error")
+	}
+	// room 1 is free to cancel until 14 days and half refunded until 7 days before arrival
+	if roomID == 1 {
+		p.ID = 1
+		p.Name = "Moderate"
+		p.Tiers = []models.CancellationTier{
+			{PolicyID: 1, DaysBefore: 14, RefundPercent: 100},
+			{PolicyID: 1, DaysBefore: 7, RefundPercent: 50},
+		}
+	}
+	return p, nil
+}
+
+//InsertCancellationPolicy inserts a cancellation policy with its tiers, returns its ID
+func (m *testDBRepo) InsertCancellationPolicy(p models.CancellationPolicy) (int, error) {
+	if p.Name == "fail" {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+//DeleteCancellationPolicy deletes a cancellation policy
+func (m *testDBRepo) DeleteCancellationPolicy(id int) error {
+	return nil
+}
+
+//UpdatePricingCancellationPolicy sets cancellation policy of a rate plan
+func (m *testDBRepo) UpdatePricingCancellationPolicy(pricingID, policyID int) error {
+	if pricingID > 3 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+//CancelReservation marks a reservation cancelled with the refunded amount and frees its dates
+func (m *testDBRepo) CancelReservation(id int, refund float32) error {
+	// reservation 5 is cancelled, reservation 6 cannot be cancelled
+	if id == 5 {
+		return repository.ErrAlreadyCancelled
+	}
+	if id == 6 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+//MoveReservation changes dates, room and total price of a reservation and moves its room restriction
+func (m *testDBRepo) MoveReservation(res models.Reservation) error {
+	// room 2 is always taken, rooms over 3 do not exist
+	if res.RoomId == 2 {
+		return repository.ErrRoomNotAvailable
+	}
+	if res.RoomId > 3 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+//InsertAuditEntry records an admin action
+func (m *testDBRepo) InsertAuditEntry(e models.AuditEntry) error {
+	return nil
+}
+
+//AuditEntries returns audit entries matching the filter, newest first
+func (m *testDBRepo) AuditEntries(f models.AuditFilter) ([]models.AuditEntry, error) {
+	var entries []models.AuditEntry
+	// entries of reservation 101 cannot be read
+	if f.EntityID > 100 {
+		return entries, errors.New("some error")
+	}
+	return entries, nil
+}
+
+//InsertInvoice saves invoice with its lines and gives it the next invoice number
+func (m *testDBRepo) InsertInvoice(inv models.Invoice) (models.Invoice, error) {
+	// invoice of reservation 6 cannot be saved
+	if inv.ReservationID == 6 {
+		return inv, errors.New("some error")
+	}
+	inv.ID = 1
+	inv.Number = 1001
+	return inv, nil
+}
+
+//GetInvoiceById returns one invoice with its lines
+func (m *testDBRepo) GetInvoiceById(id int) (models.Invoice, error) {
+	var inv models.Invoice
+	if id > 100 {
+		return inv, sql.ErrNoRows
+	}
+	// invoice 7 is of reservation 7 whose deposit is paid
+	inv.ID = id
+	inv.Number = 1000 + id
+	inv.ReservationID = 1
+	if id == 7 {
+		inv.ReservationID = 7
+	}
+	inv.IssueDate = time.Now()
+	inv.DueDate = time.Now().AddDate(0, 0, 14)
+	inv.BuyerEmail = "me@here.com"
+	inv.Lines = []models.InvoiceLine{{ID: 1, InvoiceID: id, Description: "Accommodation", Quantity: 2, UnitPrice: 100, VATRate: 14, Total: 200}}
+	inv.Total = 200
+	return inv, nil
+}
+
+//InvoicesForReservation returns invoices of a reservation without their lines, oldest first
+func (m *testDBRepo) InvoicesForReservation(reservationID int) ([]models.Invoice, error) {
+	var invoices []models.Invoice
+	// reservation 7 is invoiced already
+	if reservationID == 7 {
+		invoices = append(invoices, models.Invoice{ID: 1, Number: 1001, ReservationID: 7, Total: 200})
+	}
+	return invoices, nil
+}
+
+//InsertPayment adds a payment or refund to the payments ledger
+func (m *testDBRepo) InsertPayment(p models.Payment) (int, error) {
+	// payments of reservation 6 cannot be saved
+	if p.ReservationID == 6 {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+//PaymentsForReservation returns the payments ledger of a reservation, oldest first
+func (m *testDBRepo) PaymentsForReservation(reservationID int) ([]models.Payment, error) {
+	var ledger []models.Payment
+	// reservation 7 has paid its deposit
+	if reservationID == 7 {
+		ledger = append(ledger, models.Payment{ID: 1, ReservationID: 7, Kind: models.PaymentKindPayment, Amount: 60, Provider: "fake", ProviderRef: "fake_pi_1", IntentID: "fake_pi_1"})
+	}
+	// reservation 10 was paid with a gift voucher
+	if reservationID == 10 {
+		ledger = append(ledger, models.Payment{ID: 2, ReservationID: 10, Kind: models.PaymentKindPayment, Amount: 50, Provider: models.PaymentProviderVoucher, ProviderRef: "redemption-1", IntentID: "GIFT-1111"})
+	}
+	return ledger, nil
+}
+
+//AllPromoCodes returns all promo codes with their rooms and booking statistics, newest first
+func (m *testDBRepo) AllPromoCodes() ([]models.PromoCode, error) {
+	var codes []models.PromoCode
+	code, _ := m.GetPromoCodeByCode("SUMMER")
+	codes = append(codes, code)
+	return codes, nil
+}
+
+//GetPromoCodeByCode returns a promo code with its rooms by the code guests enter
+func (m *testDBRepo) GetPromoCodeByCode(code string) (models.PromoCode, error) {
+	p := models.PromoCode{
+		ID:        1,
+		Code:      code,
+		Kind:      models.PromoPercent,
+		Value:     10,
+		ValidFrom: time.Now().AddDate(0, 0, -1),
+		ValidTo:   time.Now().AddDate(1, 0, 0),
+	}
+	// SUMMER is valid for all, ROOM3 only for room 3, OLD has expired, FULL is used up and RACE gets used up while booking
+	switch code {
+	case "SUMMER":
+	case "ROOM3":
+		p.ID = 2
+		p.Kind = models.PromoFixed
+		p.Value = 20
+		p.RoomIDs = []int{3}
+	case "OLD":
+		p.ID = 3
+		p.ValidTo = time.Now().AddDate(0, 0, -1)
+	case "FULL":
+		p.ID = 4
+		p.UsageLimit = 1
+		p.TimesUsed = 1
+	case "RACE":
+		p.ID = 99
+	case "ERROR":
+		return p, errors.New("some error")
+	default:
+		return models.PromoCode{}, sql.ErrNoRows
+	}
+	return p, nil
+}
+
+//GetPromoCodeById returns a promo code with its rooms by ID
+func (m *testDBRepo) GetPromoCodeById(id int) (models.PromoCode, error) {
+	if id > 100 {
+		return models.PromoCode{}, sql.ErrNoRows
+	}
+	return m.GetPromoCodeByCode("SUMMER")
+}
+
+//InsertPromoCode saves a new promo code with its rooms
+func (m *testDBRepo) InsertPromoCode(p models.PromoCode) (int, error) {
+	if p.Code == "FAIL" {
+		return 0, errors.New("some error")
+	}
+	return 5, nil
+}
+
+//DeletePromoCode deletes a promo code, reservations made with it keep their discount
+func (m *testDBRepo) DeletePromoCode(id int) error {
+	if id > 100 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+//AllVouchers returns all gift vouchers, newest first
+func (m *testDBRepo) AllVouchers() ([]models.Voucher, error) {
+	var vouchers []models.Voucher
+	v, _ := m.GetVoucherByCode("GIFT-1111")
+	vouchers = append(vouchers, v)
+	return vouchers, nil
+}
+
+//GetVoucherByCode returns a gift voucher with its redemptions by the code guests enter
+func (m *testDBRepo) GetVoucherByCode(code string) (models.Voucher, error) {
+	v := models.Voucher{
+		ID:            1,
+		Code:          code,
+		Amount:        100,
+		Balance:       50,
+		ExpiresAt:     time.Now().AddDate(1, 0, 0),
+		RecipientName: "Laura Palmer",
+		Redemptions: []models.VoucherRedemption{
+			{ID: 1, VoucherID: 1, ReservationID: 10, Amount: 50},
+		},
+	}
+	// GIFT-1111 has half of its amount left, GIFT-OLD has expired, GIFT-EMPTY is spent and GIFT-RACE gets spent while booking
+	switch code {
+	case "GIFT-1111":
+	case "GIFT-OLD":
+		v.ID = 2
+		v.ExpiresAt = time.Now().AddDate(0, 0, -1)
+	case "GIFT-EMPTY":
+		v.ID = 3
+		v.Balance = 0
+	case "GIFT-RACE":
+		v.ID = 99
+	case "ERROR":
+		return v, errors.New("some error")
+	default:
+		return models.Voucher{}, sql.ErrNoRows
+	}
+	return v, nil
+}
+
+//GetVoucherById returns a gift voucher with its redemptions by ID
+func (m *testDBRepo) GetVoucherById(id int) (models.Voucher, error) {
+	if id > 100 {
+		return models.Voucher{}, sql.ErrNoRows
+	}
+	return m.GetVoucherByCode("GIFT-1111")
+}
+
+//InsertVoucher saves a new gift voucher with its whole amount as balance
+func (m *testDBRepo) InsertVoucher(v models.Voucher) (int, error) {
+	if v.RecipientName == "FAIL" {
+		return 0, errors.New("some error")
+	}
+	return 5, nil
+}
+
+//RefundToVoucher returns amount of voucher payment p back to the balance of the voucher and records the refund
+func (m *testDBRepo) RefundToVoucher(p models.Payment, amount float32) error {
+	return nil
+}
+
+//AllExtras returns the extras catalogue with the rooms of each extra
+func (m *testDBRepo) AllExtras() ([]models.Extra, error) {
+	return m.ExtrasForRoom(1)
+}
+
+//ExtrasForRoom returns the extras guests can book with room roomID
+func (m *testDBRepo) ExtrasForRoom(roomID int) ([]models.Extra, error) {
+	// extras of room 99 cannot be read, the sauna evening is only for room 3
+	if roomID == 99 {
+		return nil, errors.New("some error")
+	}
+	extras := []models.Extra{
+		{ID: 1, Name: "Breakfast", Price: 12.5, Unit: models.ExtraPerNight, VATRate: 14},
+		{ID: 2, Name: "Northern lights tour", Price: 89, Unit: models.ExtraPerPerson, VATRate: 25.5},
+	}
+	if roomID == 3 {
+		extras = append(extras, models.Extra{ID: 3, Name: "Sauna evening", Price: 40, Unit: models.ExtraPerStay, VATRate: 25.5, RoomIDs: []int{3}})
+	}
+	return extras, nil
+}
+
+//GetExtraById returns an extra with its rooms by ID
+func (m *testDBRepo) GetExtraById(id int) (models.Extra, error) {
+	if id > 100 {
+		return models.Extra{}, sql.ErrNoRows
+	}
+	return models.Extra{ID: id, Name: "Breakfast", Price: 12.5, Unit: models.ExtraPerNight, VATRate: 14}, nil
+}
+
+//InsertExtra saves a new extra with its rooms
+func (m *testDBRepo) InsertExtra(e models.Extra) (int, error) {
+	if e.Name == "FAIL" {
+		return 0, errors.New("some error")
+	}
+	return 4, nil
+}
+
+//UpdateExtra updates an extra and replaces its rooms
+func (m *testDBRepo) UpdateExtra(e models.Extra) error {
+	if e.Name == "FAIL" {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+//DeleteExtra deletes an extra from the catalogue
+func (m *testDBRepo) DeleteExtra(id int) error {
+	if id > 100 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+//StaysOn returns reservations with their rooms whose dates in room_restrictions include day, from arrival to departure
+func (m *testDBRepo) StaysOn(day time.Time) ([]models.Reservation, error) {
+	// room 1 has a stay-over, room 2 a turnover, room 3 an arrival and room 4 an imported departure
+	var stays []models.Reservation
+	stays = append(stays, models.Reservation{ID: 7, RoomId: 1, StartDate: day.AddDate(0, 0, -1), EndDate: day.AddDate(0, 0, 1), Adults: 2, Status: models.StatusCheckedIn, Room: models.Room{ID: 1, RoomName: "Frost Suite"}})
+	stays = append(stays, models.Reservation{ID: 11, RoomId: 2, StartDate: day.AddDate(0, 0, -3), EndDate: day, Adults: 1, Status: models.StatusCheckedIn, Room: models.Room{ID: 2, RoomName: "Snow Suite"}})
+	stays = append(stays, models.Reservation{ID: 8, RoomId: 2, StartDate: day, EndDate: day.AddDate(0, 0, 2), Adults: 2, Status: models.StatusConfirmed, Room: models.Room{ID: 2, RoomName: "Snow Suite"}})
+	stays = append(stays, models.Reservation{ID: 9, RoomId: 3, StartDate: day, EndDate: day.AddDate(0, 0, 3), Adults: 1, Children: 1, Status: models.StatusPending, Room: models.Room{ID: 3, RoomName: "Northern Lights"}})
+	stays = append(stays, models.Reservation{RoomId: 4, StartDate: day.AddDate(0, 0, -2), EndDate: day, Room: models.Room{ID: 4, RoomName: "Aurora"}})
+	return stays, nil
+}
+
+//RoomStatuses returns the housekeeping status of every active room
+func (m *testDBRepo) RoomStatuses() ([]models.RoomStatus, error) {
+	var statuses []models.RoomStatus
+	for roomID := 1; roomID <= 3; roomID++ {
+		s, _ := m.GetRoomStatus(roomID)
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+//GetRoomStatus returns the housekeeping status of a room by room ID
+func (m *testDBRepo) GetRoomStatus(roomID int) (models.RoomStatus, error) {
+	// room 1 is clean, 2 dirty, 3 inspected and others being cleaned
+	if roomID > 100 {
+		return models.RoomStatus{}, sql.ErrNoRows
+	}
+	s := models.RoomStatus{RoomID: roomID, Status: models.RoomCleaning, Room: models.Room{ID: roomID}}
+	switch roomID {
+	case 1:
+		s.Status = models.RoomClean
+	case 2:
+		s.Status = models.RoomDirty
+	case 3:
+		s.Status = models.RoomInspected
+	}
+	return s, nil
+}
+
+//UpdateRoomStatus changes housekeeping status of a room from status from to status to
+func (m *testDBRepo) UpdateRoomStatus(roomID int, from, to string, userID int) error {
+	// room 4 changes status while the form is open, room 99 cannot be saved
+	if roomID == 4 {
+		return repository.ErrRoomStatusChanged
+	}
+	if roomID == 99 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+//HousekeepingUsers returns users who get housekeeping tasks
+func (m *testDBRepo) HousekeepingUsers() ([]models.User, error) {
+	var users []models.User
+	users = append(users, models.User{ID: 2, FirstName: "Hanna", LastName: "Housekeeper", AccessLevel: models.AccessHousekeeping})
+	return users, nil
+}
+
+//HousekeepingAssignments returns the housekeeping users assigned to rooms on day, mapped by room ID
+func (m *testDBRepo) HousekeepingAssignments(day time.Time) (map[int]int, error) {
+	return map[int]int{2: 2}, nil
+}
+
+//AssignHousekeeping gives the task of room on day to user userID
+func (m *testDBRepo) AssignHousekeeping(day time.Time, roomID, userID int) error {
+	if roomID > 100 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+//UnpaidReservations returns pending reservations whose deposit was due before given time and is not paid
+func (m *testDBRepo) UnpaidReservations(before time.Time) ([]models.Reservation, error) {
+	// reservation 9 waits for its deposit, reservation 6 was paid meanwhile
+	var reservations []models.Reservation
+	for _, id := range []int{9, 6, 10} {
+		reservations = append(reservations, models.Reservation{
+			ID:           id,
+			RoomId:       1,
+			Status:       models.StatusPending,
+			TotalPrice:   200,
+			PaymentDueAt: before.Add(-time.Minute),
+		})
+	}
+	return reservations, nil
+}
+
+//ExpireReservation cancels a pending reservation whose deposit was not paid and frees its dates
+func (m *testDBRepo) ExpireReservation(id int) error {
+	if id == 6 {
+		return repository.ErrStatusChanged
+	}
+	return nil
+}
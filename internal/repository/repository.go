@@ -1,28 +1,123 @@
 package repository
 
 import (
+	"errors"
 	"time"
 
 	"github.com/t-Ikonen/bbbookingsystem/internal/models"
 )
 
+//ErrRoomNotAvailable is returned when a room is already taken for the requested dates
+var ErrRoomNotAvailable = errors.New("room is not available for the requested dates")
+
+//ErrAlreadyCancelled is returned when cancelling a reservation that is already cancelled
+var ErrAlreadyCancelled = errors.New("reservation is already cancelled")
+
+//ErrPromoUsedUp is returned when a promo code reaches its usage limit before the booking is saved
+var ErrPromoUsedUp = errors.New("promo code has been used up")
+
+//ErrVoucherSpent is returned when a gift voucher is spent or expires before the booking is saved
+var ErrVoucherSpent = errors.New("voucher balance is not enough")
+
+//ErrStatusChanged is returned when a reservation is no longer in the status it was expected to change from
+var ErrStatusChanged = errors.New("reservation status has changed")
+
+//ErrRoomHasReservations is returned when deleting a room that has reservations, such rooms are deactivated instead
+var ErrRoomHasReservations = errors.New("room has reservations")
+
+//ErrRoomStatusChanged is returned when a room is no longer in the housekeeping status it was expected to change from
+var ErrRoomStatusChanged = errors.New("room status has changed")
+
 type DatabaseRepo interface {
 	AllUsers() bool
 
 	InsertReservation(res models.Reservation) (int, error)
 	InsertRoomRestriction(r models.RoomRestriction) error
+	InsertReservationWithRestriction(res models.Reservation, holdID int) (int, error)
+	InsertHold(roomID int, start, end, expiresAt time.Time) (int, error)
+	DeleteHold(id int) error
+	DeleteExpiredHolds() (int64, error)
 	SearchAvailabilityByDatesByRoomId(start, end time.Time, roomID int) (bool, error)
-	SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error)
+	SearchAvailabilityForAllRooms(start, end time.Time, guests int) ([]models.Room, error)
+	SearchAlternativeDates(start, end time.Time, guests, days int) ([]models.AlternativeStay, error)
 	GetRoomNameById(id int) (models.Room, error)
+	GetRoomByICalToken(token string) (models.Room, error)
+	UpdateRoomICalToken(id int) error
 	GetUsedById(id int) (models.User, error)
 	UpdateUser(user models.User) error
 	Authenticate(email, testPassword string) (int, string, error)
-	AllReservations() ([]models.Reservation, error)
-	AllNewReservations() ([]models.Reservation, error)
+	AllReservations(status string) ([]models.Reservation, error)
+	ArrivalsOn(day time.Time) ([]models.Reservation, error)
+	DeparturesOn(day time.Time) ([]models.Reservation, error)
+	InHouseReservations() ([]models.Reservation, error)
 	GetReservationById(id int) (models.Reservation, error)
 	UpdateReservation(u models.Reservation) error
+	MoveReservation(res models.Reservation) error
 	DeleteReservation(id int) error
-	UpdatePrcessed(id, processed int) error
+	UpdateReservationStatus(id int, from, to string) error
 	AllRooms() ([]models.Room, error)
 	GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error)
+	InsertBlockForRoom(id int, startDate time.Time) error
+	DeleteBlockByID(id int) error
+	GetPricingForRoom(roomID int) (models.Pricing, error)
+	AllPricing() ([]models.Pricing, error)
+	InsertRoom(rm models.Room) (int, error)
+	UpdateRoom(rm models.Room) error
+	UpdateRoomActive(id int, active bool) error
+	DeleteRoom(id int) error
+	GetRulesForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error)
+	AllRoomRules() ([]models.RoomRestriction, error)
+	InsertRoomRule(rr models.RoomRestriction) error
+	DeleteRoomRule(id int) error
+	InsertWaitlistEntry(e models.WaitlistEntry) (int, error)
+	PendingWaitlistEntries() ([]models.WaitlistEntry, error)
+	UpdateWaitlistNotified(id int) error
+	InsertAPIToken(t models.APIToken) (int, error)
+	AllAPITokensForUser(userID int) ([]models.APIToken, error)
+	DeleteAPIToken(id, userID int) error
+	GetUserIDByAPIToken(tokenHash string) (int, error)
+	AllICalImports() ([]models.ICalImport, error)
+	GetICalImportByID(id int) (models.ICalImport, error)
+	InsertICalImport(imp models.ICalImport) (int, error)
+	DeleteICalImport(id int) error
+	UpdateICalImportStatus(id int, syncError string) error
+	SyncImportedBlocks(importID, roomID int, blocks []models.RoomRestriction) (int, error)
+	AllCancellationPolicies() ([]models.CancellationPolicy, error)
+	GetCancellationPolicyForRoom(roomID int) (models.CancellationPolicy, error)
+	InsertCancellationPolicy(p models.CancellationPolicy) (int, error)
+	DeleteCancellationPolicy(id int) error
+	UpdatePricingCancellationPolicy(pricingID, policyID int) error
+	CancelReservation(id int, refund float32) error
+	InsertAuditEntry(e models.AuditEntry) error
+	AuditEntries(f models.AuditFilter) ([]models.AuditEntry, error)
+	InsertInvoice(inv models.Invoice) (models.Invoice, error)
+	GetInvoiceById(id int) (models.Invoice, error)
+	InvoicesForReservation(reservationID int) ([]models.Invoice, error)
+	InsertPayment(p models.Payment) (int, error)
+	PaymentsForReservation(reservationID int) ([]models.Payment, error)
+	AllPromoCodes() ([]models.PromoCode, error)
+	GetPromoCodeByCode(code string) (models.PromoCode, error)
+	GetPromoCodeById(id int) (models.PromoCode, error)
+	InsertPromoCode(p models.PromoCode) (int, error)
+	DeletePromoCode(id int) error
+	AllVouchers() ([]models.Voucher, error)
+	GetVoucherByCode(code string) (models.Voucher, error)
+	GetVoucherById(id int) (models.Voucher, error)
+	InsertVoucher(v models.Voucher) (int, error)
+	RefundToVoucher(p models.Payment, amount float32) error
+	AllExtras() ([]models.Extra, error)
+	ExtrasForRoom(roomID int) ([]models.Extra, error)
+	GetExtraById(id int) (models.Extra, error)
+	InsertExtra(e models.Extra) (int, error)
+	UpdateExtra(e models.Extra) error
+	DeleteExtra(id int) error
+	StaysOn(day time.Time) ([]models.Reservation, error)
+	RoomStatuses() ([]models.RoomStatus, error)
+	GetRoomStatus(roomID int) (models.RoomStatus, error)
+	UpdateRoomStatus(roomID int, from, to string, userID int) error
+	HousekeepingUsers() ([]models.User, error)
+	HousekeepingAssignments(day time.Time) (map[int]int, error)
+	AssignHousekeeping(day time.Time, roomID, userID int) error
+	UnpaidReservations(before time.Time) ([]models.Reservation, error)
+	ExpireReservation(id int) error
 }
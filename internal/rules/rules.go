@@ -0,0 +1,48 @@
+//Package rules checks stays against minimum stay, maximum stay and arrival/departure day rules
+package rules
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+)
+
+//Check returns reasons why a stay from start to end breaks the stay rules, empty if the stay is allowed
+func Check(rules []models.RoomRestriction, start, end time.Time) []string {
+	var reasons []string
+	nights := int(dateOnly(end).Sub(dateOnly(start)).Hours() / 24)
+
+	for _, r := range rules {
+		switch r.RestrictionId {
+		case models.RestrictionMinNights:
+			if covers(r, start) && nights < r.RuleValue {
+				reasons = append(reasons, fmt.Sprintf("Stays arriving on %s must be at least %d nights", start.Format("02-01-2006"), r.RuleValue))
+			}
+		case models.RestrictionMaxNights:
+			if covers(r, start) && nights > r.RuleValue {
+				reasons = append(reasons, fmt.Sprintf("Stays arriving on %s can be at most %d nights", start.Format("02-01-2006"), r.RuleValue))
+			}
+		case models.RestrictionClosedToArrival:
+			if covers(r, start) {
+				reasons = append(reasons, fmt.Sprintf("No arrivals on %s", start.Format("02-01-2006")))
+			}
+		case models.RestrictionClosedToDeparture:
+			if covers(r, end) {
+				reasons = append(reasons, fmt.Sprintf("No departures on %s", end.Format("02-01-2006")))
+			}
+		}
+	}
+	return reasons
+}
+
+//covers returns true if day d is within the rule dates, both ends included
+func covers(r models.RoomRestriction, d time.Time) bool {
+	day := dateOnly(d)
+	return !day.Before(dateOnly(r.StartDate)) && !day.After(dateOnly(r.EndDate))
+}
+
+func dateOnly(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
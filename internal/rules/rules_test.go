@@ -0,0 +1,44 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+)
+
+func day(d int) time.Time {
+	return time.Date(2050, 12, d, 0, 0, 0, 0, time.UTC)
+}
+
+var testRules = []models.RoomRestriction{
+	{StartDate: day(1), EndDate: day(10), RestrictionId: models.RestrictionMinNights, RuleValue: 3},
+	{StartDate: day(1), EndDate: day(31), RestrictionId: models.RestrictionMaxNights, RuleValue: 7},
+	{StartDate: day(24), EndDate: day(24), RestrictionId: models.RestrictionClosedToArrival},
+	{StartDate: day(26), EndDate: day(26), RestrictionId: models.RestrictionClosedToDeparture},
+}
+
+var checkTests = []struct {
+	name    string
+	start   time.Time
+	end     time.Time
+	reasons int
+}{
+	{"allowed", day(2), day(5), 0},
+	{"too short", day(2), day(4), 1},
+	{"too long", day(11), day(20), 1},
+	{"short outside min rule", day(11), day(12), 0},
+	{"last day of min rule", day(10), day(11), 1},
+	{"closed to arrival", day(24), day(25), 1},
+	{"closed to departure", day(22), day(26), 1},
+	{"both closed", day(24), day(26), 2},
+}
+
+func TestCheck(t *testing.T) {
+	for _, e := range checkTests {
+		reasons := Check(testRules, e.start, e.end)
+		if len(reasons) != e.reasons {
+			t.Errorf("for %s expected %d reasons but got %d: %v", e.name, e.reasons, len(reasons), reasons)
+		}
+	}
+}
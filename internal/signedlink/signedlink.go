@@ -0,0 +1,58 @@
+//Package signedlink makes and checks expiring HMAC signed tokens for guest links
+package signedlink
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	//ErrInvalid is returned for tokens that are malformed or not signed with the key
+	ErrInvalid = errors.New("invalid link")
+	//ErrExpired is returned for correctly signed tokens past their expiry
+	ErrExpired = errors.New("link has expired")
+)
+
+//Sign returns a token for reservation id valid until expires, the token is <id>.<expiry unix time>.<signature>
+func Sign(key []byte, id int, expires time.Time) string {
+	payload := fmt.Sprintf("%d.%d", id, expires.Unix())
+	return payload + "." + signature(key, payload)
+}
+
+//Verify checks token signature and expiry and returns the reservation id of the token
+func Verify(key []byte, token string, now time.Time) (int, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, ErrInvalid
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(signature(key, payload))) {
+		return 0, ErrInvalid
+	}
+
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, ErrInvalid
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, ErrInvalid
+	}
+	if now.Unix() > expires {
+		return 0, ErrExpired
+	}
+	return id, nil
+}
+
+//signature is the base64 encoded HMAC-SHA256 of payload
+func signature(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,41 @@
+package signedlink
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var key = []byte("test signing key")
+
+func TestSignVerify(t *testing.T) {
+	now := time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)
+	token := Sign(key, 42, now.Add(time.Hour))
+
+	var verifyTests = []struct {
+		name        string
+		key         []byte
+		token       string
+		now         time.Time
+		expectedID  int
+		expectedErr error
+	}{
+		{"valid", key, token, now, 42, nil},
+		{"expired", key, token, now.Add(2 * time.Hour), 0, ErrExpired},
+		{"other key", []byte("other key"), token, now, 0, ErrInvalid},
+		{"changed id", key, "43" + strings.TrimPrefix(token, "42"), now, 0, ErrInvalid},
+		{"malformed", key, "42.abc", now, 0, ErrInvalid},
+		{"empty", key, "", now, 0, ErrInvalid},
+	}
+
+	for _, e := range verifyTests {
+		id, err := Verify(e.key, e.token, e.now)
+		if !errors.Is(err, e.expectedErr) {
+			t.Errorf("for %s expected error %v but got %v", e.name, e.expectedErr, err)
+		}
+		if id != e.expectedID {
+			t.Errorf("for %s expected id %d but got %d", e.name, e.expectedID, id)
+		}
+	}
+}
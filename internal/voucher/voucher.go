@@ -0,0 +1,83 @@
+//Package voucher makes gift voucher codes and checks how much of a voucher can be spent
+package voucher
+
+import (
+	"crypto/rand"
+	"errors"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+)
+
+var (
+	//ErrExpired is returned for vouchers past their expiry date
+	ErrExpired = errors.New("voucher has expired")
+	//ErrSpent is returned for vouchers with no balance left
+	ErrSpent = errors.New("voucher has no balance left")
+)
+
+//ValidMonths is how long a new voucher is valid
+const ValidMonths = 12
+
+//Amounts guests can buy vouchers for
+const (
+	MinAmount = 20
+	MaxAmount = 2000
+)
+
+//codes leave out letters and digits that are easy to mix up
+const alphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+//NewCode returns a random voucher code of form XXXX-XXXX-XXXX
+func NewCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(alphabet)))
+	for i := 0; i < 12; i++ {
+		if i > 0 && i%4 == 0 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(alphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+//Normalize returns code the way codes are stored, without spaces and in upper case
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+//Expiry returns the expiry date of a voucher issued on day issued
+func Expiry(issued time.Time) time.Time {
+	y, m, d := issued.AddDate(0, ValidMonths, 0).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+//Check returns why voucher v cannot be spent on day now, nil when it can. The voucher is valid through its expiry day
+func Check(v models.Voucher, now time.Time) error {
+	if now.Format("2006-01-02") > v.ExpiresAt.Format("2006-01-02") {
+		return ErrExpired
+	}
+	if v.Balance <= 0 {
+		return ErrSpent
+	}
+	return nil
+}
+
+//Redeemable returns how much of voucher v is spent on total, the rest of the balance stays on the voucher
+func Redeemable(v models.Voucher, total float32) float32 {
+	r := v.Balance
+	if r > total {
+		r = total
+	}
+	if r < 0 {
+		r = 0
+	}
+	return float32(math.Round(float64(r)*100) / 100)
+}
@@ -0,0 +1,72 @@
+package voucher
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/t-Ikonen/bbbookingsystem/internal/models"
+)
+
+func TestNewCode(t *testing.T) {
+	format := regexp.MustCompile(`^[A-HJ-NP-Z2-9]{4}-[A-HJ-NP-Z2-9]{4}-[A-HJ-NP-Z2-9]{4}$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		code, err := NewCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !format.MatchString(code) {
+			t.Errorf("code %s is not of form XXXX-XXXX-XXXX", code)
+		}
+		if seen[code] {
+			t.Errorf("code %s made twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if c := Normalize(" abcd-efgh-2345 "); c != "ABCD-EFGH-2345" {
+		t.Errorf("expected ABCD-EFGH-2345 but got %s", c)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	e := Expiry(time.Date(2050, 11, 6, 15, 30, 0, 0, time.Local))
+	if !e.Equal(time.Date(2051, 11, 6, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("wrong expiry %v", e)
+	}
+}
+
+var checkTests = []struct {
+	name     string
+	balance  float32
+	now      time.Time
+	expected error
+}{
+	{"valid", 50, time.Date(2050, 11, 15, 12, 0, 0, 0, time.UTC), nil},
+	{"last day", 50, time.Date(2050, 11, 30, 23, 0, 0, 0, time.UTC), nil},
+	{"expired", 50, time.Date(2050, 12, 1, 0, 0, 0, 0, time.UTC), ErrExpired},
+	{"spent", 0, time.Date(2050, 11, 15, 0, 0, 0, 0, time.UTC), ErrSpent},
+}
+
+func TestCheck(t *testing.T) {
+	for _, e := range checkTests {
+		v := models.Voucher{Balance: e.balance, ExpiresAt: time.Date(2050, 11, 30, 0, 0, 0, 0, time.UTC)}
+		if err := Check(v, e.now); !errors.Is(err, e.expected) {
+			t.Errorf("for %s expected %v but got %v", e.name, e.expected, err)
+		}
+	}
+}
+
+func TestRedeemable(t *testing.T) {
+	v := models.Voucher{Amount: 100, Balance: 60.5}
+	if r := Redeemable(v, 200); r != 60.5 {
+		t.Errorf("expected whole balance 60.50 but got %.2f", r)
+	}
+	if r := Redeemable(v, 45.25); r != 45.25 {
+		t.Errorf("expected total 45.25 but got %.2f", r)
+	}
+}
@@ -0,0 +1,7 @@
+INSERT INTO public.pricing (id,room_name,price,weekend_uplift,created_at,updated_at) VALUES
+	 (1,'Frost Suite',120,20,'2021-10-04 00:00:00.000','2021-10-04 00:00:00.000'),
+	 (2,'Snow Suite',110,20,'2021-10-04 00:00:00.000','2021-10-04 00:00:00.000'),
+	 (3,'Northern Lights Cabin',180,25,'2021-10-04 00:00:00.000','2021-10-04 00:00:00.000')
+ON CONFLICT (id) DO NOTHING;
+
+SELECT setval('pricing_id_seq', (SELECT MAX(id) FROM pricing));
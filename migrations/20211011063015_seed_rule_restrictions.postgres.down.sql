@@ -0,0 +1,6 @@
+ALTER TABLE room_restrictions DROP CONSTRAINT IF EXISTS room_restrictions_no_overlap;
+delete from room_restrictions where restriction_id in (3, 4, 5, 6);
+delete from restrictions where id in (3, 4, 5, 6);
+ALTER TABLE room_restrictions
+	ADD CONSTRAINT room_restrictions_no_overlap
+	EXCLUDE USING gist (room_id WITH =, daterange(start_date, end_date) WITH &&);
@@ -0,0 +1,14 @@
+INSERT INTO public.restrictions (id,restriction_name,created_at,updated_at) VALUES
+	 (3,'Minimum stay','2021-10-11 00:00:00.000','2021-10-11 00:00:00.000'),
+	 (4,'Maximum stay','2021-10-11 00:00:00.000','2021-10-11 00:00:00.000'),
+	 (5,'Closed to arrival','2021-10-11 00:00:00.000','2021-10-11 00:00:00.000'),
+	 (6,'Closed to departure','2021-10-11 00:00:00.000','2021-10-11 00:00:00.000');
+
+SELECT setval('restrictions_id_seq', (SELECT MAX(id) FROM restrictions));
+
+-- stay rules share dates with reservations, only reservations and owner blocks may not overlap
+ALTER TABLE room_restrictions DROP CONSTRAINT IF EXISTS room_restrictions_no_overlap;
+ALTER TABLE room_restrictions
+	ADD CONSTRAINT room_restrictions_no_overlap
+	EXCLUDE USING gist (room_id WITH =, daterange(start_date, end_date) WITH &&)
+	WHERE (restriction_id IN (1, 2));
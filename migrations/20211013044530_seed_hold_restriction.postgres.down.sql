@@ -0,0 +1,7 @@
+ALTER TABLE room_restrictions DROP CONSTRAINT IF EXISTS room_restrictions_no_overlap;
+delete from room_restrictions where restriction_id = 7;
+delete from restrictions where id = 7;
+ALTER TABLE room_restrictions
+	ADD CONSTRAINT room_restrictions_no_overlap
+	EXCLUDE USING gist (room_id WITH =, daterange(start_date, end_date) WITH &&)
+	WHERE (restriction_id IN (1, 2));
@@ -0,0 +1,11 @@
+INSERT INTO public.restrictions (id,restriction_name,created_at,updated_at) VALUES
+	 (7,'Hold','2021-10-13 00:00:00.000','2021-10-13 00:00:00.000');
+
+SELECT setval('restrictions_id_seq', (SELECT MAX(id) FROM restrictions));
+
+-- holds block the room like reservations until they expire
+ALTER TABLE room_restrictions DROP CONSTRAINT IF EXISTS room_restrictions_no_overlap;
+ALTER TABLE room_restrictions
+	ADD CONSTRAINT room_restrictions_no_overlap
+	EXCLUDE USING gist (room_id WITH =, daterange(start_date, end_date) WITH &&)
+	WHERE (restriction_id IN (1, 2, 7));
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS rooms_ical_token_idx;
+ALTER TABLE rooms DROP COLUMN IF EXISTS ical_token;
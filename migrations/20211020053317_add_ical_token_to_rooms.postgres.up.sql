@@ -0,0 +1,3 @@
+-- secret part of the room calendar feed URL, every room gets its own
+ALTER TABLE rooms ADD COLUMN ical_token varchar(255) NOT NULL DEFAULT replace(gen_random_uuid()::text, '-', '');
+CREATE UNIQUE INDEX rooms_ical_token_idx ON rooms (ical_token);
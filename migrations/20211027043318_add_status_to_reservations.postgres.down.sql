@@ -0,0 +1,10 @@
+ALTER TABLE reservations ADD COLUMN processed integer NOT NULL DEFAULT 0;
+UPDATE reservations SET processed = 1 WHERE status <> 'pending';
+
+DROP INDEX IF EXISTS reservations_status_idx;
+ALTER TABLE reservations
+	DROP COLUMN IF EXISTS no_show_at,
+	DROP COLUMN IF EXISTS checked_out_at,
+	DROP COLUMN IF EXISTS checked_in_at,
+	DROP COLUMN IF EXISTS confirmed_at,
+	DROP COLUMN IF EXISTS status;
@@ -0,0 +1,13 @@
+-- reservation lifecycle replaces the processed flag, each state change has its own timestamp
+ALTER TABLE reservations ADD COLUMN status varchar(20) NOT NULL DEFAULT 'pending';
+ALTER TABLE reservations
+	ADD COLUMN confirmed_at timestamp,
+	ADD COLUMN checked_in_at timestamp,
+	ADD COLUMN checked_out_at timestamp,
+	ADD COLUMN no_show_at timestamp;
+
+UPDATE reservations SET status = 'confirmed', confirmed_at = updated_at WHERE processed = 1;
+UPDATE reservations SET status = 'cancelled' WHERE cancelled_at IS NOT NULL;
+
+ALTER TABLE reservations DROP COLUMN processed;
+CREATE INDEX reservations_status_idx ON reservations (status);
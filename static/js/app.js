@@ -109,3 +109,32 @@ function Prompt() {
     }
 }
 
+
+//disableUnavailableDays greys out days that are not free for a room in a date range picker for the next months
+function disableUnavailableDays(rp, roomId, months) {
+    let now = new Date();
+    let requests = [];
+    for (let i = 0; i < months; i++) {
+        let d = new Date(now.getFullYear(), now.getMonth() + i, 1);
+        let month = d.getFullYear() + "-" + String(d.getMonth() + 1).padStart(2, "0");
+        requests.push(fetch("/api/availability?room_id=" + roomId + "&month=" + month)
+            .then(response => response.json()));
+    }
+
+    Promise.all(requests).then(results => {
+        let disabled = [];
+        results.forEach(data => {
+            if (!data.ok) {
+                return;
+            }
+            data.days.forEach(day => {
+                if (day.status !== "free") {
+                    // picker format is mm-dd-yyyy, API dates are yyyy-mm-dd
+                    let [y, m, d] = day.date.split("-");
+                    disabled.push(m + "-" + d + "-" + y);
+                }
+            });
+        });
+        rp.setOptions({datesDisabled: disabled});
+    });
+}